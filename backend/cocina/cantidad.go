@@ -0,0 +1,275 @@
+// Package cocina interpreta y transforma las cantidades de los ingredientes tal como
+// las escriben los autores ("1 1/2", "1½", "media docena", "2-3") para poder
+// escalarlas a otro número de porciones.
+package cocina
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Cantidad es una cantidad interpretada. Si Hasta es mayor que cero es un rango
+// ("2-3 dientes"). Separador indica el separador decimal que usó el autor (0 si la
+// escribió como entero, fracción o palabra) para devolverla en el mismo formato.
+type Cantidad struct {
+	Valor     float64
+	Hasta     float64
+	Separador byte
+}
+
+// Fracciones unicode que se aceptan al leer y que se usan al redondear
+var glifos = map[rune]float64{
+	'⅛': 1.0 / 8, '¼': 1.0 / 4, '⅓': 1.0 / 3, '⅜': 3.0 / 8, '½': 1.0 / 2,
+	'⅝': 5.0 / 8, '⅔': 2.0 / 3, '¾': 3.0 / 4, '⅞': 7.0 / 8,
+}
+
+// Números escritos con palabras
+var palabras = map[string]float64{
+	"un": 1, "uno": 1, "una": 1, "dos": 2, "tres": 3, "cuatro": 4, "cinco": 5,
+	"seis": 6, "siete": 7, "ocho": 8, "nueve": 9, "diez": 10, "once": 11, "doce": 12,
+	"medio": 0.5, "media": 0.5,
+}
+
+// Palabras que multiplican al número anterior: "tres cuartos", "media docena"
+var multiplicadores = map[string]float64{
+	"cuarto": 1.0 / 4, "cuartos": 1.0 / 4,
+	"tercio": 1.0 / 3, "tercios": 1.0 / 3,
+	"octavo": 1.0 / 8, "octavos": 1.0 / 8,
+	"docena": 12, "docenas": 12,
+}
+
+// Expresiones que indican que la cantidad no se escala ("sal al gusto", "una pizca")
+var noEscalables = []string{"al gusto", "a gusto", "c/n", "cantidad necesaria", "pizca"}
+
+// ParsearCantidad interpreta enteros, decimales con punto o coma, fracciones
+// ("1/2"), números mixtos ("1 1/2", "1½", "1 y 1/2"), palabras ("uno y medio",
+// "tres cuartos", "media docena") y rangos ("2-3", "2 a 3"). Devuelve false si el
+// texto no es una cantidad numérica, por ejemplo "una pizca".
+func ParsearCantidad(texto string) (Cantidad, bool) {
+	texto = strings.ToLower(strings.TrimSpace(texto))
+	if texto == "" {
+		return Cantidad{}, false
+	}
+	// Rangos: "2-3", "2 – 3", "2 a 3"
+	for _, separador := range []string{"-", "–", " a "} {
+		if desde, hasta, ok := strings.Cut(texto, separador); ok {
+			inicio, ok1 := parsearValor(desde)
+			fin, ok2 := parsearValor(hasta)
+			if !ok1 || !ok2 || fin.Valor <= inicio.Valor {
+				return Cantidad{}, false
+			}
+			inicio.Hasta = fin.Valor
+			if inicio.Separador == 0 {
+				inicio.Separador = fin.Separador
+			}
+			return inicio, true
+		}
+	}
+	return parsearValor(texto)
+}
+
+// parsearValor interpreta una cantidad sin rango como suma de términos
+func parsearValor(texto string) (Cantidad, bool) {
+	tokens := separarTokens(texto)
+	var cantidad Cantidad
+	terminos := 0
+	esperaTermino := true
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "y" || token == "+" {
+			if esperaTermino {
+				return Cantidad{}, false
+			}
+			esperaTermino = true
+			continue
+		}
+		valor, separador, ok := valorToken(token)
+		if !ok {
+			return Cantidad{}, false
+		}
+		if i+1 < len(tokens) {
+			if multiplicador, existe := multiplicadores[tokens[i+1]]; existe {
+				valor *= multiplicador
+				i++
+			}
+		}
+		if separador != 0 {
+			cantidad.Separador = separador
+		}
+		cantidad.Valor += valor
+		terminos++
+		esperaTermino = false
+	}
+	if terminos == 0 || esperaTermino || cantidad.Valor <= 0 {
+		return Cantidad{}, false
+	}
+	return cantidad, true
+}
+
+// separarTokens divide por espacios y separa las fracciones unicode pegadas ("1½")
+func separarTokens(texto string) []string {
+	var tokens []string
+	for _, campo := range strings.Fields(texto) {
+		inicio := 0
+		for i, r := range campo {
+			if _, esGlifo := glifos[r]; esGlifo {
+				if i > inicio {
+					tokens = append(tokens, campo[inicio:i])
+				}
+				tokens = append(tokens, string(r))
+				inicio = i + len(string(r))
+			}
+		}
+		if inicio < len(campo) {
+			tokens = append(tokens, campo[inicio:])
+		}
+	}
+	return tokens
+}
+
+// valorToken interpreta un número, fracción, glifo o palabra
+func valorToken(token string) (float64, byte, bool) {
+	if valor, ok := palabras[token]; ok {
+		return valor, 0, true
+	}
+	if r := []rune(token); len(r) == 1 {
+		if valor, ok := glifos[r[0]]; ok {
+			return valor, 0, true
+		}
+	}
+	if numerador, denominador, ok := strings.Cut(token, "/"); ok {
+		n, err1 := strconv.ParseUint(numerador, 10, 32)
+		d, err2 := strconv.ParseUint(denominador, 10, 32)
+		if err1 != nil || err2 != nil || d == 0 {
+			return 0, 0, false
+		}
+		return float64(n) / float64(d), 0, true
+	}
+	for _, r := range token {
+		if !unicode.IsDigit(r) && r != '.' && r != ',' {
+			return 0, 0, false
+		}
+	}
+	var separador byte
+	if strings.Contains(token, ",") {
+		separador = ','
+		token = strings.Replace(token, ",", ".", 1)
+	} else if strings.Contains(token, ".") {
+		separador = '.'
+	}
+	valor, err := strconv.ParseFloat(token, 64)
+	if err != nil || math.IsInf(valor, 0) {
+		return 0, 0, false
+	}
+	return valor, separador, true
+}
+
+// Escalar multiplica la cantidad (y el final del rango) por el factor
+func (c Cantidad) Escalar(factor float64) Cantidad {
+	c.Valor *= factor
+	c.Hasta *= factor
+	return c
+}
+
+// separadorRango une los extremos de un rango al escribirlo. Con "-" un rango con
+// fracciones se lee mal ("1-1 ½"); "1 a 1 ½" se entiende y ParsearCantidad lo acepta.
+const separadorRango = " a "
+
+// String devuelve la cantidad redondeada para la cocina: decimales si el autor los
+// usó y, si no, enteros desde 10 y fracciones de ⅛, ¼, ⅓, ½, ⅔ y ¾ por debajo
+func (c Cantidad) String() string {
+	texto := c.formatear(c.Valor)
+	if c.Hasta > 0 {
+		texto += separadorRango + c.formatear(c.Hasta)
+	}
+	return texto
+}
+
+func (c Cantidad) formatear(valor float64) string {
+	if c.Separador != 0 {
+		decimales := 2
+		if valor >= 10 {
+			decimales = 1
+		}
+		texto := strconv.FormatFloat(redondear(valor, decimales), 'f', -1, 64)
+		return strings.Replace(texto, ".", string(c.Separador), 1)
+	}
+	return FormatearFraccion(valor)
+}
+
+// fraccionesCocina son las fracciones a las que se redondea, de menor a mayor
+var fraccionesCocina = []struct {
+	valor float64
+	glifo string
+}{
+	{0, ""}, {1.0 / 8, "⅛"}, {1.0 / 4, "¼"}, {1.0 / 3, "⅓"}, {1.0 / 2, "½"},
+	{2.0 / 3, "⅔"}, {3.0 / 4, "¾"}, {1, ""},
+}
+
+// FormatearFraccion redondea un valor a un entero más la fracción de cocina más
+// cercana ("1 ½", "⅓"). Desde 10 redondea a entero; nunca devuelve 0 para un
+// valor positivo.
+func FormatearFraccion(valor float64) string {
+	if valor >= 10 {
+		return strconv.FormatFloat(math.Round(valor), 'f', 0, 64)
+	}
+	entero := math.Floor(valor)
+	resto := valor - entero
+	mejor := 0
+	for i, fraccion := range fraccionesCocina {
+		if math.Abs(resto-fraccion.valor) < math.Abs(resto-fraccionesCocina[mejor].valor) {
+			mejor = i
+		}
+	}
+	if fraccionesCocina[mejor].valor == 1 {
+		entero++
+		mejor = 0
+	}
+	glifo := fraccionesCocina[mejor].glifo
+	switch {
+	case entero == 0 && glifo == "":
+		if valor > 0 {
+			return "⅛"
+		}
+		return "0"
+	case entero == 0:
+		return glifo
+	case glifo == "":
+		return strconv.FormatFloat(entero, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(entero, 'f', 0, 64) + " " + glifo
+}
+
+func redondear(valor float64, decimales int) float64 {
+	potencia := math.Pow(10, float64(decimales))
+	return math.Round(valor*potencia) / potencia
+}
+
+// EsEscalable indica si un ingrediente se puede escalar: su cantidad debe ser
+// numérica y ningún texto (unidad, nombre, nota) debe decir "al gusto", "pizca"...
+func EsEscalable(cantidad string, textos ...string) bool {
+	if _, ok := ParsearCantidad(cantidad); !ok {
+		return false
+	}
+	for _, texto := range textos {
+		texto = strings.ToLower(texto)
+		for _, expresion := range noEscalables {
+			if strings.Contains(texto, expresion) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// EscalarTexto devuelve la cantidad escrita multiplicada por el factor. Si el texto
+// no es una cantidad numérica lo devuelve sin cambios y false.
+func EscalarTexto(texto string, factor float64) (string, bool) {
+	cantidad, ok := ParsearCantidad(texto)
+	if !ok {
+		return texto, false
+	}
+	return cantidad.Escalar(factor).String(), true
+}
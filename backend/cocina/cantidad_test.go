@@ -0,0 +1,158 @@
+package cocina
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParsearCantidad(t *testing.T) {
+	casos := []struct {
+		texto    string
+		esperado Cantidad
+	}{
+		{"2", Cantidad{Valor: 2}},
+		{" 3 ", Cantidad{Valor: 3}},
+		// El separador decimal se recuerda para escribir el resultado igual
+		{"1,5", Cantidad{Valor: 1.5, Separador: ','}},
+		{"1.5", Cantidad{Valor: 1.5, Separador: '.'}},
+		{"0.25", Cantidad{Valor: 0.25, Separador: '.'}},
+		// Fracciones y glifos
+		{"1/2", Cantidad{Valor: 0.5}},
+		{"3/4", Cantidad{Valor: 0.75}},
+		{"½", Cantidad{Valor: 0.5}},
+		{"⅓", Cantidad{Valor: 1.0 / 3}},
+		// Números mixtos
+		{"1 1/2", Cantidad{Valor: 1.5}},
+		{"1½", Cantidad{Valor: 1.5}},
+		{"2 ¾", Cantidad{Valor: 2.75}},
+		{"1 y 1/2", Cantidad{Valor: 1.5}},
+		{"1 y ½", Cantidad{Valor: 1.5}},
+		{"1 + 1/2", Cantidad{Valor: 1.5}},
+		// Palabras y multiplicadores
+		{"uno y medio", Cantidad{Valor: 1.5}},
+		{"Medio", Cantidad{Valor: 0.5}},
+		{"tres cuartos", Cantidad{Valor: 0.75}},
+		{"dos tercios", Cantidad{Valor: 2.0 / 3}},
+		{"media docena", Cantidad{Valor: 6}},
+		{"dos docenas", Cantidad{Valor: 24}},
+		// Rangos
+		{"2-3", Cantidad{Valor: 2, Hasta: 3}},
+		{"2 – 3", Cantidad{Valor: 2, Hasta: 3}},
+		{"2 a 3", Cantidad{Valor: 2, Hasta: 3}},
+		{"1½-2", Cantidad{Valor: 1.5, Hasta: 2}},
+		{"1 a 1 ½", Cantidad{Valor: 1, Hasta: 1.5}},
+		{"1,5-2", Cantidad{Valor: 1.5, Hasta: 2, Separador: ','}},
+		{"1-2,5", Cantidad{Valor: 1, Hasta: 2.5, Separador: ','}},
+	}
+	for _, caso := range casos {
+		cantidad, ok := ParsearCantidad(caso.texto)
+		if !ok || !iguales(cantidad.Valor, caso.esperado.Valor) || !iguales(cantidad.Hasta, caso.esperado.Hasta) || cantidad.Separador != caso.esperado.Separador {
+			t.Errorf("ParsearCantidad(%q) = %+v, %v; se esperaba %+v", caso.texto, cantidad, ok, caso.esperado)
+		}
+	}
+
+	invalidos := []string{
+		"", "una pizca", "al gusto", "abc", "2 1/2 tazas",
+		"3-2", "2-2", // rangos invertidos o vacíos
+		"1/0", "1/2/3", "0", "0/3", "-2", "1..5",
+		"y 1", "1 y", "1 y y 2",
+	}
+	for _, texto := range invalidos {
+		if cantidad, ok := ParsearCantidad(texto); ok {
+			t.Errorf("ParsearCantidad(%q) = %+v; debería fallar", texto, cantidad)
+		}
+	}
+}
+
+func iguales(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFormatearFraccion(t *testing.T) {
+	casos := []struct {
+		valor    float64
+		esperado string
+	}{
+		{0, "0"},
+		{0.01, "⅛"}, // nunca 0 para un valor positivo
+		{0.125, "⅛"},
+		{0.2, "¼"},
+		{0.3, "⅓"},
+		{0.5, "½"},
+		{0.6, "⅔"},
+		{0.8, "¾"},
+		{0.9, "1"},
+		{1, "1"},
+		{1.49, "1 ½"},
+		{2.33, "2 ⅓"},
+		{9.96, "10"},
+		{10.4, "10"},
+		{12.5, "13"},
+	}
+	for _, caso := range casos {
+		if texto := FormatearFraccion(caso.valor); texto != caso.esperado {
+			t.Errorf("FormatearFraccion(%v) = %q, se esperaba %q", caso.valor, texto, caso.esperado)
+		}
+	}
+}
+
+func TestEscalarTexto(t *testing.T) {
+	casos := []struct {
+		texto    string
+		factor   float64
+		esperado string
+		escalado bool
+	}{
+		{"2", 2, "4", true},
+		{"1 1/2", 2, "3", true},
+		{"3/4", 1.0 / 3, "¼", true},
+		{"media docena", 0.5, "3", true},
+		{"1", 0.01, "⅛", true},
+		{"100", 1.5, "150", true},
+		// Se conservan los decimales y el separador del autor
+		{"1,5", 3, "4,5", true},
+		{"1.5", 0.5, "0.75", true},
+		{"0,1", 0.5, "0,05", true},
+		// Los rangos se escriben con " a "
+		{"2-3", 0.5, "1 a 1 ½", true},
+		{"2 a 3", 2, "4 a 6", true},
+		{"1,5-2", 0.5, "0,75 a 1", true},
+		// Sin cantidad numérica no cambia
+		{"una pizca", 2, "una pizca", false},
+		{"c/n", 2, "c/n", false},
+	}
+	for _, caso := range casos {
+		texto, ok := EscalarTexto(caso.texto, caso.factor)
+		if texto != caso.esperado || ok != caso.escalado {
+			t.Errorf("EscalarTexto(%q, %v) = %q, %v; se esperaba %q, %v", caso.texto, caso.factor, texto, ok, caso.esperado, caso.escalado)
+		}
+		// Lo escalado se puede volver a leer
+		if ok {
+			if _, leido := ParsearCantidad(texto); !leido {
+				t.Errorf("ParsearCantidad(%q) no lee el resultado de EscalarTexto", texto)
+			}
+		}
+	}
+}
+
+func TestEsEscalable(t *testing.T) {
+	casos := []struct {
+		cantidad string
+		textos   []string
+		esperado bool
+	}{
+		{"2", []string{"tazas", "harina"}, true},
+		{"1/2", []string{"", "sal", ""}, true},
+		{"2-3", []string{"dientes", "ajo", "picados"}, true},
+		{"una pizca", []string{"", "sal"}, false},
+		{"", []string{"", "pimienta"}, false},
+		{"1", []string{"", "sal", "Al gusto"}, false},
+		{"1", []string{"pizca", "nuez moscada"}, false},
+		{"2", []string{"", "aceite", "c/n"}, false},
+	}
+	for _, caso := range casos {
+		if escalable := EsEscalable(caso.cantidad, caso.textos...); escalable != caso.esperado {
+			t.Errorf("EsEscalable(%q, %q) = %v, se esperaba %v", caso.cantidad, caso.textos, escalable, caso.esperado)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package cocina
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Nutrientes son los valores nutricionales de una cantidad de alimento: energía en
+// kcal, sodio en mg y el resto en gramos
+type Nutrientes struct {
+	Calorias      float64 `json:"calorias"`
+	Proteinas     float64 `json:"proteinas"`
+	Grasas        float64 `json:"grasas"`
+	Carbohidratos float64 `json:"carbohidratos"`
+	Fibra         float64 `json:"fibra"`
+	Sodio         float64 `json:"sodio"`
+}
+
+// Sumar devuelve la suma de ambos valores
+func (n Nutrientes) Sumar(otro Nutrientes) Nutrientes {
+	return Nutrientes{
+		Calorias:      n.Calorias + otro.Calorias,
+		Proteinas:     n.Proteinas + otro.Proteinas,
+		Grasas:        n.Grasas + otro.Grasas,
+		Carbohidratos: n.Carbohidratos + otro.Carbohidratos,
+		Fibra:         n.Fibra + otro.Fibra,
+		Sodio:         n.Sodio + otro.Sodio,
+	}
+}
+
+// Escalar multiplica todos los valores por el factor
+func (n Nutrientes) Escalar(factor float64) Nutrientes {
+	return Nutrientes{
+		Calorias:      n.Calorias * factor,
+		Proteinas:     n.Proteinas * factor,
+		Grasas:        n.Grasas * factor,
+		Carbohidratos: n.Carbohidratos * factor,
+		Fibra:         n.Fibra * factor,
+		Sodio:         n.Sodio * factor,
+	}
+}
+
+// Redondear deja un decimal (el sodio y las calorías, enteros) para mostrarlos
+func (n Nutrientes) Redondear() Nutrientes {
+	return Nutrientes{
+		Calorias:      math.Round(n.Calorias),
+		Proteinas:     redondear(n.Proteinas, 1),
+		Grasas:        redondear(n.Grasas, 1),
+		Carbohidratos: redondear(n.Carbohidratos, 1),
+		Fibra:         redondear(n.Fibra, 1),
+		Sodio:         math.Round(n.Sodio),
+	}
+}
+
+// Alimento es una fila de la tabla de referencia. Por100g son los nutrientes de 100 g;
+// Densidad (g/ml) permite calcular las medidas de volumen y GramosUnidad las piezas
+// ("2 huevos", "1 diente de ajo"). Ambas son 0 si no se conocen.
+type Alimento struct {
+	Nombre       string
+	Alias        []string
+	Por100g      Nutrientes
+	Densidad     float64
+	GramosUnidad float64
+}
+
+// Columnas del CSV de la tabla de referencia, en este orden
+var columnasNutrientes = []string{"nombre", "alias", "calorias", "proteinas", "grasas", "carbohidratos", "fibra", "sodio", "densidad", "gramos_unidad"}
+
+// LeerTablaNutrientes lee un CSV con las columnas nombre, alias (separados por |),
+// calorias, proteinas, grasas, carbohidratos, fibra y sodio por 100 g, densidad y
+// gramos_unidad. La primera línea es la cabecera y las que empiezan con # se ignoran.
+func LeerTablaNutrientes(r io.Reader) ([]Alimento, error) {
+	lector := csv.NewReader(r)
+	lector.Comment = '#'
+	lector.FieldsPerRecord = len(columnasNutrientes)
+	lector.TrimLeadingSpace = true
+	cabecera, err := lector.Read()
+	if err != nil {
+		return nil, err
+	}
+	for i, columna := range columnasNutrientes {
+		if strings.ToLower(strings.TrimSpace(cabecera[i])) != columna {
+			return nil, fmt.Errorf("la columna %d debe ser %s", i+1, columna)
+		}
+	}
+
+	var alimentos []Alimento
+	vistos := map[string]bool{}
+	for {
+		fila, err := lector.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		linea, _ := lector.FieldPos(0)
+		nombre := strings.TrimSpace(fila[0])
+		if nombre == "" {
+			return nil, fmt.Errorf("línea %d: el nombre es obligatorio", linea)
+		}
+		if vistos[normalizarAlimento(nombre)] {
+			return nil, fmt.Errorf("línea %d: %s está repetido", linea, nombre)
+		}
+		vistos[normalizarAlimento(nombre)] = true
+		valores := make([]float64, 0, len(fila)-2)
+		for i, campo := range fila[2:] {
+			valor := 0.0
+			if campo = strings.TrimSpace(campo); campo != "" {
+				valor, err = strconv.ParseFloat(strings.Replace(campo, ",", ".", 1), 64)
+				if err != nil || valor < 0 || math.IsInf(valor, 0) {
+					return nil, fmt.Errorf("línea %d: %s debe ser un número positivo", linea, columnasNutrientes[i+2])
+				}
+			}
+			valores = append(valores, valor)
+		}
+		alimento := Alimento{
+			Nombre:       nombre,
+			Por100g:      Nutrientes{valores[0], valores[1], valores[2], valores[3], valores[4], valores[5]},
+			Densidad:     valores[6],
+			GramosUnidad: valores[7],
+		}
+		for _, alias := range strings.Split(fila[1], "|") {
+			if alias = strings.TrimSpace(alias); alias != "" {
+				alimento.Alias = append(alimento.Alias, alias)
+			}
+		}
+		alimentos = append(alimentos, alimento)
+	}
+	if len(alimentos) == 0 {
+		return nil, errors.New("la tabla no tiene alimentos")
+	}
+	return alimentos, nil
+}
+
+// TablaNutrientes busca alimentos por el nombre de un ingrediente
+type TablaNutrientes struct {
+	alimentos []Alimento
+}
+
+// NuevaTablaNutrientes arma la tabla de búsqueda a partir de los alimentos
+func NuevaTablaNutrientes(alimentos []Alimento) TablaNutrientes {
+	return TablaNutrientes{alimentos: alimentos}
+}
+
+// Buscar devuelve el alimento cuyo nombre o alias aparezca en el nombre del
+// ingrediente, en singular o en plural. Gana la coincidencia más larga, así
+// "crema de leche" no se toma por "leche".
+func (t TablaNutrientes) Buscar(ingrediente string) (Alimento, bool) {
+	ingrediente = normalizarAlimento(ingrediente)
+	var mejor Alimento
+	largo := 0
+	for _, alimento := range t.alimentos {
+		for _, clave := range append([]string{alimento.Nombre}, alimento.Alias...) {
+			clave = normalizarAlimento(clave)
+			if len(clave) <= largo {
+				continue
+			}
+			for _, forma := range formasPlural(clave) {
+				if contienePalabra(ingrediente, forma) {
+					mejor, largo = alimento, len(clave)
+					break
+				}
+			}
+		}
+	}
+	return mejor, largo > 0
+}
+
+// formasPlural devuelve la palabra en singular y sus plurales posibles: "papa"
+// → "papas", "limon" → "limones", "nuez" → "nueces"
+func formasPlural(palabra string) []string {
+	formas := []string{palabra, palabra + "s", palabra + "es"}
+	if raiz, ok := strings.CutSuffix(palabra, "z"); ok {
+		formas = append(formas, raiz+"ces")
+	}
+	return formas
+}
+
+func normalizarAlimento(texto string) string {
+	return strings.Join(strings.Fields(sinAcentos.Replace(strings.ToLower(texto))), " ")
+}
+
+// Unidades que indican piezas enteras del alimento ("3 manzanas", "2 dientes de ajo")
+var unidadesPieza = map[string]bool{"": true, "u": true, "unidad": true, "unidades": true, "pieza": true, "piezas": true, "diente": true, "dientes": true}
+
+// Motivos por los que un ingrediente no entra en el cálculo
+const (
+	MotivoSinCantidad       = "La cantidad no es numérica"
+	MotivoSinAlimento       = "No está en la tabla de nutrientes"
+	MotivoUnidadDesconocida = "La unidad no se puede pasar a gramos"
+	MotivoSinDensidad       = "No se conoce su densidad para pasar el volumen a gramos"
+	MotivoSinPeso           = "No se conoce el peso de una unidad"
+)
+
+// NutricionIngrediente es el resultado del cálculo para un ingrediente. Si Motivo no
+// está vacío el ingrediente no se pudo calcular y no suma.
+type NutricionIngrediente struct {
+	Alimento   string     `json:"alimento,omitempty"`
+	Gramos     float64    `json:"gramos,omitempty"`
+	Nutrientes Nutrientes `json:"nutrientes"`
+	Motivo     string     `json:"motivo,omitempty"`
+}
+
+// CalcularIngrediente pasa la cantidad del ingrediente a gramos y calcula sus
+// nutrientes con el alimento de la tabla. Los rangos ("2-3") usan el valor medio.
+func (t TablaNutrientes) CalcularIngrediente(cantidadTexto, unidadTexto, nombre string) NutricionIngrediente {
+	alimento, ok := t.Buscar(nombre)
+	if !ok {
+		return NutricionIngrediente{Motivo: MotivoSinAlimento}
+	}
+	resultado := NutricionIngrediente{Alimento: alimento.Nombre}
+	cantidad, ok := ParsearCantidad(cantidadTexto)
+	if !ok {
+		resultado.Motivo = MotivoSinCantidad
+		return resultado
+	}
+	valor := cantidad.Valor
+	if cantidad.Hasta > 0 {
+		valor = (cantidad.Valor + cantidad.Hasta) / 2
+	}
+
+	var gramos float64
+	u, conocida := buscarUnidad(unidadTexto)
+	switch {
+	case conocida && u.magnitud == masa:
+		gramos = valor * u.factor
+	case conocida && u.magnitud == volumen:
+		densidadAlimento := alimento.Densidad
+		if densidadAlimento == 0 {
+			if d, existe := buscarDensidad(nombre); existe {
+				densidadAlimento = d.gramosPorMl
+			}
+		}
+		if densidadAlimento == 0 {
+			resultado.Motivo = MotivoSinDensidad
+			return resultado
+		}
+		gramos = valor * u.factor * densidadAlimento
+	case !conocida && unidadesPieza[normalizarAlimento(strings.TrimSuffix(unidadTexto, "."))]:
+		if alimento.GramosUnidad == 0 {
+			resultado.Motivo = MotivoSinPeso
+			return resultado
+		}
+		gramos = valor * alimento.GramosUnidad
+	default:
+		resultado.Motivo = MotivoUnidadDesconocida
+		return resultado
+	}
+	resultado.Gramos = redondear(gramos, 1)
+	resultado.Nutrientes = alimento.Por100g.Escalar(gramos / 100)
+	return resultado
+}
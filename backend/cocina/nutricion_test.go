@@ -0,0 +1,162 @@
+package cocina
+
+import (
+	"strings"
+	"testing"
+)
+
+const tablaPrueba = `nombre,alias,calorias,proteinas,grasas,carbohidratos,fibra,sodio,densidad,gramos_unidad
+# Valores por 100 g
+leche,leche entera,60,3,3,5,0,40,1.03,
+crema de leche,nata|crema,340,2,36,3,0,30,,
+huevo,,150,12,10,1,0,140,,50
+nuez,,650,15,65,14,7,2,,
+harina,harina de trigo,360,10,1,76,3,2,,
+ajo,,150,6,"0,5",33,2,17,,5
+limón,,30,1,0,9,3,2,,100
+aceite,aceite de oliva,900,0,100,0,0,0,0.92,
+`
+
+func tablaNutrientesPrueba(t *testing.T) TablaNutrientes {
+	t.Helper()
+	alimentos, err := LeerTablaNutrientes(strings.NewReader(tablaPrueba))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NuevaTablaNutrientes(alimentos)
+}
+
+func TestLeerTablaNutrientes(t *testing.T) {
+	alimentos, err := LeerTablaNutrientes(strings.NewReader(tablaPrueba))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alimentos) != 8 {
+		t.Fatalf("se leyeron %d alimentos, se esperaban 8", len(alimentos))
+	}
+	crema := alimentos[1]
+	if crema.Nombre != "crema de leche" || len(crema.Alias) != 2 || crema.Alias[0] != "nata" || crema.Alias[1] != "crema" {
+		t.Errorf("crema de leche: %+v", crema)
+	}
+	if huevo := alimentos[2]; huevo.Por100g.Calorias != 150 || huevo.Por100g.Sodio != 140 || huevo.Densidad != 0 || huevo.GramosUnidad != 50 {
+		t.Errorf("huevo: %+v", huevo)
+	}
+	if ajo := alimentos[5]; ajo.Por100g.Grasas != 0.5 {
+		t.Errorf("la coma decimal no se leyó: %+v", ajo)
+	}
+
+	cabecera := "nombre,alias,calorias,proteinas,grasas,carbohidratos,fibra,sodio,densidad,gramos_unidad\n"
+	invalidas := map[string]string{
+		"vacía":                "",
+		"sin alimentos":        cabecera,
+		"cabecera distinta":    "nombre,alias,kcal,proteinas,grasas,carbohidratos,fibra,sodio,densidad,gramos_unidad\nleche,,60,3,3,5,0,40,1.03,\n",
+		"columnas de menos":    cabecera + "leche,,60,3,3,5,0,40\n",
+		"nombre vacío":         cabecera + ",,60,3,3,5,0,40,1.03,\n",
+		"nombre repetido":      cabecera + "leche,,60,3,3,5,0,40,1.03,\nLeche,,61,3,3,5,0,40,1.03,\n",
+		"repetido con acentos": cabecera + "limon,,30,1,0,9,3,2,,\nlimón,,30,1,0,9,3,2,,\n",
+		"valor negativo":       cabecera + "leche,,60,-3,3,5,0,40,1.03,\n",
+		"valor no numérico":    cabecera + "leche,,sesenta,3,3,5,0,40,1.03,\n",
+		"valor infinito":       cabecera + "leche,,60,3,3,5,0,Inf,1.03,\n",
+		"densidad negativa":    cabecera + "leche,,60,3,3,5,0,40,-1,\n",
+	}
+	for nombre, contenido := range invalidas {
+		if _, err := LeerTablaNutrientes(strings.NewReader(contenido)); err == nil {
+			t.Errorf("%s: se esperaba un error", nombre)
+		}
+	}
+}
+
+func TestTablaNutrientesBuscar(t *testing.T) {
+	tabla := tablaNutrientesPrueba(t)
+	casos := map[string]string{
+		"leche":                        "leche",
+		"Leche entera":                 "leche",
+		"crema de leche":               "crema de leche", // gana la coincidencia más larga
+		"Crema de leche para batir":    "crema de leche",
+		"nata montada":                 "crema de leche",
+		"huevos":                       "huevo",
+		"huevo batido":                 "huevo",
+		"nueces picadas":               "nuez", // plural en -ces
+		"limones":                      "limón",
+		"jugo de limón":                "limón",
+		"harina de trigo 0000":         "harina",
+		"aceite de oliva extra virgen": "aceite",
+	}
+	for ingrediente, esperado := range casos {
+		alimento, ok := tabla.Buscar(ingrediente)
+		if !ok || alimento.Nombre != esperado {
+			t.Errorf("Buscar(%q) = %q, %v; se esperaba %q", ingrediente, alimento.Nombre, ok, esperado)
+		}
+	}
+	// Solo palabras completas: "ajo" no está en "ajonjolí" ni "leche" en "lechuga"
+	for _, ingrediente := range []string{"ajonjolí", "sal", "lechuga", ""} {
+		if alimento, ok := tabla.Buscar(ingrediente); ok {
+			t.Errorf("Buscar(%q) = %q; no debería encontrar nada", ingrediente, alimento.Nombre)
+		}
+	}
+}
+
+func TestCalcularIngrediente(t *testing.T) {
+	tabla := tablaNutrientesPrueba(t)
+	casos := []struct {
+		nombre                     string
+		cantidad, unidad, alimento string
+		gramos                     float64
+		calorias                   float64
+		motivo                     string
+	}{
+		// Por peso
+		{"gramos", "200", "g", "harina", 200, 720, ""},
+		{"kilos", "1,5", "kg", "harina", 1500, 5400, ""},
+		{"onzas", "4", "oz", "nueces", 113.4, 737, ""},
+		// Por volumen con la densidad del alimento
+		{"taza de leche", "1", "taza", "leche", 243.7, 146, ""},
+		{"ml de aceite", "100", "ml", "aceite de oliva", 92, 828, ""},
+		// Sin densidad en la tabla se usa la de cocina (harina 0,53 g/ml)
+		{"taza de harina", "2", "tazas", "harina", 250.8, 903, ""},
+		{"volumen sin densidad", "1", "taza", "ajo picado", 0, 0, MotivoSinDensidad},
+		// Por piezas con el peso de una unidad
+		{"piezas", "3", "", "huevos", 150, 225, ""},
+		{"dientes", "2", "dientes", "ajo", 10, 15, ""},
+		{"unidades", "1", "u.", "limón", 100, 30, ""},
+		{"rango", "2-4", "", "huevos", 150, 225, ""}, // se usa el valor medio
+		{"pieza sin peso", "2", "", "nueces", 0, 0, MotivoSinPeso},
+		// No se pueden calcular
+		{"sin alimento", "1", "taza", "caldo de verduras", 0, 0, MotivoSinAlimento},
+		{"sin cantidad", "una pizca", "", "harina", 0, 0, MotivoSinCantidad},
+		{"unidad desconocida", "1", "lata", "leche", 0, 0, MotivoUnidadDesconocida},
+	}
+	for _, caso := range casos {
+		resultado := tabla.CalcularIngrediente(caso.cantidad, caso.unidad, caso.alimento)
+		if resultado.Motivo != caso.motivo {
+			t.Errorf("%s: motivo = %q, se esperaba %q", caso.nombre, resultado.Motivo, caso.motivo)
+			continue
+		}
+		if caso.motivo != "" {
+			if resultado.Nutrientes != (Nutrientes{}) {
+				t.Errorf("%s: un ingrediente sin calcular no debe sumar: %+v", caso.nombre, resultado.Nutrientes)
+			}
+			continue
+		}
+		if resultado.Gramos != caso.gramos || resultado.Nutrientes.Redondear().Calorias != caso.calorias {
+			t.Errorf("%s: %v g y %v kcal, se esperaban %v g y %v kcal", caso.nombre, resultado.Gramos, resultado.Nutrientes.Redondear().Calorias, caso.gramos, caso.calorias)
+		}
+	}
+}
+
+func TestNutrientesOperaciones(t *testing.T) {
+	a := Nutrientes{Calorias: 100.4, Proteinas: 1.04, Grasas: 2, Carbohidratos: 3, Fibra: 0.26, Sodio: 10.6}
+	suma := a.Sumar(a)
+	if suma.Calorias != 200.8 || suma.Grasas != 4 {
+		t.Errorf("Sumar: %+v", suma)
+	}
+	mitad := a.Escalar(0.5)
+	if mitad.Carbohidratos != 1.5 || mitad.Sodio != 5.3 {
+		t.Errorf("Escalar: %+v", mitad)
+	}
+	redondeado := a.Redondear()
+	esperado := Nutrientes{Calorias: 100, Proteinas: 1, Grasas: 2, Carbohidratos: 3, Fibra: 0.3, Sodio: 11}
+	if redondeado != esperado {
+		t.Errorf("Redondear = %+v, se esperaba %+v", redondeado, esperado)
+	}
+}
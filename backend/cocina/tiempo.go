@@ -0,0 +1,140 @@
+package cocina
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Minutos que vale cada unidad de tiempo escrita (sin acentos)
+var unidadesTiempo = map[string]float64{
+	"'": 1, "m": 1, "min": 1, "mins": 1, "minuto": 1, "minutos": 1,
+	"h": 60, "hs": 60, "hr": 60, "hrs": 60, "hora": 60, "horas": 60,
+	"d": 1440, "dia": 1440, "dias": 1440,
+}
+
+// Unidad inmediatamente menor: "1 h 30" son 30 minutos
+var unidadMenor = map[float64]float64{60: 1, 1440: 60}
+
+var (
+	// "1:30" (horas y minutos)
+	patronReloj = regexp.MustCompile(`^(\d+):(\d{2})$`)
+	// Números (enteros, decimales, fracciones, glifos), palabras y el apóstrofo de minutos
+	patronTokenTiempo = regexp.MustCompile(`\d*[⅛¼⅓⅜½⅝⅔¾⅞]|\d+(?:[.,]\d+)?(?:/\d+)?|[a-zñ]+|'`)
+)
+
+// ParsearDuracion interpreta un tiempo escrito a mano y lo devuelve en minutos:
+// "45 min", "1 h 30 min", "1h30", "1:30", "1 hora y media", "media hora",
+// "un cuarto de hora", "2 días". Un número solo son minutos y en los rangos
+// ("30-40 min", "1 a 2 horas") se toma el máximo. Devuelve false si el texto no
+// indica una duración con certeza, por ejemplo "toda la noche", "veinte minutos"
+// (solo se reconocen los números en palabras hasta el doce) o "1:75".
+func ParsearDuracion(texto string) (int, bool) {
+	texto = sinAcentos.Replace(strings.ToLower(strings.TrimSpace(texto)))
+	if m := patronReloj.FindStringSubmatch(texto); m != nil {
+		horas, _ := strconv.Atoi(m[1])
+		minutos, _ := strconv.Atoi(m[2])
+		if minutos >= 60 {
+			return 0, false // "1:75" no es una hora válida
+		}
+		return validarMinutos(float64(horas*60 + minutos))
+	}
+	// En un rango basta con el final, que lleva la unidad
+	for _, separador := range []string{"-", "–", " a "} {
+		if _, hasta, ok := strings.Cut(texto, separador); ok {
+			return ParsearDuracion(hasta)
+		}
+	}
+
+	var total, ultimaUnidad float64
+	var numero []string
+	soloPalabras, ignorada := true, false
+	for _, token := range patronTokenTiempo.FindAllString(texto, -1) {
+		if minutos, esUnidad := unidadesTiempo[token]; esUnidad {
+			valor := 1.0 // "hora y media"
+			if len(numero) == 0 && ignorada {
+				return 0, false // "veinte minutos", "unos minutos": no sabemos cuántos
+			}
+			if len(numero) > 0 {
+				cantidad, ok := ParsearCantidad(strings.Join(numero, " "))
+				if !ok {
+					return 0, false
+				}
+				valor = cantidad.Valor
+			}
+			total += valor * minutos
+			ultimaUnidad = minutos
+			numero, soloPalabras = nil, true
+			continue
+		}
+		_, esPalabra := palabras[token]
+		_, esMultiplicador := multiplicadores[token]
+		ignorada = false
+		switch {
+		case esPalabra || esMultiplicador:
+			numero = append(numero, token)
+		case token == "y" && len(numero) > 0:
+			numero = append(numero, token)
+		case !esLetraTexto(token):
+			numero = append(numero, token)
+			soloPalabras = false
+		default:
+			// El resto de palabras ("aprox", "unos", "de") se ignora
+			ignorada = true
+		}
+	}
+
+	// Queda un número sin unidad al final
+	if len(numero) > 0 {
+		cantidad, ok := ParsearCantidad(strings.Join(numero, " "))
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case ultimaUnidad == 0 && soloPalabras:
+			return 0, false // "una noche"
+		case ultimaUnidad == 0:
+			total += cantidad.Valor // "45": minutos
+		case soloPalabras:
+			total += cantidad.Valor * ultimaUnidad // "1 hora y media"
+		default:
+			menor, existe := unidadMenor[ultimaUnidad]
+			if !existe {
+				return 0, false
+			}
+			total += cantidad.Valor * menor // "1 h 30"
+		}
+	}
+	return validarMinutos(total)
+}
+
+func esLetraTexto(token string) bool {
+	return token[0] >= 'a' && token[0] <= 'z' || strings.HasPrefix(token, "ñ")
+}
+
+func validarMinutos(total float64) (int, bool) {
+	minutos := int(math.Round(total))
+	if minutos <= 0 {
+		return 0, false
+	}
+	return minutos, true
+}
+
+// FormatearDuracion escribe los minutos como "45 min", "1 h 30 min" o "2 d 3 h"
+func FormatearDuracion(minutos int) string {
+	if minutos <= 0 {
+		return ""
+	}
+	var partes []string
+	if dias := minutos / 1440; dias > 0 {
+		partes = append(partes, strconv.Itoa(dias)+" d")
+	}
+	if horas := minutos % 1440 / 60; horas > 0 {
+		partes = append(partes, strconv.Itoa(horas)+" h")
+	}
+	if resto := minutos % 60; resto > 0 {
+		partes = append(partes, strconv.Itoa(resto)+" min")
+	}
+	return strings.Join(partes, " ")
+}
@@ -0,0 +1,78 @@
+package cocina
+
+import "testing"
+
+func TestParsearDuracion(t *testing.T) {
+	casos := []struct {
+		texto   string
+		minutos int
+		valido  bool
+	}{
+		{"45 min", 45, true},
+		{"45", 45, true},
+		{"unos 15'", 15, true},
+		{"aprox. 20 minutos", 20, true},
+		{"1 h 30 min", 90, true},
+		{"1h30", 90, true},
+		{"1 H 30", 90, true},
+		{"2 horas y 15 minutos", 135, true},
+		{"1,5 horas", 90, true},
+		{"1.5 h", 90, true},
+		{"½ hora", 30, true},
+		{"1:30", 90, true},
+		{"0:45", 45, true},
+		{"1 hora y media", 90, true},
+		{"hora y media", 90, true},
+		{"media hora", 30, true},
+		{"un cuarto de hora", 15, true},
+		{"tres cuartos de hora", 45, true},
+		{"2 días", 2880, true},
+		{"1 día 2 horas", 1560, true},
+		// En los rangos se toma el máximo
+		{"30-40 min", 40, true},
+		{"30 a 40 minutos", 40, true},
+		{"1 a 2 horas", 120, true},
+		{"1–2 h", 120, true},
+		// No son duraciones
+		{"toda la noche", 0, false},
+		{"una noche", 0, false},
+		{"veinte minutos", 0, false},
+		{"unos minutos", 0, false},
+		{"", 0, false},
+		{"0 min", 0, false},
+		{"1:60", 0, false},
+		{"1:75", 0, false},
+		{"10 min 30", 0, false}, // no hay unidad menor que el minuto
+	}
+	for _, caso := range casos {
+		minutos, ok := ParsearDuracion(caso.texto)
+		if minutos != caso.minutos || ok != caso.valido {
+			t.Errorf("ParsearDuracion(%q) = %d, %v; se esperaba %d, %v", caso.texto, minutos, ok, caso.minutos, caso.valido)
+		}
+	}
+}
+
+func TestFormatearDuracion(t *testing.T) {
+	casos := map[int]string{
+		0:    "",
+		-5:   "",
+		1:    "1 min",
+		45:   "45 min",
+		60:   "1 h",
+		90:   "1 h 30 min",
+		1440: "1 d",
+		1441: "1 d 1 min",
+		3030: "2 d 2 h 30 min",
+	}
+	for minutos, esperado := range casos {
+		if texto := FormatearDuracion(minutos); texto != esperado {
+			t.Errorf("FormatearDuracion(%d) = %q, se esperaba %q", minutos, texto, esperado)
+		}
+	}
+	// Lo que se escribe se vuelve a leer igual
+	for _, minutos := range []int{5, 75, 1530} {
+		if leidos, ok := ParsearDuracion(FormatearDuracion(minutos)); !ok || leidos != minutos {
+			t.Errorf("ParsearDuracion(FormatearDuracion(%d)) = %d, %v", minutos, leidos, ok)
+		}
+	}
+}
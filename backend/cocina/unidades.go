@@ -0,0 +1,332 @@
+package cocina
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Sistema de unidades al que se convierten las cantidades (?unidades=)
+type Sistema string
+
+const (
+	SistemaMetrico  Sistema = "metric"
+	SistemaImperial Sistema = "imperial"
+)
+
+// ParsearSistema valida el valor de ?unidades=
+func ParsearSistema(valor string) (Sistema, bool) {
+	switch Sistema(strings.ToLower(strings.TrimSpace(valor))) {
+	case SistemaMetrico:
+		return SistemaMetrico, true
+	case SistemaImperial:
+		return SistemaImperial, true
+	}
+	return "", false
+}
+
+type magnitud int
+
+const (
+	masa magnitud = iota
+	volumen
+	temperatura
+)
+
+// unidad es una unidad conocida con su equivalencia en gramos o mililitros
+type unidad struct {
+	singular string
+	plural   string
+	magnitud magnitud
+	factor   float64 // gramos o mililitros por unidad (sin uso en temperatura)
+	sistema  Sistema // sistema al que pertenece; vacío si se usa en ambos
+}
+
+func (u unidad) nombre(valor float64) string {
+	if valor > 1 {
+		return u.plural
+	}
+	return u.singular
+}
+
+// Unidades de destino (las medidas de volumen son las de EE. UU.)
+var (
+	gramo       = unidad{"g", "g", masa, 1, SistemaMetrico}
+	kilogramo   = unidad{"kg", "kg", masa, 1000, SistemaMetrico}
+	onza        = unidad{"oz", "oz", masa, 28.3495, SistemaImperial}
+	libra       = unidad{"lb", "lb", masa, 453.592, SistemaImperial}
+	mililitro   = unidad{"ml", "ml", volumen, 1, SistemaMetrico}
+	litro       = unidad{"l", "l", volumen, 1000, SistemaMetrico}
+	taza        = unidad{"taza", "tazas", volumen, 236.588, SistemaImperial}
+	cucharada   = unidad{"cucharada", "cucharadas", volumen, 14.787, ""}
+	cucharadita = unidad{"cucharadita", "cucharaditas", volumen, 4.929, ""}
+	celsius     = unidad{"°C", "°C", temperatura, 0, SistemaMetrico}
+	fahrenheit  = unidad{"°F", "°F", temperatura, 0, SistemaImperial}
+)
+
+// aliasUnidades son las formas habituales de escribir cada unidad (sin acentos)
+var aliasUnidades = []struct {
+	alias  []string
+	unidad unidad
+}{
+	{[]string{"g", "gr", "grs", "gramo", "gramos"}, gramo},
+	{[]string{"kg", "kilo", "kilos", "kilogramo", "kilogramos"}, kilogramo},
+	{[]string{"mg", "miligramo", "miligramos"}, unidad{"mg", "mg", masa, 0.001, SistemaMetrico}},
+	{[]string{"oz", "onza", "onzas", "ounce", "ounces"}, onza},
+	{[]string{"lb", "lbs", "libra", "libras", "pound", "pounds"}, libra},
+	{[]string{"ml", "mililitro", "mililitros", "cc", "cm3"}, mililitro},
+	{[]string{"cl", "centilitro", "centilitros"}, unidad{"cl", "cl", volumen, 10, SistemaMetrico}},
+	{[]string{"dl", "decilitro", "decilitros"}, unidad{"dl", "dl", volumen, 100, SistemaMetrico}},
+	{[]string{"l", "lt", "lts", "litro", "litros"}, litro},
+	{[]string{"taza", "tazas", "cup", "cups"}, taza},
+	{[]string{"cda", "cdas", "cucharada", "cucharadas", "tbsp", "tbs"}, cucharada},
+	{[]string{"cdta", "cdtas", "cucharadita", "cucharaditas", "tsp"}, cucharadita},
+	{[]string{"fl oz", "onza liquida", "onzas liquidas"}, unidad{"fl oz", "fl oz", volumen, 29.5735, SistemaImperial}},
+	{[]string{"pinta", "pintas", "pint", "pints"}, unidad{"pinta", "pintas", volumen, 473.176, SistemaImperial}},
+	{[]string{"galon", "galones", "gal", "gallon"}, unidad{"galón", "galones", volumen, 3785.41, SistemaImperial}},
+	{[]string{"°c", "ºc", "c°", "celsius"}, celsius},
+	{[]string{"°f", "ºf", "f°", "fahrenheit"}, fahrenheit},
+}
+
+// unidades indexa aliasUnidades por alias
+var unidades = func() map[string]unidad {
+	indice := map[string]unidad{}
+	for _, grupo := range aliasUnidades {
+		for _, alias := range grupo.alias {
+			indice[alias] = grupo.unidad
+		}
+	}
+	return indice
+}()
+
+// densidad de un ingrediente en gramos por mililitro. Los sólidos se pasan a gramos
+// en el sistema métrico y a tazas en el imperial; los líquidos, a ml o tazas.
+type densidad struct {
+	claves      []string
+	gramosPorMl float64
+	solido      bool
+}
+
+// densidades de ingredientes comunes (valores medios de tablas de cocina)
+var densidades = []densidad{
+	{[]string{"harina", "flour"}, 0.53, true},
+	{[]string{"maicena", "fecula de maiz", "almidon de maiz", "cornstarch"}, 0.54, true},
+	{[]string{"azucar glas", "azucar impalpable", "azucar flor", "azucar glass", "powdered sugar"}, 0.5, true},
+	{[]string{"azucar morena", "azucar rubia", "azucar mascabo", "brown sugar"}, 0.93, true},
+	{[]string{"azucar", "sugar"}, 0.85, true},
+	{[]string{"cacao", "cocoa"}, 0.42, true},
+	{[]string{"avena", "oats"}, 0.38, true},
+	{[]string{"arroz", "rice"}, 0.78, true},
+	{[]string{"pan rallado", "breadcrumbs"}, 0.45, true},
+	{[]string{"queso rallado", "parmesano"}, 0.42, true},
+	{[]string{"nuez", "nueces", "almendra", "almendras", "walnuts", "almonds"}, 0.5, true},
+	{[]string{"sal", "salt"}, 1.2, true},
+	{[]string{"mantequilla", "manteca", "butter"}, 0.96, true},
+	{[]string{"miel", "honey"}, 1.42, false},
+	{[]string{"aceite", "oil"}, 0.92, false},
+	{[]string{"leche", "milk"}, 1.03, false},
+	{[]string{"crema", "nata", "cream"}, 0.99, false},
+	{[]string{"yogur", "yogurt"}, 1.03, false},
+	{[]string{"agua", "water", "caldo", "vino", "jugo", "zumo"}, 1, false},
+}
+
+var sinAcentos = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+// buscarUnidad normaliza la unidad escrita ("Tazas", "gr.", "Onzas líquidas")
+func buscarUnidad(texto string) (unidad, bool) {
+	texto = sinAcentos.Replace(strings.ToLower(strings.TrimSpace(texto)))
+	texto = strings.TrimSuffix(texto, ".")
+	texto = strings.Join(strings.Fields(texto), " ")
+	u, ok := unidades[texto]
+	return u, ok
+}
+
+// buscarDensidad devuelve la densidad del ingrediente cuyo nombre contenga la clave
+// más larga (así "azúcar glas" no se confunde con "azúcar")
+func buscarDensidad(ingrediente string) (densidad, bool) {
+	ingrediente = sinAcentos.Replace(strings.ToLower(ingrediente))
+	mejor, largo := densidad{}, 0
+	for _, d := range densidades {
+		for _, clave := range d.claves {
+			if len(clave) > largo && contienePalabra(ingrediente, clave) {
+				mejor, largo = d, len(clave)
+			}
+		}
+	}
+	return mejor, largo > 0
+}
+
+// contienePalabra evita que "sal" coincida con "salsa" o "salmón"
+func contienePalabra(texto, clave string) bool {
+	for inicio := 0; ; {
+		i := strings.Index(texto[inicio:], clave)
+		if i < 0 {
+			return false
+		}
+		i += inicio
+		fin := i + len(clave)
+		antes := i == 0 || !esLetra(texto[i-1])
+		despues := fin == len(texto) || !esLetra(texto[fin])
+		if antes && despues {
+			return true
+		}
+		inicio = i + 1
+	}
+}
+
+func esLetra(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 0x80
+}
+
+// ConvertirCantidad convierte la cantidad y la unidad de un ingrediente al sistema
+// indicado. Devuelve false (sin cambios) si la unidad no se reconoce, la cantidad no
+// es numérica o ya está en ese sistema. Las cucharadas y cucharaditas se usan en ambos
+// sistemas y no se convierten.
+func ConvertirCantidad(cantidadTexto, unidadTexto, ingrediente string, sistema Sistema) (string, string, bool) {
+	origen, ok := buscarUnidad(unidadTexto)
+	if !ok || origen.sistema == "" || origen.sistema == sistema {
+		return cantidadTexto, unidadTexto, false
+	}
+	cantidad, ok := ParsearCantidad(cantidadTexto)
+	if !ok {
+		return cantidadTexto, unidadTexto, false
+	}
+
+	if origen.magnitud == temperatura {
+		destino := celsius
+		if sistema == SistemaImperial {
+			destino = fahrenheit
+		}
+		valor := convertirTemperatura(cantidad.Valor, sistema)
+		texto := formatearEntero(valor)
+		if cantidad.Hasta > 0 {
+			texto += separadorRango + formatearEntero(convertirTemperatura(cantidad.Hasta, sistema))
+		}
+		return texto, destino.nombre(valor), true
+	}
+
+	// Pasamos a gramos o mililitros y, si se conoce la densidad, a la magnitud
+	// que corresponde al ingrediente en el sistema de destino
+	base, hasta := cantidad.Valor*origen.factor, cantidad.Hasta*origen.factor
+	destinoMagnitud := origen.magnitud
+	if d, ok := buscarDensidad(ingrediente); ok {
+		switch {
+		case origen.magnitud == volumen && sistema == SistemaMetrico && d.solido:
+			base, hasta, destinoMagnitud = base*d.gramosPorMl, hasta*d.gramosPorMl, masa
+		case origen.magnitud == masa && sistema == SistemaImperial:
+			base, hasta, destinoMagnitud = base/d.gramosPorMl, hasta/d.gramosPorMl, volumen
+		}
+	}
+
+	destino := unidadDestino(base, destinoMagnitud, sistema)
+	valor, valorHasta := base/destino.factor, hasta/destino.factor
+	formatear := FormatearFraccion
+	if sistema == SistemaMetrico {
+		separador := cantidad.Separador
+		if separador == 0 {
+			separador = '.'
+		}
+		formatear = func(v float64) string { return formatearMetrico(v, destino, separador) }
+	}
+	texto := formatear(valor)
+	if valorHasta > 0 {
+		texto += separadorRango + formatear(valorHasta)
+	}
+	// El plural depende de lo que se muestra: 1,06 tazas se escribe "1 taza"
+	mostrado, _ := ParsearCantidad(texto)
+	return texto, destino.nombre(math.Max(mostrado.Valor, mostrado.Hasta)), true
+}
+
+// unidadDestino elige la unidad más legible para la cantidad base (g o ml)
+func unidadDestino(base float64, m magnitud, sistema Sistema) unidad {
+	switch {
+	case sistema == SistemaMetrico && m == masa:
+		if base >= 1000 {
+			return kilogramo
+		}
+		return gramo
+	case sistema == SistemaMetrico:
+		if base >= 1000 {
+			return litro
+		}
+		return mililitro
+	case m == masa:
+		if base >= libra.factor {
+			return libra
+		}
+		return onza
+	}
+	switch {
+	case base < cucharada.factor:
+		return cucharadita
+	case base < taza.factor/4:
+		return cucharada
+	}
+	return taza
+}
+
+// formatearMetrico redondea gramos y mililitros a múltiplos de 5 desde 100, a
+// enteros desde 10 y a un decimal por debajo; kilos y litros llevan hasta 2 decimales
+func formatearMetrico(valor float64, u unidad, separador byte) string {
+	var texto string
+	switch {
+	case u.factor >= 1000:
+		texto = strconv.FormatFloat(redondear(valor, 2), 'f', -1, 64)
+	case valor >= 100:
+		texto = formatearEntero(math.Round(valor/5) * 5)
+	case valor >= 10:
+		texto = formatearEntero(valor)
+	default:
+		texto = strconv.FormatFloat(redondear(valor, 1), 'f', -1, 64)
+	}
+	return strings.Replace(texto, ".", string(separador), 1)
+}
+
+func formatearEntero(valor float64) string {
+	valor = math.Round(valor)
+	if valor == 0 {
+		valor = 0 // sin signo: -0.4 se escribe "0", no "-0"
+	}
+	return strconv.FormatFloat(valor, 'f', 0, 64)
+}
+
+// convertirTemperatura pasa de °C a °F (o al revés) redondeando a 5 grados, como
+// se marcan los hornos
+func convertirTemperatura(valor float64, sistema Sistema) float64 {
+	if sistema == SistemaImperial {
+		return math.Round((valor*9/5+32)/5) * 5
+	}
+	return math.Round(((valor-32)*5/9)/5) * 5
+}
+
+// Temperatura con signo opcional ("-18 °C") o rango ("180-200 °C")
+var patronTemperatura = regexp.MustCompile(`(?:(\d+(?:[.,]\d+)?)\s*[-–]\s*)?(-?\d+(?:[.,]\d+)?)\s*(?:°|º)\s*([CcFf])\b`)
+
+// ConvertirTemperaturasTexto convierte las temperaturas escritas en un texto
+// ("hornear a 180 °C", "congelar a -18 °C") al sistema indicado
+func ConvertirTemperaturasTexto(texto string, sistema Sistema) string {
+	return patronTemperatura.ReplaceAllStringFunc(texto, func(coincidencia string) string {
+		partes := patronTemperatura.FindStringSubmatch(coincidencia)
+		escala := strings.ToUpper(partes[3])
+		if (escala == "C") == (sistema == SistemaMetrico) {
+			return coincidencia
+		}
+		valor, err := strconv.ParseFloat(strings.Replace(partes[2], ",", ".", 1), 64)
+		if err != nil {
+			return coincidencia
+		}
+		convertido := formatearEntero(convertirTemperatura(valor, sistema))
+		if partes[1] != "" {
+			desde, err := strconv.ParseFloat(strings.Replace(partes[1], ",", ".", 1), 64)
+			if err != nil {
+				return coincidencia
+			}
+			convertido = formatearEntero(convertirTemperatura(desde, sistema)) + "-" + convertido
+		}
+		if sistema == SistemaImperial {
+			return convertido + " °F"
+		}
+		return convertido + " °C"
+	})
+}
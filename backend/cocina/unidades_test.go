@@ -0,0 +1,89 @@
+package cocina
+
+import "testing"
+
+func TestParsearSistema(t *testing.T) {
+	casos := map[string]Sistema{"metric": SistemaMetrico, " Imperial ": SistemaImperial}
+	for valor, esperado := range casos {
+		if sistema, ok := ParsearSistema(valor); !ok || sistema != esperado {
+			t.Errorf("ParsearSistema(%q) = %q, %v", valor, sistema, ok)
+		}
+	}
+	for _, valor := range []string{"", "metrico", "us"} {
+		if _, ok := ParsearSistema(valor); ok {
+			t.Errorf("ParsearSistema(%q) debería fallar", valor)
+		}
+	}
+}
+
+func TestConvertirTemperaturasTexto(t *testing.T) {
+	casos := []struct {
+		texto    string
+		sistema  Sistema
+		esperado string
+	}{
+		// °C a °F (redondeado a 5 grados, como los hornos)
+		{"Hornear a 180 °C por 40 min", SistemaImperial, "Hornear a 355 °F por 40 min"},
+		{"Hornear a 180°C y luego a 160 ºC", SistemaImperial, "Hornear a 355 °F y luego a 320 °F"},
+		{"Entre 180-200 °C", SistemaImperial, "Entre 355-390 °F"},
+		{"Templar a 37,5 °C", SistemaImperial, "Templar a 100 °F"},
+		{"Congelar a -18°C", SistemaImperial, "Congelar a 0 °F"},
+		{"Enfriar a -5 °C", SistemaImperial, "Enfriar a 25 °F"},
+		{"-40 °C", SistemaImperial, "-40 °F"},
+		{"Hervir a 100 °C", SistemaImperial, "Hervir a 210 °F"},
+		// °F a °C
+		{"Bake at 350 °F", SistemaMetrico, "Bake at 175 °C"},
+		{"Entre 325-350 °F", SistemaMetrico, "Entre 165-175 °C"},
+		{"32°F", SistemaMetrico, "0 °C"},
+		{"A 0 °F", SistemaMetrico, "A -20 °C"},
+		{"A -10 °F", SistemaMetrico, "A -25 °C"},
+		// Ya está en el sistema pedido o no hay temperaturas
+		{"Hornear a 180 °C", SistemaMetrico, "Hornear a 180 °C"},
+		{"Congelar a -18 °C", SistemaMetrico, "Congelar a -18 °C"},
+		{"Bake at 350 °F", SistemaImperial, "Bake at 350 °F"},
+		{"Batir 2-3 minutos", SistemaImperial, "Batir 2-3 minutos"},
+		{"Grado C de dificultad", SistemaImperial, "Grado C de dificultad"},
+	}
+	for _, caso := range casos {
+		if resultado := ConvertirTemperaturasTexto(caso.texto, caso.sistema); resultado != caso.esperado {
+			t.Errorf("ConvertirTemperaturasTexto(%q, %s) = %q, se esperaba %q", caso.texto, caso.sistema, resultado, caso.esperado)
+		}
+	}
+}
+
+func TestConvertirCantidad(t *testing.T) {
+	casos := []struct {
+		cantidad, unidad, ingrediente string
+		sistema                       Sistema
+		cantidadEsperada              string
+		unidadEsperada                string
+		convertido                    bool
+	}{
+		// A métrico
+		{"8", "oz", "queso", SistemaMetrico, "225", "g", true},
+		{"1", "lb", "carne", SistemaMetrico, "455", "g", true},
+		{"1", "taza", "leche", SistemaMetrico, "235", "ml", true},
+		{"2-3", "tazas", "leche", SistemaMetrico, "475 a 710", "ml", true},
+		{"2", "tazas", "harina", SistemaMetrico, "250", "g", true}, // sólido con densidad: a gramos
+		{"350", "°F", "", SistemaMetrico, "175", "°C", true},
+		// A imperial
+		{"500", "g", "harina", SistemaImperial, "4", "tazas", true},
+		{"250", "ml", "leche", SistemaImperial, "1", "taza", true},
+		{"1,5", "l", "agua", SistemaImperial, "6 ⅓", "tazas", true},
+		{"180", "°C", "", SistemaImperial, "355", "°F", true},
+		// Sin cambios
+		{"500", "g", "harina", SistemaMetrico, "500", "g", false},
+		{"2", "cucharadas", "aceite", SistemaMetrico, "2", "cucharadas", false},
+		{"3", "", "huevos", SistemaImperial, "3", "", false},
+		{"una pizca", "", "sal", SistemaImperial, "una pizca", "", false},
+		{"al gusto", "g", "sal", SistemaImperial, "al gusto", "g", false},
+	}
+	for _, caso := range casos {
+		cantidad, unidad, ok := ConvertirCantidad(caso.cantidad, caso.unidad, caso.ingrediente, caso.sistema)
+		if cantidad != caso.cantidadEsperada || unidad != caso.unidadEsperada || ok != caso.convertido {
+			t.Errorf("ConvertirCantidad(%q, %q, %q, %s) = %q, %q, %v; se esperaba %q, %q, %v",
+				caso.cantidad, caso.unidad, caso.ingrediente, caso.sistema, cantidad, unidad, ok,
+				caso.cantidadEsperada, caso.unidadEsperada, caso.convertido)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"backend/cocina"
+	"time"
+)
+
 type EjemploDto struct {
 	Correo   string `json:"correo"`
 	Password string `json:"password"`
@@ -11,9 +16,31 @@ type CategoriaDto struct {
 
 type RecetaDto struct {
 	Nombre      string `json:"nombre" binding:"required"`
-	Tiempo      string `json:"tiempo" binding:"required"`
 	Descripcion string `json:"descripcion" binding:"required"`
 	CategoriaId uint   `json:"categoria_id"`
+	// Tiempos en minutos; los omitidos no se modifican. Si no viene ninguno se
+	// interpreta el texto tiempo ("1 h 30 min") como tiempo de preparación
+	Tiempo            string `json:"tiempo"`
+	TiempoPreparacion *int   `json:"tiempo_preparacion"`
+	TiempoCoccion     *int   `json:"tiempo_coccion"`
+	TiempoReposo      *int   `json:"tiempo_reposo"`
+	// Porciones que rinde la receta; si se omite no se modifica
+	Porciones *int `json:"porciones"`
+	// Si vienen reemplazan la lista completa; si se omiten no se modifican
+	Ingredientes *[]IngredienteDto `json:"ingredientes"`
+	Pasos        *[]PasoDto        `json:"pasos"`
+}
+
+type IngredienteDto struct {
+	Cantidad string `json:"cantidad"`
+	Unidad   string `json:"unidad"`
+	Nombre   string `json:"nombre"`
+	Nota     string `json:"nota"`
+	Grupo    string `json:"grupo"`
+}
+
+type PasoDto struct {
+	Texto string `json:"texto"`
 }
 
 // response
@@ -26,9 +53,67 @@ type RecetaResponse struct {
 	UsuarioId   uint   `json:"usuario_id"`
 	Usuario     string `json:"usuario"`
 	Tiempo      string `json:"tiempo"`
-	Foto        string `json:"foto"`
-	Descripcion string `json:"descripcion"`
-	Fecha       string `json:"fecha"`
+	// Tiempos en minutos; TiempoTotal es la suma de los otros tres
+	TiempoPreparacion int                   `json:"tiempo_preparacion"`
+	TiempoCoccion     int                   `json:"tiempo_coccion"`
+	TiempoReposo      int                   `json:"tiempo_reposo"`
+	TiempoTotal       int                   `json:"tiempo_total"`
+	Foto              string                `json:"foto"`
+	Descripcion       string                `json:"descripcion"`
+	Porciones         int                   `json:"porciones"`
+	Ingredientes      []IngredienteResponse `json:"ingredientes"`
+	Pasos             []PasoResponse        `json:"pasos"`
+	Fecha             string                `json:"fecha"`
+}
+
+// IngredienteResponse es un ingrediente tal como se muestra. Si se escaló o se
+// convirtió a otro sistema de unidades, CantidadOriginal y UnidadOriginal guardan
+// lo que escribió el autor.
+type IngredienteResponse struct {
+	Cantidad         string `json:"cantidad"`
+	Unidad           string `json:"unidad"`
+	Nombre           string `json:"nombre"`
+	Nota             string `json:"nota"`
+	Grupo            string `json:"grupo"`
+	CantidadOriginal string `json:"cantidad_original,omitempty"`
+	UnidadOriginal   string `json:"unidad_original,omitempty"`
+	Convertido       bool   `json:"convertido,omitempty"`
+}
+
+// IngredienteEscaladoResponse es un ingrediente con la cantidad recalculada para
+// otro número de porciones; Cantidad queda igual a CantidadOriginal si no se escala
+type IngredienteEscaladoResponse struct {
+	IngredienteResponse
+	Escalado bool `json:"escalado"`
+}
+
+// NutricionIngredienteResponse es el aporte de un ingrediente; si no se pudo
+// calcular trae el motivo y no suma
+type NutricionIngredienteResponse struct {
+	Cantidad string `json:"cantidad"`
+	Unidad   string `json:"unidad"`
+	Nombre   string `json:"nombre"`
+	cocina.NutricionIngrediente
+}
+
+// NutricionResponse son los nutrientes de una receta. PorPorcion es nil si la
+// receta no indica cuántas porciones rinde.
+type NutricionResponse struct {
+	Id           uint                           `json:"id"`
+	Nombre       string                         `json:"nombre"`
+	Slug         string                         `json:"slug"`
+	Porciones    int                            `json:"porciones"`
+	PorPorcion   *cocina.Nutrientes             `json:"por_porcion"`
+	Total        cocina.Nutrientes              `json:"total"`
+	Completo     bool                           `json:"completo"`
+	Ingredientes []NutricionIngredienteResponse `json:"ingredientes"`
+	SinCalcular  []NutricionIngredienteResponse `json:"sin_calcular"`
+	CalculadoEn  time.Time                      `json:"calculado_en"`
+}
+
+type PasoResponse struct {
+	Numero int    `json:"numero"`
+	Texto  string `json:"texto"`
 }
 
 type RecetasResponses []RecetaResponse
@@ -50,3 +135,93 @@ type LoginDto struct {
 	Correo   string `json:"correo"`
 	Password string `json:"password"`
 }
+
+type RefreshDto struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type OlvidePasswordDto struct {
+	Correo string `json:"correo"`
+}
+
+type EnlaceMagicoDto struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResetPasswordDto struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type RolDto struct {
+	Rol string `json:"rol" binding:"required"`
+}
+
+type EstadoUsuarioDto struct {
+	EstadoID uint   `json:"estado_id" binding:"required"`
+	Motivo   string `json:"motivo" binding:"required,max=255"`
+}
+
+type CodigoDosFactoresDto struct {
+	Codigo string `json:"codigo" binding:"required"`
+}
+
+type DesactivarDosFactoresDto struct {
+	Password string `json:"password" binding:"required"`
+	Codigo   string `json:"codigo" binding:"required"`
+}
+
+type VerificarDosFactoresDto struct {
+	Desafio string `json:"desafio" binding:"required"`
+	Codigo  string `json:"codigo" binding:"required"`
+}
+
+type LlaveApiDto struct {
+	Nombre string   `json:"nombre" binding:"required"`
+	Scopes []string `json:"scopes"`
+}
+
+type NombreLlaveApiDto struct {
+	Nombre string `json:"nombre" binding:"required"`
+}
+
+type PerfilDto struct {
+	Nombre string `json:"nombre" binding:"required"`
+	Correo string `json:"correo" binding:"required"`
+}
+
+type CambiarPasswordDto struct {
+	PasswordActual string `json:"password_actual" binding:"required"`
+	Password       string `json:"password" binding:"required"`
+}
+
+type EliminarCuentaDto struct {
+	Password string `json:"password"` // Opcional: sin ella se exige una sesión reciente o se confirma por correo
+}
+
+type ConfirmarBajaDto struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type WebauthnRegistroDto struct {
+	Nombre   string `json:"nombre"`
+	ID       string `json:"id" binding:"required"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AttestationObject string `json:"attestationObject" binding:"required"`
+	} `json:"response"`
+}
+
+type WebauthnOpcionesLoginDto struct {
+	Correo string `json:"correo"`
+}
+
+type WebauthnLoginDto struct {
+	ID       string `json:"id" binding:"required"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData string `json:"authenticatorData" binding:"required"`
+		Signature         string `json:"signature" binding:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
@@ -0,0 +1,77 @@
+package intentos
+
+import (
+	"backend/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BaseDatos guarda los intentos en la tabla intento_logins, compartida entre instancias
+type BaseDatos struct {
+	db *gorm.DB
+}
+
+func NuevoAlmacenBaseDatos(db *gorm.DB) *BaseDatos {
+	return &BaseDatos{db: db}
+}
+
+func (b *BaseDatos) Obtener(clave string) (Registro, error) {
+	fila := models.IntentoLogin{}
+	err := b.db.Where(&models.IntentoLogin{Clave: clave}).First(&fila).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Registro{}, nil
+	}
+	if err != nil {
+		return Registro{}, err
+	}
+	return aRegistro(fila), nil
+}
+
+func (b *BaseDatos) RegistrarFallo(clave string, ventana time.Duration) (Registro, error) {
+	fila := models.IntentoLogin{}
+	err := b.db.Transaction(func(tx *gorm.DB) error {
+		// Bloqueamos la fila para que dos fallos simultáneos no se pisen
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(&models.IntentoLogin{Clave: clave}).First(&fila).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ahora := time.Now()
+		if fila.UltimoFallo != nil && ahora.Sub(*fila.UltimoFallo) > ventana {
+			fila.Fallos = 0
+		}
+		fila.Clave = clave
+		fila.Fallos++
+		fila.UltimoFallo = &ahora
+		return tx.Save(&fila).Error
+	})
+	if err != nil {
+		return Registro{}, err
+	}
+	return aRegistro(fila), nil
+}
+
+func (b *BaseDatos) Bloquear(clave string, hasta time.Time) error {
+	fila := models.IntentoLogin{Clave: clave}
+	if err := b.db.Where(&models.IntentoLogin{Clave: clave}).FirstOrCreate(&fila).Error; err != nil {
+		return err
+	}
+	return b.db.Model(&fila).Update("bloqueado_hasta", hasta).Error
+}
+
+func (b *BaseDatos) Reiniciar(clave string) error {
+	return b.db.Where(&models.IntentoLogin{Clave: clave}).Delete(&models.IntentoLogin{}).Error
+}
+
+func aRegistro(fila models.IntentoLogin) Registro {
+	r := Registro{Fallos: fila.Fallos}
+	if fila.UltimoFallo != nil {
+		r.UltimoFallo = *fila.UltimoFallo
+	}
+	if fila.BloqueadoHasta != nil {
+		r.BloqueadoHasta = *fila.BloqueadoHasta
+	}
+	return r
+}
@@ -0,0 +1,91 @@
+package intentos
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Registro es el estado de los intentos fallidos de una clave (correo o IP)
+type Registro struct {
+	Fallos         int
+	UltimoFallo    time.Time
+	BloqueadoHasta time.Time
+}
+
+// Almacen guarda los contadores de intentos fallidos. Existe una implementación
+// en memoria (pruebas o una sola instancia) y otra en base de datos.
+type Almacen interface {
+	// Obtener devuelve el registro de la clave (vacío si no existe)
+	Obtener(clave string) (Registro, error)
+	// RegistrarFallo suma un fallo; si el anterior es más antiguo que la ventana el contador vuelve a empezar
+	RegistrarFallo(clave string, ventana time.Duration) (Registro, error)
+	// Bloquear impide nuevos intentos de la clave hasta la fecha indicada
+	Bloquear(clave string, hasta time.Time) error
+	// Reiniciar borra los fallos y el bloqueo de la clave
+	Reiniciar(clave string) error
+}
+
+// Politica define cuántos fallos se permiten y cuánto hay que esperar
+type Politica struct {
+	MaxFallos     int           // Fallos por correo antes de bloquear la cuenta
+	MaxFallosIP   int           // Fallos por IP antes de bloquear la IP
+	UmbralRetraso int           // A partir de este número de fallos se exige una espera creciente
+	RetrasoBase   time.Duration // Primera espera; se duplica con cada fallo adicional
+	Bloqueo       time.Duration // Duración del bloqueo temporal
+	Ventana       time.Duration // Tiempo sin fallos tras el cual el contador se reinicia
+}
+
+var (
+	cargaPolitica  sync.Once
+	politicaActual Politica
+)
+
+// PoliticaActual devuelve la política del entorno. Se lee la primera vez que se usa,
+// después de que main cargue el .env, y no al inicializar el paquete.
+func PoliticaActual() Politica {
+	cargaPolitica.Do(func() {
+		politicaActual = PoliticaDesdeEntorno()
+	})
+	return politicaActual
+}
+
+// PoliticaDesdeEntorno construye la política con las variables LOGIN_* del .env
+func PoliticaDesdeEntorno() Politica {
+	return Politica{
+		MaxFallos:     enteroEntorno("LOGIN_MAX_INTENTOS", 5),
+		MaxFallosIP:   enteroEntorno("LOGIN_MAX_INTENTOS_IP", 20),
+		UmbralRetraso: 3,
+		RetrasoBase:   time.Second,
+		Bloqueo:       time.Duration(enteroEntorno("LOGIN_BLOQUEO_MINUTOS", 15)) * time.Minute,
+		Ventana:       time.Duration(enteroEntorno("LOGIN_VENTANA_MINUTOS", 15)) * time.Minute,
+	}
+}
+
+// Espera devuelve cuánto falta para que la clave pueda volver a intentar (0 si puede ya).
+// Tiene en cuenta el bloqueo temporal y el retraso progresivo tras varios fallos.
+func (p Politica) Espera(r Registro, ahora time.Time) time.Duration {
+	espera := r.BloqueadoHasta.Sub(ahora)
+	if r.Fallos >= p.UmbralRetraso && p.UmbralRetraso > 0 {
+		retraso := p.RetrasoBase << uint(r.Fallos-p.UmbralRetraso)
+		if retraso <= 0 || retraso > p.Bloqueo {
+			retraso = p.Bloqueo
+		}
+		if resto := r.UltimoFallo.Add(retraso).Sub(ahora); resto > espera {
+			espera = resto
+		}
+	}
+	if espera < 0 {
+		return 0
+	}
+	return espera
+}
+
+func enteroEntorno(nombre string, defecto int) int {
+	valor, err := strconv.Atoi(os.Getenv(nombre))
+	if err != nil || valor <= 0 {
+		return defecto
+	}
+	return valor
+}
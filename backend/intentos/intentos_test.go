@@ -0,0 +1,63 @@
+package intentos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoliticaEspera(t *testing.T) {
+	p := Politica{MaxFallos: 5, UmbralRetraso: 3, RetrasoBase: time.Second, Bloqueo: 15 * time.Minute, Ventana: 15 * time.Minute}
+	ahora := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	casos := []struct {
+		nombre   string
+		registro Registro
+		esperado time.Duration
+	}{
+		{"sin fallos", Registro{}, 0},
+		{"bajo el umbral", Registro{Fallos: 2, UltimoFallo: ahora}, 0},
+		{"en el umbral", Registro{Fallos: 3, UltimoFallo: ahora}, time.Second},
+		{"se duplica", Registro{Fallos: 4, UltimoFallo: ahora}, 2 * time.Second},
+		{"se vuelve a duplicar", Registro{Fallos: 5, UltimoFallo: ahora}, 4 * time.Second},
+		{"descuenta el tiempo transcurrido", Registro{Fallos: 4, UltimoFallo: ahora.Add(-1500 * time.Millisecond)}, 500 * time.Millisecond},
+		{"retraso cumplido", Registro{Fallos: 4, UltimoFallo: ahora.Add(-3 * time.Second)}, 0},
+		{"tope en la duración del bloqueo", Registro{Fallos: 30, UltimoFallo: ahora}, 15 * time.Minute},
+		{"desborde del desplazamiento", Registro{Fallos: 100, UltimoFallo: ahora}, 15 * time.Minute},
+		{"bloqueo vigente", Registro{BloqueadoHasta: ahora.Add(10 * time.Minute)}, 10 * time.Minute},
+		{"bloqueo vencido", Registro{Fallos: 5, UltimoFallo: ahora.Add(-20 * time.Minute), BloqueadoHasta: ahora.Add(-5 * time.Minute)}, 0},
+		{"gana la espera mayor", Registro{Fallos: 3, UltimoFallo: ahora, BloqueadoHasta: ahora.Add(time.Minute)}, time.Minute},
+	}
+	for _, caso := range casos {
+		if espera := p.Espera(caso.registro, ahora); espera != caso.esperado {
+			t.Errorf("%s: Espera = %v, se esperaba %v", caso.nombre, espera, caso.esperado)
+		}
+	}
+
+	// Sin umbral solo cuenta el bloqueo
+	p.UmbralRetraso = 0
+	if espera := p.Espera(Registro{Fallos: 10, UltimoFallo: ahora}, ahora); espera != 0 {
+		t.Errorf("sin umbral: Espera = %v, se esperaba 0", espera)
+	}
+}
+
+func TestPoliticaActualLeeElEntornoAlUsarse(t *testing.T) {
+	// Las variables se definen después de cargar el paquete, como hace godotenv en main
+	t.Setenv("LOGIN_MAX_INTENTOS", "7")
+	t.Setenv("LOGIN_MAX_INTENTOS_IP", "50")
+	t.Setenv("LOGIN_BLOQUEO_MINUTOS", "30")
+	t.Setenv("LOGIN_VENTANA_MINUTOS", "10")
+	p := PoliticaActual()
+	if p.MaxFallos != 7 || p.MaxFallosIP != 50 || p.Bloqueo != 30*time.Minute || p.Ventana != 10*time.Minute {
+		t.Fatalf("PoliticaActual = %+v", p)
+	}
+}
+
+func TestPoliticaDesdeEntornoValoresPorDefecto(t *testing.T) {
+	t.Setenv("LOGIN_MAX_INTENTOS", "")
+	t.Setenv("LOGIN_MAX_INTENTOS_IP", "cero")
+	t.Setenv("LOGIN_BLOQUEO_MINUTOS", "-1")
+	t.Setenv("LOGIN_VENTANA_MINUTOS", "0")
+	p := PoliticaDesdeEntorno()
+	if p.MaxFallos != 5 || p.MaxFallosIP != 20 || p.Bloqueo != 15*time.Minute || p.Ventana != 15*time.Minute {
+		t.Fatalf("PoliticaDesdeEntorno = %+v", p)
+	}
+}
@@ -0,0 +1,52 @@
+package intentos
+
+import (
+	"sync"
+	"time"
+)
+
+// Memoria guarda los intentos en un mapa protegido por mutex
+type Memoria struct {
+	mu        sync.Mutex
+	registros map[string]Registro
+}
+
+func NuevoAlmacenMemoria() *Memoria {
+	return &Memoria{registros: map[string]Registro{}}
+}
+
+func (m *Memoria) Obtener(clave string) (Registro, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.registros[clave], nil
+}
+
+func (m *Memoria) RegistrarFallo(clave string, ventana time.Duration) (Registro, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ahora := time.Now()
+	r := m.registros[clave]
+	if !r.UltimoFallo.IsZero() && ahora.Sub(r.UltimoFallo) > ventana {
+		r.Fallos = 0
+	}
+	r.Fallos++
+	r.UltimoFallo = ahora
+	m.registros[clave] = r
+	return r, nil
+}
+
+func (m *Memoria) Bloquear(clave string, hasta time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.registros[clave]
+	r.BloqueadoHasta = hasta
+	m.registros[clave] = r
+	return nil
+}
+
+func (m *Memoria) Reiniciar(clave string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.registros, clave)
+	return nil
+}
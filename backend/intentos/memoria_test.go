@@ -0,0 +1,74 @@
+package intentos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoriaRegistrarFallo(t *testing.T) {
+	m := NuevoAlmacenMemoria()
+	for i := 1; i <= 3; i++ {
+		r, err := m.RegistrarFallo("correo:ana@example.com", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Fallos != i || r.UltimoFallo.IsZero() {
+			t.Fatalf("fallo %d: registro %+v", i, r)
+		}
+	}
+	// Cada clave lleva su propio contador
+	if r, _ := m.RegistrarFallo("ip:10.0.0.1", time.Minute); r.Fallos != 1 {
+		t.Fatalf("otra clave: %+v", r)
+	}
+	if r, _ := m.Obtener("correo:ana@example.com"); r.Fallos != 3 {
+		t.Fatalf("Obtener: %+v", r)
+	}
+	if r, _ := m.Obtener("correo:nadie@example.com"); r != (Registro{}) {
+		t.Fatalf("clave inexistente: %+v", r)
+	}
+}
+
+func TestMemoriaVentana(t *testing.T) {
+	m := NuevoAlmacenMemoria()
+	ventana := 50 * time.Millisecond
+	m.RegistrarFallo("clave", ventana)
+	if r, _ := m.RegistrarFallo("clave", ventana); r.Fallos != 2 {
+		t.Fatalf("dentro de la ventana: %+v", r)
+	}
+	time.Sleep(2 * ventana)
+	// Pasada la ventana sin fallos el contador vuelve a empezar
+	if r, _ := m.RegistrarFallo("clave", ventana); r.Fallos != 1 {
+		t.Fatalf("fuera de la ventana: %+v", r)
+	}
+}
+
+func TestMemoriaBloquearYReiniciar(t *testing.T) {
+	m := NuevoAlmacenMemoria()
+	hasta := time.Now().Add(time.Hour)
+	m.RegistrarFallo("clave", time.Minute)
+	m.RegistrarFallo("clave", time.Minute)
+	if err := m.Bloquear("clave", hasta); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := m.Obtener("clave")
+	if r.Fallos != 2 || !r.BloqueadoHasta.Equal(hasta) {
+		t.Fatalf("Bloquear: %+v", r)
+	}
+	if espera := PoliticaDesdeEntorno().Espera(r, time.Now()); espera <= 59*time.Minute {
+		t.Fatalf("espera con bloqueo = %v", espera)
+	}
+
+	if err := m.Reiniciar("clave"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := m.Obtener("clave"); r != (Registro{}) {
+		t.Fatalf("Reiniciar no borró el registro: %+v", r)
+	}
+	if r, _ := m.RegistrarFallo("clave", time.Minute); r.Fallos != 1 || !r.BloqueadoHasta.IsZero() {
+		t.Fatalf("después de Reiniciar: %+v", r)
+	}
+	// Reiniciar una clave inexistente no es un error
+	if err := m.Reiniciar("otra"); err != nil {
+		t.Fatal(err)
+	}
+}
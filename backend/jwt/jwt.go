@@ -1,21 +1,92 @@
 package jwt
 
 import (
+	"errors"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-func GenerarJWT(correo string, nombre string, id uint) (string, error) {
-	miClave := []byte(os.Getenv("SECRET_JWT"))
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+// Tipos de token (claim "tipo")
+const (
+	TipoAcceso  = "acceso" // Token de acceso normal
+	TipoDesafio = "2fa"    // Token intermedio: contraseña correcta, falta el segundo factor
+)
+
+// DuracionAcceso devuelve la vigencia del token de acceso (JWT_ACCESO_MINUTOS, 15 min por defecto)
+func DuracionAcceso() time.Duration {
+	minutos, err := strconv.Atoi(os.Getenv("JWT_ACCESO_MINUTOS"))
+	if err != nil || minutos <= 0 {
+		minutos = 15
+	}
+	return time.Duration(minutos) * time.Minute
+}
+
+// DuracionRefresh devuelve la vigencia del refresh token (JWT_REFRESH_DIAS, 30 días por defecto)
+func DuracionRefresh() time.Duration {
+	dias, err := strconv.Atoi(os.Getenv("JWT_REFRESH_DIAS"))
+	if err != nil || dias <= 0 {
+		dias = 30
+	}
+	return time.Duration(dias) * 24 * time.Hour
+}
+
+// GenerarJWT firma un token de acceso de corta duración y devuelve también su
+// identificador (jti), necesario para poder revocarlo antes de que expire.
+// sid es la sesión a la que pertenece: al cerrarla el token deja de ser válido.
+func GenerarJWT(correo string, nombre string, id uint, rol string, sid uint) (string, string, error) {
+	jti := uuid.New().String()
+	tokenString, err := firmar(jwt.MapClaims{
 		"correo": correo,
 		"nombre": nombre,
 		"id":     id,
+		"rol":    rol,
+		"sid":    sid,
+		"tipo":   TipoAcceso,
+		"jti":    jti,
 		"iat":    time.Now().Unix(),
-		"exp":    time.Now().Add(time.Hour * 24).Unix(),
+		"exp":    time.Now().Add(DuracionAcceso()).Unix(),
 	})
-	tokenString, err := token.SignedString(miClave)
-	return tokenString, err
+	return tokenString, jti, err
+}
+
+// GenerarDesafio2FA firma el token intermedio que devuelve el login cuando el usuario
+// tiene 2FA activo. Solo sirve para /seguridad/2fa/verificar y vence en 5 minutos.
+func GenerarDesafio2FA(id uint) (string, error) {
+	return firmar(jwt.MapClaims{
+		"id":   id,
+		"tipo": TipoDesafio,
+		"iat":  time.Now().Unix(),
+		"exp":  time.Now().Add(5 * time.Minute).Unix(),
+	})
+}
+
+// ValidarDesafio2FA valida el token intermedio del 2FA y devuelve el id del usuario
+func ValidarDesafio2FA(tokenString string) (uint, error) {
+	claims, err := ValidarJWT(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	id, ok := claims["id"].(float64)
+	if claims["tipo"] != TipoDesafio || !ok {
+		return 0, errors.New("el token no es un desafío 2FA")
+	}
+	return uint(id), nil
+}
+
+// ValidarJWT verifica la firma (con la clave indicada por el kid) y la expiración
+// del token y devuelve sus claims
+func ValidarJWT(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, llaveVerificacion)
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("token inválido")
+	}
+	return claims, nil
 }
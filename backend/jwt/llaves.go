@@ -0,0 +1,233 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Llave es una clave de firma identificada por su kid
+type Llave struct {
+	Kid     string
+	Metodo  jwt.SigningMethod
+	Privada interface{} // []byte para HMAC, *rsa.PrivateKey o ed25519.PrivateKey; nil si solo verifica
+	Publica interface{} // []byte para HMAC, *rsa.PublicKey o ed25519.PublicKey
+	Hasta   time.Time   // Si no es cero, la clave deja de verificar tokens a partir de esa fecha
+}
+
+// conjuntoLlaves contiene todas las claves que verifican tokens y la que firma los nuevos
+type conjuntoLlaves struct {
+	activa *Llave
+	porKid map[string]*Llave
+	orden  []string
+}
+
+var (
+	cargaLlaves sync.Once
+	llaves      *conjuntoLlaves
+	errorLlaves error
+)
+
+// CargarLlaves lee las claves de firma. Si JWT_LLAVES_DIR apunta a un directorio con
+// claves PEM (<kid>.pem, RSA o Ed25519) se firma con RS256/EdDSA usando la clave
+// JWT_KID_ACTIVO (o la última por nombre) y todas las demás siguen verificando los
+// tokens que firmaron; las claves retiradas pueden guardarse solo con su parte pública.
+// Sin directorio se firma con HS256 y SECRET_JWT.
+func CargarLlaves() error {
+	cargaLlaves.Do(func() {
+		llaves, errorLlaves = leerLlaves()
+	})
+	return errorLlaves
+}
+
+func leerLlaves() (*conjuntoLlaves, error) {
+	conjunto := &conjuntoLlaves{porKid: map[string]*Llave{}}
+	secreto := os.Getenv("SECRET_JWT")
+
+	directorio := os.Getenv("JWT_LLAVES_DIR")
+	if directorio == "" {
+		if secreto == "" {
+			return nil, errors.New("no hay SECRET_JWT ni JWT_LLAVES_DIR configurados")
+		}
+		// La clave HMAC se registra sin kid
+		conjunto.activa = &Llave{Metodo: jwt.SigningMethodHS256, Privada: []byte(secreto), Publica: []byte(secreto)}
+		conjunto.porKid[""] = conjunto.activa
+		return conjunto, nil
+	}
+
+	// Con claves asimétricas los tokens HS256 emitidos antes de migrar solo se aceptan si
+	// se pide explícitamente y hasta una fecha: quien conozca SECRET_JWT podría firmarlos
+	if valor := os.Getenv("JWT_ACEPTAR_HS256_HASTA"); valor != "" {
+		hasta, err := leerFecha(valor)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_ACEPTAR_HS256_HASTA: %v", err)
+		}
+		if secreto == "" {
+			return nil, errors.New("JWT_ACEPTAR_HS256_HASTA requiere SECRET_JWT")
+		}
+		if time.Now().Before(hasta) {
+			conjunto.porKid[""] = &Llave{Metodo: jwt.SigningMethodHS256, Publica: []byte(secreto), Hasta: hasta}
+		}
+	}
+
+	archivos, err := filepath.Glob(filepath.Join(directorio, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(archivos)
+	for _, archivo := range archivos {
+		kid := strings.TrimSuffix(filepath.Base(archivo), ".pem")
+		llave, err := leerLlavePEM(archivo, kid)
+		if err != nil {
+			return nil, fmt.Errorf("clave %s: %v", archivo, err)
+		}
+		conjunto.porKid[kid] = llave
+		conjunto.orden = append(conjunto.orden, kid)
+	}
+	if len(conjunto.orden) == 0 {
+		return nil, fmt.Errorf("no se encontraron claves .pem en %s", directorio)
+	}
+
+	kidActivo := os.Getenv("JWT_KID_ACTIVO")
+	if kidActivo == "" {
+		kidActivo = conjunto.orden[len(conjunto.orden)-1]
+	}
+	activa, ok := conjunto.porKid[kidActivo]
+	if !ok || kidActivo == "" {
+		return nil, fmt.Errorf("la clave activa %q no existe en %s", kidActivo, directorio)
+	}
+	if activa.Privada == nil {
+		return nil, fmt.Errorf("la clave activa %q solo tiene la parte pública", kidActivo)
+	}
+	conjunto.activa = activa
+	return conjunto, nil
+}
+
+// leerLlavePEM lee una clave privada o, para las claves retiradas, solo la pública
+func leerLlavePEM(archivo, kid string) (*Llave, error) {
+	contenido, err := os.ReadFile(archivo)
+	if err != nil {
+		return nil, err
+	}
+	bloque, _ := pem.Decode(contenido)
+	if bloque == nil {
+		return nil, errors.New("el archivo no es PEM")
+	}
+	var clave interface{}
+	switch bloque.Type {
+	case "RSA PRIVATE KEY":
+		clave, err = x509.ParsePKCS1PrivateKey(bloque.Bytes)
+	case "RSA PUBLIC KEY":
+		clave, err = x509.ParsePKCS1PublicKey(bloque.Bytes)
+	case "PUBLIC KEY":
+		clave, err = x509.ParsePKIXPublicKey(bloque.Bytes)
+	default:
+		clave, err = x509.ParsePKCS8PrivateKey(bloque.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch clave := clave.(type) {
+	case *rsa.PrivateKey:
+		return &Llave{Kid: kid, Metodo: jwt.SigningMethodRS256, Privada: clave, Publica: clave.Public()}, nil
+	case ed25519.PrivateKey:
+		return &Llave{Kid: kid, Metodo: jwt.SigningMethodEdDSA, Privada: clave, Publica: clave.Public()}, nil
+	case *rsa.PublicKey:
+		return &Llave{Kid: kid, Metodo: jwt.SigningMethodRS256, Publica: clave}, nil
+	case ed25519.PublicKey:
+		return &Llave{Kid: kid, Metodo: jwt.SigningMethodEdDSA, Publica: clave}, nil
+	}
+	return nil, errors.New("tipo de clave no soportado (use RSA o Ed25519)")
+}
+
+// leerFecha acepta una fecha (2006-01-02, medianoche UTC) o una fecha y hora RFC 3339
+func leerFecha(valor string) (time.Time, error) {
+	if fecha, err := time.Parse("2006-01-02", valor); err == nil {
+		return fecha, nil
+	}
+	return time.Parse(time.RFC3339, valor)
+}
+
+// firmar firma los claims con la clave activa e incluye su kid en la cabecera
+func firmar(claims jwt.MapClaims) (string, error) {
+	if err := CargarLlaves(); err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(llaves.activa.Metodo, claims)
+	if llaves.activa.Kid != "" {
+		token.Header["kid"] = llaves.activa.Kid
+	}
+	return token.SignedString(llaves.activa.Privada)
+}
+
+// llaveVerificacion elige la clave según el kid del token y exige que el algoritmo
+// coincida con el de esa clave (evita la confusión de algoritmos)
+func llaveVerificacion(token *jwt.Token) (interface{}, error) {
+	if err := CargarLlaves(); err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	llave, ok := llaves.porKid[kid]
+	if !ok {
+		return nil, fmt.Errorf("kid desconocido: %q", kid)
+	}
+	if token.Method.Alg() != llave.Metodo.Alg() {
+		return nil, errors.New("método de firma inesperado")
+	}
+	if !llave.Hasta.IsZero() && !time.Now().Before(llave.Hasta) {
+		return nil, fmt.Errorf("la clave %q ya no se acepta", kid)
+	}
+	return llave.Publica, nil
+}
+
+// JWKS devuelve las claves públicas en formato JSON Web Key Set (RFC 7517).
+// Las claves HMAC nunca se publican.
+func JWKS() map[string]interface{} {
+	claves := []map[string]string{}
+	if CargarLlaves() == nil {
+		for _, kid := range llaves.orden {
+			if jwk := aJWK(llaves.porKid[kid]); jwk != nil {
+				claves = append(claves, jwk)
+			}
+		}
+	}
+	return map[string]interface{}{"keys": claves}
+}
+
+func aJWK(llave *Llave) map[string]string {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch publica := llave.Publica.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": llave.Metodo.Alg(),
+			"kid": llave.Kid,
+			"n":   b64(publica.N.Bytes()),
+			"e":   b64(big.NewInt(int64(publica.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"alg": llave.Metodo.Alg(),
+			"kid": llave.Kid,
+			"x":   b64(publica),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// cargarPrueba aplica la configuración y vuelve a leer las claves (se leen una sola vez
+// por proceso). Al terminar la prueba quedan sin cargar para la siguiente.
+func cargarPrueba(t *testing.T, entorno map[string]string) error {
+	t.Helper()
+	for _, variable := range []string{"SECRET_JWT", "JWT_LLAVES_DIR", "JWT_KID_ACTIVO", "JWT_ACEPTAR_HS256_HASTA"} {
+		t.Setenv(variable, entorno[variable])
+	}
+	reiniciar := func() {
+		cargaLlaves, llaves, errorLlaves = sync.Once{}, nil, nil
+	}
+	reiniciar()
+	t.Cleanup(reiniciar)
+	return CargarLlaves()
+}
+
+// guardarPEM escribe el bloque PEM en <directorio>/<kid>.pem
+func guardarPEM(t *testing.T, directorio, kid, tipo string, datos []byte) {
+	t.Helper()
+	contenido := pem.EncodeToMemory(&pem.Block{Type: tipo, Bytes: datos})
+	if err := os.WriteFile(filepath.Join(directorio, kid+".pem"), contenido, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// directorioPrueba crea "a" (RSA) y "b" (Ed25519) con sus claves privadas
+func directorioPrueba(t *testing.T) (string, *rsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+	directorio := t.TempDir()
+	claveRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardarPEM(t, directorio, "a", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(claveRSA))
+	_, claveEd, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(claveEd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardarPEM(t, directorio, "b", "PRIVATE KEY", pkcs8)
+	return directorio, claveRSA, claveEd
+}
+
+// tokenPrueba firma un token de acceso con el método, la clave y el kid indicados
+func tokenPrueba(t *testing.T, metodo jwt.SigningMethod, clave interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(metodo, jwt.MapClaims{"id": 1, "tipo": TipoAcceso, "exp": time.Now().Add(time.Minute).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	firmado, err := token.SignedString(clave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return firmado
+}
+
+func cabecera(t *testing.T, firmado string) map[string]interface{} {
+	t.Helper()
+	token, _, err := jwt.NewParser().ParseUnverified(firmado, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.Header
+}
+
+func TestLlavesHMAC(t *testing.T) {
+	if err := cargarPrueba(t, map[string]string{"SECRET_JWT": "secreto"}); err != nil {
+		t.Fatal(err)
+	}
+	firmado, _, err := GenerarJWT("ana@example.com", "Ana", 1, "autor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := cabecera(t, firmado); h["alg"] != "HS256" || h["kid"] != nil {
+		t.Fatalf("cabecera = %v", h)
+	}
+	if _, err := ValidarJWT(firmado); err != nil {
+		t.Fatalf("ValidarJWT: %v", err)
+	}
+	// Las claves HMAC nunca se publican
+	if claves := JWKS()["keys"].([]map[string]string); len(claves) != 0 {
+		t.Fatalf("JWKS publica la clave HMAC: %v", claves)
+	}
+	if err := cargarPrueba(t, map[string]string{}); err == nil {
+		t.Fatal("se cargaron las claves sin SECRET_JWT ni JWT_LLAVES_DIR")
+	}
+}
+
+func TestLlavesSeleccionKid(t *testing.T) {
+	directorio, claveRSA, _ := directorioPrueba(t)
+
+	// Por defecto firma la última por nombre
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio}); err != nil {
+		t.Fatal(err)
+	}
+	firmado, _, err := GenerarJWT("ana@example.com", "Ana", 1, "autor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := cabecera(t, firmado); h["alg"] != "EdDSA" || h["kid"] != "b" {
+		t.Fatalf("cabecera = %v", h)
+	}
+
+	// JWT_KID_ACTIVO elige otra; los tokens de "b" siguen verificando
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio, "JWT_KID_ACTIVO": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	nuevo, _, err := GenerarJWT("ana@example.com", "Ana", 1, "autor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := cabecera(t, nuevo); h["alg"] != "RS256" || h["kid"] != "a" {
+		t.Fatalf("cabecera = %v", h)
+	}
+	for _, token := range []string{firmado, nuevo} {
+		if _, err := ValidarJWT(token); err != nil {
+			t.Fatalf("ValidarJWT: %v", err)
+		}
+	}
+
+	// Una clave retirada guardada solo con la parte pública verifica pero no puede firmar
+	publica, err := x509.MarshalPKIXPublicKey(&claveRSA.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardarPEM(t, directorio, "a", "PUBLIC KEY", publica)
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio, "JWT_KID_ACTIVO": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidarJWT(nuevo); err != nil {
+		t.Fatalf("token de la clave retirada: %v", err)
+	}
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio, "JWT_KID_ACTIVO": "a"}); err == nil {
+		t.Fatal("se aceptó como activa una clave sin parte privada")
+	}
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio, "JWT_KID_ACTIVO": "c"}); err == nil {
+		t.Fatal("se aceptó una clave activa inexistente")
+	}
+}
+
+func TestLlavesRechazadas(t *testing.T) {
+	directorio, claveRSA, claveEd := directorioPrueba(t)
+	if err := cargarPrueba(t, map[string]string{"SECRET_JWT": "secreto", "JWT_LLAVES_DIR": directorio}); err != nil {
+		t.Fatal(err)
+	}
+	otraRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	casos := []struct {
+		nombre string
+		token  string
+	}{
+		// El kid "b" es EdDSA: un token RS256 con ese kid no se verifica con otra clave
+		{"algoritmo distinto al de la clave", tokenPrueba(t, jwt.SigningMethodRS256, claveRSA, "b")},
+		// Confusión de algoritmos: HS256 con el kid de una clave RSA
+		{"HS256 con un kid asimétrico", tokenPrueba(t, jwt.SigningMethodHS256, []byte("secreto"), "a")},
+		{"kid desconocido", tokenPrueba(t, jwt.SigningMethodEdDSA, claveEd, "c")},
+		{"firma de otra clave", tokenPrueba(t, jwt.SigningMethodRS256, otraRSA, "a")},
+		// Sin JWT_ACEPTAR_HS256_HASTA el secreto compartido ya no sirve
+		{"HS256 sin kid", tokenPrueba(t, jwt.SigningMethodHS256, []byte("secreto"), "")},
+	}
+	for _, caso := range casos {
+		if _, err := ValidarJWT(caso.token); err == nil {
+			t.Errorf("%s: se aceptó el token", caso.nombre)
+		}
+	}
+}
+
+func TestLlavesAceptarHS256Hasta(t *testing.T) {
+	directorio, _, _ := directorioPrueba(t)
+	antiguo := tokenPrueba(t, jwt.SigningMethodHS256, []byte("secreto"), "")
+
+	manana := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	if err := cargarPrueba(t, map[string]string{"SECRET_JWT": "secreto", "JWT_LLAVES_DIR": directorio, "JWT_ACEPTAR_HS256_HASTA": manana}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidarJWT(antiguo); err != nil {
+		t.Fatalf("antes de la fecha: %v", err)
+	}
+	// Los tokens nuevos se siguen firmando con la clave asimétrica
+	nuevo, _, err := GenerarJWT("ana@example.com", "Ana", 1, "autor", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := cabecera(t, nuevo); h["alg"] != "EdDSA" {
+		t.Fatalf("cabecera = %v", h)
+	}
+	// Aunque se siga aceptando, la clave HMAC no se publica
+	for _, clave := range JWKS()["keys"].([]map[string]string) {
+		if clave["kid"] == "" {
+			t.Fatalf("JWKS publica la clave HMAC: %v", clave)
+		}
+	}
+
+	// La clave se descarta al vencer, también si el proceso sigue en marcha
+	llaves.porKid[""].Hasta = time.Now().Add(-time.Second)
+	if _, err := ValidarJWT(antiguo); err == nil {
+		t.Fatal("se aceptó un token HS256 después de la fecha")
+	}
+	if err := cargarPrueba(t, map[string]string{"SECRET_JWT": "secreto", "JWT_LLAVES_DIR": directorio, "JWT_ACEPTAR_HS256_HASTA": "2000-01-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidarJWT(antiguo); err == nil {
+		t.Fatal("se aceptó un token HS256 con la fecha vencida")
+	}
+
+	if err := cargarPrueba(t, map[string]string{"SECRET_JWT": "secreto", "JWT_LLAVES_DIR": directorio, "JWT_ACEPTAR_HS256_HASTA": "mañana"}); err == nil {
+		t.Fatal("se aceptó una fecha inválida")
+	}
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio, "JWT_ACEPTAR_HS256_HASTA": manana}); err == nil {
+		t.Fatal("se aceptó JWT_ACEPTAR_HS256_HASTA sin SECRET_JWT")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	directorio, claveRSA, claveEd := directorioPrueba(t)
+	if err := cargarPrueba(t, map[string]string{"JWT_LLAVES_DIR": directorio}); err != nil {
+		t.Fatal(err)
+	}
+	claves := JWKS()["keys"].([]map[string]string)
+	if len(claves) != 2 {
+		t.Fatalf("JWKS = %v", claves)
+	}
+	rsaJWK, edJWK := claves[0], claves[1]
+	if rsaJWK["kid"] != "a" || rsaJWK["kty"] != "RSA" || rsaJWK["alg"] != "RS256" || rsaJWK["use"] != "sig" || rsaJWK["e"] != "AQAB" {
+		t.Fatalf("clave RSA = %v", rsaJWK)
+	}
+	if n, _ := base64.RawURLEncoding.DecodeString(rsaJWK["n"]); string(n) != string(claveRSA.N.Bytes()) {
+		t.Fatal("el módulo publicado no es el de la clave")
+	}
+	if edJWK["kid"] != "b" || edJWK["kty"] != "OKP" || edJWK["crv"] != "Ed25519" || edJWK["alg"] != "EdDSA" {
+		t.Fatalf("clave Ed25519 = %v", edJWK)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(edJWK["x"]); string(x) != string(claveEd.Public().(ed25519.PublicKey)) {
+		t.Fatal("la clave pública publicada no es la de la clave")
+	}
+	// Ningún dato privado en la salida
+	for _, clave := range claves {
+		for _, campo := range []string{"d", "p", "q", "dp", "dq", "qi"} {
+			if _, ok := clave[campo]; ok {
+				t.Fatalf("JWKS publica el campo privado %q de %s", campo, clave["kid"])
+			}
+		}
+	}
+}
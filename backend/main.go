@@ -2,10 +2,14 @@ package main
 
 import (
 	"backend/database"
+	"backend/intentos"
+	"backend/jwt"
 	"backend/middleware"
 	"backend/models"
 	"backend/rutas"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,9 +28,23 @@ func main() {
 	// Establece conexión con la base de datos MySQL
 	database.Conectar()
 
+	// Carga las claves de firma de los JWT (HS256 con SECRET_JWT o RS256/EdDSA desde JWT_LLAVES_DIR)
+	if err := jwt.CargarLlaves(); err != nil {
+		panic("Error cargando las claves JWT: " + err.Error())
+	}
+
 	// Ejecuta las migraciones automáticas de GORM (crea tablas si no existen)
 	models.Migraciones()
 
+	// Los intentos fallidos de login se guardan en BD para compartirlos entre instancias
+	rutas.AlmacenIntentos = intentos.NuevoAlmacenBaseDatos(database.Database)
+
+	// Tarea en segundo plano que anonimiza las cuentas cuya baja ya venció
+	go rutas.IniciarTareaEliminaciones(time.Hour)
+
+	// Tarea en segundo plano que aplica la retención del registro de auditoría
+	go rutas.IniciarTareaRetencionAuditoria(24 * time.Hour)
+
 	// Configura la carpeta 'public' para servir archivos estáticos (imágenes, etc.)
 	// Accesible en: http://localhost:PORT/public/...
 	router.Static("/public", "./public")
@@ -47,6 +65,9 @@ func main() {
 		})
 	})
 
+	// Claves públicas de firma de los JWT (JSON Web Key Set)
+	router.GET("/.well-known/jwks.json", rutas.Seguridad_jwks)
+
 	// ==================== RUTAS DE EJEMPLO/PRUEBA ====================
 	// Endpoints para probar funcionalidades básicas de la API	// ==================== RUTAS DE EJEMPLO/PRUEBA ====================
 	// Endpoints para probar funcionalidades básicas de la API
@@ -61,23 +82,30 @@ func main() {
 
 	// ==================== RUTAS DE CATEGORÍAS ====================
 	// CRUD completo de categorías de recetas
-	// Rutas protegidas: POST, PUT, DELETE requieren JWT
+	// Rutas protegidas: POST, PUT, DELETE requieren JWT y rol admin o editor
+
+	gestionCategorias := middleware.RequireRole(models.RolAdmin, models.RolEditor)
+	escrituraCategorias := middleware.RequireScope(models.ScopeCategoriasEscritura)
 
-	router.GET(pathh+"categorias", rutas.Categoria_get)                                            // Obtener todas
-	router.GET(pathh+"categorias/:id", rutas.Categoria_getId)                                      // Obtener por ID
-	router.POST(pathh+"categorias", middleware.ValidarJWTMiddleware, rutas.Categoria_post)         // Crear (requiere JWT)
-	router.PUT(pathh+"categorias/:id", middleware.ValidarJWTMiddleware, rutas.Categoria_put)       // Actualizar (requiere JWT)
-	router.DELETE(pathh+"categorias/:id", middleware.ValidarJWTMiddleware, rutas.Categoria_delete) // Eliminar (requiere JWT)
+	router.GET(pathh+"categorias", rutas.Categoria_get)                                                                                    // Obtener todas
+	router.GET(pathh+"categorias/:id", rutas.Categoria_getId)                                                                              // Obtener por ID
+	router.POST(pathh+"categorias", middleware.ValidarJWTMiddleware, escrituraCategorias, gestionCategorias, rutas.Categoria_post)         // Crear (requiere JWT + admin/editor)
+	router.PUT(pathh+"categorias/:id", middleware.ValidarJWTMiddleware, escrituraCategorias, gestionCategorias, rutas.Categoria_put)       // Actualizar (requiere JWT + admin/editor)
+	router.DELETE(pathh+"categorias/:id", middleware.ValidarJWTMiddleware, escrituraCategorias, gestionCategorias, rutas.Categoria_delete) // Eliminar (requiere JWT + admin/editor)
 
 	// ==================== RUTAS DE RECETAS ====================
 	// CRUD completo de recetas de cocina
-	// Rutas protegidas: POST, PUT, DELETE requieren JWT
+	// Rutas protegidas: POST, PUT, DELETE requieren JWT (un author solo gestiona sus propias recetas)
 
-	router.GET(pathh+"recetas", rutas.Receta_get)                                            // Obtener todas las recetas
-	router.GET(pathh+"recetas/:id", rutas.Receta_getId)                                      // Obtener receta por ID
-	router.POST(pathh+"recetas", middleware.ValidarJWTMiddleware, rutas.Receta_post)         // Crear receta (requiere JWT)
-	router.PUT(pathh+"recetas/:id", middleware.ValidarJWTMiddleware, rutas.Receta_put)       // Actualizar receta (requiere JWT)
-	router.DELETE(pathh+"recetas/:id", middleware.ValidarJWTMiddleware, rutas.Receta_delete) // Eliminar receta (requiere JWT)
+	escrituraRecetas := middleware.RequireScope(models.ScopeRecetasEscritura)
+
+	router.GET(pathh+"recetas", rutas.Receta_get)                                                              // Obtener todas las recetas
+	router.GET(pathh+"recetas/:id", rutas.Receta_getId)                                                        // Obtener receta por ID
+	router.GET(pathh+"recetas/:id/escalar", rutas.Receta_escalar)                                              // Ingredientes recalculados para otro número de porciones
+	router.GET(pathh+"recetas/:id/nutricion", rutas.Receta_nutricion)                                          // Nutrientes por porción calculados de los ingredientes
+	router.POST(pathh+"recetas", middleware.ValidarJWTMiddleware, escrituraRecetas, rutas.Receta_post)         // Crear receta (requiere JWT)
+	router.PUT(pathh+"recetas/:id", middleware.ValidarJWTMiddleware, escrituraRecetas, rutas.Receta_put)       // Actualizar receta (requiere JWT)
+	router.DELETE(pathh+"recetas/:id", middleware.ValidarJWTMiddleware, escrituraRecetas, rutas.Receta_delete) // Eliminar receta (requiere JWT)
 
 	// ==================== RUTA DE CONTACTO ====================
 	// Endpoint público para enviar mensajes de contacto
@@ -87,18 +115,84 @@ func main() {
 	// ==================== RUTAS DE SEGURIDAD/AUTENTICACIÓN ====================
 	// Endpoints para registro, verificación y login de usuarios
 
-	router.POST(pathh+"seguridad/registro", rutas.Seguridad_registro)               // Registrar nuevo usuario
-	router.GET(pathh+"seguridad/verificacion/:token", rutas.Seguridad_verificacion) // Verificar cuenta por email
-	router.POST(pathh+"seguridad/login", rutas.Seguridad_login)                     // Iniciar sesión (devuelve JWT)
+	router.POST(pathh+"seguridad/registro", rutas.Seguridad_registro)                           // Registrar nuevo usuario
+	router.GET(pathh+"seguridad/verificacion/:token", rutas.Seguridad_verificacion)             // Verificar cuenta por email
+	router.POST(pathh+"seguridad/reenviar-verificacion", rutas.Seguridad_reenviar_verificacion) // Reenviar el correo de verificación (con límite)
+	router.POST(pathh+"seguridad/login", rutas.Seguridad_login)                                 // Iniciar sesión (devuelve JWT)
+	router.POST(pathh+"seguridad/refresh", rutas.Seguridad_refresh)                             // Renovar JWT con el refresh token (rotación)
+	router.POST(pathh+"seguridad/logout", rutas.Seguridad_logout)                               // Cerrar sesión (revoca la familia del refresh token)
+	router.POST(pathh+"seguridad/olvide-password", rutas.Seguridad_olvide_password)             // Solicitar enlace para restablecer contraseña
+	router.POST(pathh+"seguridad/reset-password", rutas.Seguridad_reset_password)               // Restablecer contraseña con el token recibido
+	router.GET(pathh+"seguridad/politica-password", rutas.Seguridad_politica_password)          // Requisitos de contraseña vigentes (para el frontend)
+
+	// Inicio de sesión sin contraseña con un enlace enviado por correo
+	router.POST(pathh+"seguridad/magic-link", rutas.EnlaceMagico_solicitar)       // Enviar el enlace (máx. 3 por correo por hora)
+	router.POST(pathh+"seguridad/magic-link/canjear", rutas.EnlaceMagico_canjear) // Canjear el token del enlace por el JWT (un solo uso)
+
+	// Passkeys (WebAuthn): registro con la sesión iniciada e inicio de sesión sin contraseña
+	router.POST(pathh+"seguridad/webauthn/registro/opciones", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Webauthn_registro_opciones) // Opciones para navigator.credentials.create (requiere JWT)
+	router.POST(pathh+"seguridad/webauthn/registro", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Webauthn_registro)                   // Guardar la passkey creada (requiere JWT)
+	router.GET(pathh+"seguridad/webauthn/credenciales", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Webauthn_get)                     // Listar mis passkeys
+	router.DELETE(pathh+"seguridad/webauthn/credenciales/:id", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Webauthn_delete)           // Eliminar una passkey
+	router.POST(pathh+"seguridad/webauthn/login/opciones", rutas.Webauthn_login_opciones)                                                                // Opciones para navigator.credentials.get
+	router.POST(pathh+"seguridad/webauthn/login", rutas.Webauthn_login)                                                                                  // Verificar la firma de la passkey y devolver el JWT
+
+	// Verificación en dos pasos (TOTP)
+	router.POST(pathh+"seguridad/2fa/inscribir", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.DosFactores_inscribir)   // Generar secreto y URI otpauth (requiere JWT)
+	router.POST(pathh+"seguridad/2fa/confirmar", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.DosFactores_confirmar)   // Activar con un código, devuelve códigos de recuperación (requiere JWT)
+	router.POST(pathh+"seguridad/2fa/desactivar", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.DosFactores_desactivar) // Desactivar con contraseña y código (requiere JWT)
+	router.POST(pathh+"seguridad/2fa/verificar", rutas.DosFactores_verificar)                                                            // Canjear el desafío del login por el JWT
+
+	// Perfil del usuario autenticado
+	router.GET(pathh+"seguridad/perfil", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_get)               // Ver mi perfil
+	router.PUT(pathh+"seguridad/perfil", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_put)               // Cambiar nombre o correo (el correo nuevo queda pendiente de verificar)
+	router.PUT(pathh+"seguridad/perfil/password", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_password) // Cambiar la contraseña (requiere la actual)
+
+	// Datos personales: exportación y baja de la cuenta con plazo de gracia
+	router.GET(pathh+"seguridad/perfil/exportar", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_exportar)                       // Descargar un ZIP con todos mis datos
+	router.POST(pathh+"seguridad/perfil/eliminar", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_eliminar)                      // Programar la baja (contraseña, sesión reciente o confirmación por correo)
+	router.POST(pathh+"seguridad/perfil/eliminar/cancelar", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Perfil_cancelar_eliminacion) // Cancelar la baja programada
+	router.POST(pathh+"seguridad/perfil/eliminar/confirmar", rutas.Perfil_confirmar_eliminacion)                                                        // Confirmar la baja con el enlace enviado por correo
+
+	// Sesiones abiertas en cada dispositivo
+	router.GET(pathh+"seguridad/sesiones", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Sesion_get)             // Listar mis sesiones activas
+	router.DELETE(pathh+"seguridad/sesiones/:id", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Sesion_delete)   // Cerrar una sesión (otro dispositivo)
+	router.DELETE(pathh+"seguridad/sesiones", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.Sesion_delete_todas) // Cerrar sesión en todos los dispositivos
+
+	// Inicio de sesión con un proveedor OpenID Connect (Authorization Code + PKCE)
+	router.GET(pathh+"seguridad/oidc/login", rutas.Oidc_login)       // Redirige al proveedor configurado
+	router.GET(pathh+"seguridad/oidc/callback", rutas.Oidc_callback) // Vuelta del proveedor: vincula la cuenta y redirige al frontend con la sesión
+
+	// ==================== RUTAS DE LLAVES DE API ====================
+	// Llaves personales para scripts e integraciones (se envían en el header X-API-Key)
+	// Solo se gestionan con el JWT de una sesión
+
+	router.GET(pathh+"llaves-api", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.LlaveApi_get)           // Listar mis llaves
+	router.POST(pathh+"llaves-api", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.LlaveApi_post)         // Crear llave (se muestra una sola vez)
+	router.PUT(pathh+"llaves-api/:id", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.LlaveApi_put)       // Renombrar llave
+	router.DELETE(pathh+"llaves-api/:id", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, rutas.LlaveApi_delete) // Revocar llave
+
+	// ==================== RUTAS DE ADMINISTRACIÓN ====================
+	// Acciones reservadas al rol admin
+
+	soloAdmin := middleware.RequireRole(models.RolAdmin)
+
+	router.GET(pathh+"admin/usuarios", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_usuarios_get)                                 // Listar y buscar usuarios
+	router.PUT(pathh+"admin/usuarios/:id/estado", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_usuario_estado)                    // Activar, suspender o banear
+	router.POST(pathh+"admin/usuarios/:id/cerrar-sesiones", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_usuario_cerrar_sesiones) // Forzar el cierre de sesión
+	router.PUT(pathh+"admin/usuarios/:id/rol", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_usuario_rol)                          // Cambiar el rol de un usuario
+	router.POST(pathh+"admin/usuarios/:id/desbloquear", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_usuario_desbloquear)         // Quitar el bloqueo por intentos fallidos
+	router.GET(pathh+"admin/auditoria", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_auditoria_get)                               // Consultar el registro de auditoría
+	router.POST(pathh+"admin/nutrientes", middleware.ValidarJWTMiddleware, middleware.SinLlaveApi, soloAdmin, rutas.Admin_nutrientes_importar)                       // Importar la tabla de nutrientes (CSV)
 
 	// ==================== RUTAS AUXILIARES (HELPERS) ====================
 	// Endpoints especializados para búsqueda, filtros y operaciones específicas
 
-	router.GET(pathh+"recetas-helpers/usuarios/:id", middleware.ValidarJWTMiddleware, rutas.Receta_Helper_Usuario) // Recetas de un usuario (requiere JWT)
-	router.GET(pathh+"recetas-helpers/home", rutas.Receta_Helper_Home)                                             // Recetas para página principal
-	router.GET(pathh+"recetas-helpers/slug/:slug", rutas.Receta_Helper_Slug)                                       // Obtener receta por slug (URL amigable)
-	router.GET(pathh+"recetas-helpers/buscador", rutas.Receta_Helper_Buscador)                                     // Buscar recetas con filtros
-	router.POST(pathh+"recetas-helpers/foto", rutas.Receta_Helper_Editar_Foto)                                     // Subir foto de receta
+	router.GET(pathh+"recetas-helpers/usuarios/:id", middleware.ValidarJWTMiddleware, middleware.RequireScope(models.ScopeRecetasLectura), rutas.Receta_Helper_Usuario) // Recetas de un usuario (requiere JWT)
+	router.GET(pathh+"recetas-helpers/home", rutas.Receta_Helper_Home)                                                                                                  // Recetas para página principal
+	router.GET(pathh+"recetas-helpers/slug/:slug", rutas.Receta_Helper_Slug)                                                                                            // Obtener receta por slug (URL amigable)
+	router.GET(pathh+"recetas-helpers/buscador", rutas.Receta_Helper_Buscador)                                                                                          // Buscar recetas con filtros
+	router.POST(pathh+"recetas-helpers/foto", middleware.ValidarJWTMiddleware, escrituraRecetas, rutas.Receta_Helper_Editar_Foto)                                       // Subir foto de receta (requiere JWT)
 
 	// ==================== INICIAR SERVIDOR ====================
 	// ==================== INICIAR SERVIDOR ====================
@@ -114,14 +208,23 @@ func main() {
 // pueda hacer peticiones a esta API
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Permite peticiones desde cualquier origen (⚠️ en producción, especificar dominios concretos)
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		// Los orígenes de CORS_ORIGENES pueden enviar cookies (modo cookie); el resto
+		// puede hacer peticiones desde cualquier origen, pero sin credenciales
+		// (⚠️ en producción, especificar dominios concretos)
+		origen := c.GetHeader("Origin")
+		if origenPermitido(origen) {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", origen)
+			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
+			c.Writer.Header().Add("Vary", "Origin")
+		} else {
+			c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
+		}
 
 		// Headers permitidos en las peticiones
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-CSRF-Token")
 
 		// Métodos HTTP permitidos
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
 		// Manejo de peticiones preflight (OPTIONS)
 		// Los navegadores envían OPTIONS antes de peticiones con headers personalizados
@@ -134,3 +237,16 @@ func corsMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// origenPermitido indica si el origen está en CORS_ORIGENES (lista separada por comas)
+func origenPermitido(origen string) bool {
+	if origen == "" {
+		return false
+	}
+	for _, permitido := range strings.Split(os.Getenv("CORS_ORIGENES"), ",") {
+		if strings.TrimSpace(permitido) == origen {
+			return true
+		}
+	}
+	return false
+}
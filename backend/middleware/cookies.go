@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"backend/utilidades"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Modo cookie: el navegador guarda los tokens en cookies HttpOnly (fuera del alcance
+// de JavaScript) y las peticiones que modifican datos deben repetir en el header
+// X-CSRF-Token el valor de la cookie csrf_token (double-submit).
+const (
+	CookieSesion  = "sesion"
+	CookieRefresh = "refresh"
+	CookieCsrf    = "csrf_token"
+	HeaderCsrf    = "X-CSRF-Token"
+	// RutaCookieRefresh limita el envío del refresh token a /seguridad (refresh y logout)
+	RutaCookieRefresh = "/api/v1/seguridad"
+)
+
+// EstablecerCookiesSesion guarda el token de acceso y el refresh token en cookies
+// HttpOnly y devuelve el token CSRF, que se conserva si el navegador ya tenía uno.
+func EstablecerCookiesSesion(c *gin.Context, acceso, refresh string, duracionAcceso, duracionRefresh time.Duration) (string, error) {
+	csrf, _ := c.Cookie(CookieCsrf)
+	if len(csrf) == 0 {
+		nuevo, err := utilidades.GenerarTokenAleatorio(32)
+		if err != nil {
+			return "", err
+		}
+		csrf = nuevo
+	}
+	establecerCookie(c, CookieSesion, acceso, "/", duracionAcceso, true)
+	establecerCookie(c, CookieRefresh, refresh, RutaCookieRefresh, duracionRefresh, true)
+	// El frontend tiene que poder leer el token CSRF para enviarlo en el header
+	establecerCookie(c, CookieCsrf, csrf, "/", duracionRefresh, false)
+	return csrf, nil
+}
+
+// BorrarCookiesSesion elimina las cookies del modo cookie (logout)
+func BorrarCookiesSesion(c *gin.Context) {
+	establecerCookie(c, CookieSesion, "", "/", -1, true)
+	establecerCookie(c, CookieRefresh, "", RutaCookieRefresh, -1, true)
+	establecerCookie(c, CookieCsrf, "", "/", -1, false)
+}
+
+// CsrfValido comprueba el double-submit: el header X-CSRF-Token debe coincidir con la
+// cookie csrf_token. Los métodos que no modifican datos no lo necesitan.
+func CsrfValido(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	cookie, _ := c.Cookie(CookieCsrf)
+	header := c.GetHeader(HeaderCsrf)
+	if len(cookie) == 0 || len(header) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// establecerCookie aplica la configuración común: COOKIE_DOMINIO (vacío = host actual),
+// COOKIE_SECURE (true por defecto) y COOKIE_SAMESITE (Strict, Lax o None; Strict por defecto)
+func establecerCookie(c *gin.Context, nombre, valor, ruta string, duracion time.Duration, httpOnly bool) {
+	secure, err := strconv.ParseBool(os.Getenv("COOKIE_SECURE"))
+	if err != nil {
+		secure = true
+	}
+	sameSite := http.SameSiteStrictMode
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		// SameSite=None solo es aceptado por los navegadores junto a Secure
+		sameSite = http.SameSiteNoneMode
+		secure = true
+	}
+	maxAge := int(duracion.Seconds())
+	if duracion < 0 {
+		maxAge = -1
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(nombre, valor, maxAge, ruta, os.Getenv("COOKIE_DOMINIO"), secure, httpOnly)
+}
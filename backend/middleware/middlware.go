@@ -2,13 +2,14 @@ package middleware
 
 import (
 	"backend/database"
+	"backend/jwt"
 	"backend/models"
+	"backend/utilidades"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/joho/godotenv"
 )
 
@@ -21,10 +22,28 @@ func ValidarJWTMiddleware(c *gin.Context) {
 		})
 		return
 	}
-	// Obtenemos el secret jwt
-	miClave := []byte(os.Getenv("SECRET_JWT"))
 	// Obtenemos el encabezado
 	var haader = c.GetHeader("Authorization")
+	// Los clientes automáticos pueden autenticarse con una llave de API en lugar del JWT
+	if len(haader) == 0 && len(c.GetHeader("X-API-Key")) > 0 {
+		validarLlaveApi(c, strings.TrimSpace(c.GetHeader("X-API-Key")))
+		return
+	}
+	// En modo cookie el token viene en la cookie de sesión y, como el navegador la
+	// envía solo, las peticiones que modifican datos deben traer el token CSRF
+	if len(haader) == 0 {
+		if cookie, err := c.Cookie(CookieSesion); err == nil && len(cookie) > 0 {
+			if !CsrfValido(c) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"estado":         "error",
+					"mensaje":        "No autorizado",
+					"estadoOpcional": "Falta el header " + HeaderCsrf + " o no coincide con la cookie " + CookieCsrf,
+				})
+				return
+			}
+			haader = "Bearer " + cookie
+		}
+	}
 	// Validamos si el header tiene valor
 	if len(haader) == 0 {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
@@ -46,16 +65,7 @@ func ValidarJWTMiddleware(c *gin.Context) {
 	}
 	// Validamos el formato del token
 	tk := strings.TrimSpace(splitBearer[1])
-	token, err := jwt.Parse(tk, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"estado":         "error",
-				"mensaje":        "No autorizado",
-				"estadoOpcional": "Error con la firma del token",
-			})
-		}
-		return miClave, nil
-	})
+	claims, err := jwt.ValidarJWT(tk)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"estado":         "error",
@@ -64,29 +74,187 @@ func ValidarJWTMiddleware(c *gin.Context) {
 		})
 		return
 	}
+	// Solo se aceptan tokens de acceso (no los desafíos intermedios del 2FA)
+	if claims["tipo"] != jwt.TipoAcceso {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "El token no es un token de acceso",
+		})
+		return
+	}
+	// Validamos que el token no haya sido revocado (logout o reutilización de refresh token)
+	jti, _ := claims["jti"].(string)
+	if len(jti) == 0 || TokenRevocado(jti) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "El token fue revocado",
+		})
+		return
+	}
 	// Obtenemos los datos del JWT
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		// preguntamos si existe correo
-		datos := models.Usuario{}
+	// preguntamos si existe correo
+	datos := models.Usuario{}
 
-		result := database.Database.First(&datos, claims["id"])
-		if result.Error != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"estado":         "error",
-				"mensaje":        "No autorizado",
-				"estadoOpcional": "Error con el id del usuario informado en el token",
-			})
-			return
-		}
-		c.Next()
+	result := database.Database.First(&datos, claims["id"])
+	if result.Error != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "Error con el id del usuario informado en el token",
+		})
+		return
+	}
+	// Una cuenta suspendida, baneada o eliminada pierde el acceso aunque su token siga vigente
+	if datos.EstadoID != models.EstadoActivo {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "La cuenta no está activa",
+		})
+		return
+	}
+	// El token debe pertenecer a una sesión del usuario que siga abierta
+	sid, _ := claims["sid"].(float64)
+	if !SesionActiva(uint(sid), datos.ID, c.ClientIP()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "La sesión del token fue cerrada",
+		})
+		return
+	}
+	rol, _ := claims["rol"].(string)
+	c.Set("jti", jti)
+	c.Set("sid", uint(sid))
+	c.Set("usuario", datos)
+	c.Set("rol", rol)
+	c.Next()
+}
 
-	} else {
+// validarLlaveApi autentica la petición con una llave de API vigente y deja en el
+// contexto el usuario dueño de la llave y sus scopes
+func validarLlaveApi(c *gin.Context, llave string) {
+	llaves := models.LlavesApi{}
+	database.Database.Where("llave_hash = ? AND revocada_en IS NULL", utilidades.HashToken(llave)).Limit(1).Find(&llaves)
+	if len(llaves) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"estado":         "error",
+			"mensaje":        "No autorizado",
+			"estadoOpcional": "La llave de API no es válida o fue revocada",
+		})
+		return
+	}
+	datos := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&datos, llaves[0].UsuarioID).Error; err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 			"estado":         "error",
 			"mensaje":        "No autorizado",
-			"estadoOpcional": "Error tratando de leer los datos",
+			"estadoOpcional": "El dueño de la llave de API no existe o no está activo",
 		})
 		return
 	}
+	// Registramos el último uso como mucho una vez por minuto para no escribir en cada petición
+	ahora := time.Now()
+	database.Database.Model(&models.LlaveApi{}).
+		Where("id = ? AND (ultimo_uso IS NULL OR ultimo_uso < ?)", llaves[0].ID, ahora.Add(-time.Minute)).
+		Update("ultimo_uso", ahora)
+
+	c.Set("llave_api", llaves[0])
+	c.Set("usuario", datos)
+	c.Set("rol", datos.Rol)
+	c.Next()
+}
+
+// UsuarioActual devuelve el usuario autenticado que ValidarJWTMiddleware dejó en el contexto
+func UsuarioActual(c *gin.Context) (models.Usuario, bool) {
+	valor, existe := c.Get("usuario")
+	if !existe {
+		return models.Usuario{}, false
+	}
+	usuario, ok := valor.(models.Usuario)
+	return usuario, ok
+}
+
+// RequireRole permite continuar solo si el rol del token es uno de los indicados.
+// Debe usarse después de ValidarJWTMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rol := c.GetString("rol")
+		for _, permitido := range roles {
+			if rol == permitido {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"estado":         "error",
+			"mensaje":        "No tiene permisos para realizar esta acción",
+			"estadoOpcional": "Rol requerido: " + strings.Join(roles, ", "),
+		})
+	}
+}
+
+// RequireScope exige que una petición autenticada con llave de API tenga el scope
+// indicado. Las peticiones con JWT no se limitan. Debe usarse después de ValidarJWTMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		valor, existe := c.Get("llave_api")
+		if !existe {
+			c.Next()
+			return
+		}
+		llave, _ := valor.(models.LlaveApi)
+		for _, concedido := range strings.Split(llave.Scopes, ",") {
+			if concedido == scope {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"estado":         "error",
+			"mensaje":        "No tiene permisos para realizar esta acción",
+			"estadoOpcional": "Scope requerido en la llave de API: " + scope,
+		})
+	}
+}
+
+// SinLlaveApi rechaza las llaves de API en las rutas que gestionan la cuenta
+// (2FA, llaves, administración): solo se permiten con el JWT de una sesión.
+func SinLlaveApi(c *gin.Context) {
+	if _, existe := c.Get("llave_api"); existe {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"estado":         "error",
+			"mensaje":        "No tiene permisos para realizar esta acción",
+			"estadoOpcional": "Esta acción requiere iniciar sesión, no admite llaves de API",
+		})
+		return
+	}
+	c.Next()
+}
+
+// SesionActiva indica si la sesión existe, es del usuario y no fue cerrada. De paso
+// registra el último uso y la IP, como mucho una vez por minuto.
+func SesionActiva(sid uint, usuarioID uint, ip string) bool {
+	if sid == 0 {
+		return false
+	}
+	sesiones := models.Sesiones{}
+	database.Database.Where("id = ? AND usuario_id = ? AND finalizada_en IS NULL", sid, usuarioID).Limit(1).Find(&sesiones)
+	if len(sesiones) == 0 {
+		return false
+	}
+	ahora := time.Now()
+	if ahora.Sub(sesiones[0].UltimoUso) > time.Minute {
+		database.Database.Model(&sesiones[0]).Updates(map[string]interface{}{"ultimo_uso": ahora, "ip": ip})
+	}
+	return true
+}
 
+// TokenRevocado indica si el jti de un token de acceso está en la lista de revocados
+func TokenRevocado(jti string) bool {
+	revocados := models.TokensRevocados{}
+	database.Database.Where(&models.TokenRevocado{Jti: jti}).Limit(1).Find(&revocados)
+	return len(revocados) > 0
 }
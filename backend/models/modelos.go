@@ -1,8 +1,12 @@
 package models
 
 import (
+	"backend/cocina"
 	"backend/database"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -20,24 +24,169 @@ type Categoria struct {
 type Categorias []Categoria
 
 type Receta struct {
-	ID          uint           `json:"id"`
-	CategoriaID uint           `json:"categoria_id"`
-	UsuarioID   uint           `json:"usuario_id"`
-	Usuario     *Usuario       `gorm:"foreignKey:UsuarioID;references:ID" json:"usuario"`
-	Categoria   *Categoria     `gorm:"foreignKey:CategoriaID;references:ID" json:"categoria"`
-	Nombre      string         `gorm:"type:varchar(100);not null" json:"nombre"`
-	Slug        string         `gorm:"type:varchar(100);not null" json:"slug"`
-	Tiempo      string         `gorm:"type:varchar(100);not null" json:"tiempo"`
-	Foto        string         `gorm:"type:varchar(100);not null" json:"foto"`
-	Descripcion string         `json:"descripcion"`
-	Fecha       time.Time      `json:"fecha"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID          uint       `json:"id"`
+	CategoriaID uint       `json:"categoria_id"`
+	UsuarioID   uint       `json:"usuario_id"`
+	Usuario     *Usuario   `gorm:"foreignKey:UsuarioID;references:ID" json:"usuario"`
+	Categoria   *Categoria `gorm:"foreignKey:CategoriaID;references:ID" json:"categoria"`
+	Nombre      string     `gorm:"type:varchar(100);not null" json:"nombre"`
+	Slug        string     `gorm:"type:varchar(100);not null" json:"slug"`
+	Tiempo      string     `gorm:"type:varchar(100);not null" json:"tiempo"`
+	Foto        string     `gorm:"type:varchar(100);not null" json:"foto"`
+	Descripcion string     `json:"descripcion"`
+	// Porciones que rinde la receta (0 si el autor no lo indicó); permite escalarla
+	Porciones int `gorm:"not null;default:0" json:"porciones"`
+	// Tiempos en minutos (0 si no se indicó). TiempoTotal es su suma y se guarda
+	// para poder filtrar y ordenar; Tiempo es el mismo total escrito ("1 h 30 min")
+	TiempoPreparacion int `gorm:"not null;default:0" json:"tiempo_preparacion"`
+	TiempoCoccion     int `gorm:"not null;default:0" json:"tiempo_coccion"`
+	TiempoReposo      int `gorm:"not null;default:0" json:"tiempo_reposo"`
+	TiempoTotal       int `gorm:"not null;default:0;index" json:"tiempo_total"`
+	// Lista de ingredientes y pasos de preparación, en el orden en que se muestran
+	Ingredientes Ingredientes   `gorm:"foreignKey:RecetaID" json:"ingredientes"`
+	Pasos        Pasos          `gorm:"foreignKey:RecetaID" json:"pasos"`
+	Fecha        time.Time      `json:"fecha"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
 
 type Recetas []Receta
 
+// Alimento es una fila de la tabla de referencia de nutrientes, con los valores por
+// 100 g. Se carga desde datos/nutrientes.csv y se puede reemplazar con POST /admin/nutrientes.
+type Alimento struct {
+	ID     uint   `json:"id"`
+	Nombre string `gorm:"type:varchar(100);not null;uniqueIndex" json:"nombre"`
+	// Otros nombres con los que aparece en las recetas, separados por |
+	Alias         string    `gorm:"type:varchar(500);not null;default:''" json:"alias"`
+	Calorias      float64   `gorm:"not null;default:0" json:"calorias"`
+	Proteinas     float64   `gorm:"not null;default:0" json:"proteinas"`
+	Grasas        float64   `gorm:"not null;default:0" json:"grasas"`
+	Carbohidratos float64   `gorm:"not null;default:0" json:"carbohidratos"`
+	Fibra         float64   `gorm:"not null;default:0" json:"fibra"`
+	Sodio         float64   `gorm:"not null;default:0" json:"sodio"` // mg
+	Densidad      float64   `gorm:"not null;default:0" json:"densidad"`
+	GramosUnidad  float64   `gorm:"not null;default:0" json:"gramos_unidad"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type Alimentos []Alimento
+
+// NutricionReceta guarda los nutrientes calculados de una receta (la suma de todos sus
+// ingredientes) para no recalcularlos en cada consulta. Se recalcula al cambiar los
+// ingredientes o al importar la tabla de nutrientes.
+type NutricionReceta struct {
+	ID            uint    `json:"id"`
+	RecetaID      uint    `gorm:"not null;uniqueIndex" json:"receta_id"`
+	Calorias      float64 `gorm:"not null;default:0" json:"calorias"`
+	Proteinas     float64 `gorm:"not null;default:0" json:"proteinas"`
+	Grasas        float64 `gorm:"not null;default:0" json:"grasas"`
+	Carbohidratos float64 `gorm:"not null;default:0" json:"carbohidratos"`
+	Fibra         float64 `gorm:"not null;default:0" json:"fibra"`
+	Sodio         float64 `gorm:"not null;default:0" json:"sodio"`
+	// Ingredientes que no se pudieron calcular (sin cantidad, sin alimento en la tabla...)
+	SinCalcular int `gorm:"not null;default:0" json:"sin_calcular"`
+	// Resultado por ingrediente en JSON
+	Detalle     string    `gorm:"type:text" json:"detalle"`
+	CalculadoEn time.Time `json:"calculado_en"`
+}
+
+type NutricionesReceta []NutricionReceta
+
+// AlimentoDesdeCocina convierte una fila leída del CSV en el modelo
+func AlimentoDesdeCocina(a cocina.Alimento) Alimento {
+	return Alimento{
+		Nombre:        a.Nombre,
+		Alias:         strings.Join(a.Alias, "|"),
+		Calorias:      a.Por100g.Calorias,
+		Proteinas:     a.Por100g.Proteinas,
+		Grasas:        a.Por100g.Grasas,
+		Carbohidratos: a.Por100g.Carbohidratos,
+		Fibra:         a.Por100g.Fibra,
+		Sodio:         a.Por100g.Sodio,
+		Densidad:      a.Densidad,
+		GramosUnidad:  a.GramosUnidad,
+	}
+}
+
+// Cocina convierte el modelo en el alimento que usa el cálculo
+func (a Alimento) Cocina() cocina.Alimento {
+	alimento := cocina.Alimento{
+		Nombre: a.Nombre,
+		Por100g: cocina.Nutrientes{
+			Calorias:      a.Calorias,
+			Proteinas:     a.Proteinas,
+			Grasas:        a.Grasas,
+			Carbohidratos: a.Carbohidratos,
+			Fibra:         a.Fibra,
+			Sodio:         a.Sodio,
+		},
+		Densidad:     a.Densidad,
+		GramosUnidad: a.GramosUnidad,
+	}
+	if a.Alias != "" {
+		alimento.Alias = strings.Split(a.Alias, "|")
+	}
+	return alimento
+}
+
+// ImportarAlimentos crea o actualiza (por nombre) los alimentos de la tabla de nutrientes
+func ImportarAlimentos(tx *gorm.DB, alimentos []cocina.Alimento) error {
+	for _, a := range alimentos {
+		fila := AlimentoDesdeCocina(a)
+		err := tx.Where(Alimento{Nombre: fila.Nombre}).
+			Assign(map[string]interface{}{
+				"alias": fila.Alias, "calorias": fila.Calorias, "proteinas": fila.Proteinas, "grasas": fila.Grasas,
+				"carbohidratos": fila.Carbohidratos, "fibra": fila.Fibra, "sodio": fila.Sodio,
+				"densidad": fila.Densidad, "gramos_unidad": fila.GramosUnidad,
+			}).
+			FirstOrCreate(&fila).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CargarTablaNutrientes lee de la base de datos la tabla de nutrientes para calcular recetas
+func CargarTablaNutrientes(tx *gorm.DB) (cocina.TablaNutrientes, error) {
+	filas := Alimentos{}
+	if err := tx.Find(&filas).Error; err != nil {
+		return cocina.TablaNutrientes{}, err
+	}
+	alimentos := make([]cocina.Alimento, 0, len(filas))
+	for _, fila := range filas {
+		alimentos = append(alimentos, fila.Cocina())
+	}
+	return cocina.NuevaTablaNutrientes(alimentos), nil
+}
+
+// Ingrediente es una línea de la lista de ingredientes. La cantidad se guarda tal
+// como la escribe el autor ("1 1/2", "200", "una pizca") y puede ir vacía.
+type Ingrediente struct {
+	ID       uint   `json:"id"`
+	RecetaID uint   `gorm:"index;not null" json:"receta_id"`
+	Orden    int    `gorm:"not null" json:"orden"`
+	Cantidad string `gorm:"type:varchar(30)" json:"cantidad"`
+	Unidad   string `gorm:"type:varchar(30)" json:"unidad"`
+	Nombre   string `gorm:"type:varchar(100);not null" json:"nombre"`
+	Nota     string `gorm:"type:varchar(255)" json:"nota"`
+	// Grupo agrupa ingredientes dentro de la receta, por ejemplo "para la salsa"
+	Grupo string `gorm:"type:varchar(100)" json:"grupo"`
+}
+type Ingredientes []Ingrediente
+
+// Paso es una instrucción numerada de la preparación
+type Paso struct {
+	ID       uint   `json:"id"`
+	RecetaID uint   `gorm:"index;not null" json:"receta_id"`
+	Numero   int    `gorm:"not null" json:"numero"`
+	Texto    string `gorm:"type:varchar(1000);not null" json:"texto"`
+}
+type Pasos []Paso
+
 type Contacto struct {
 	Id       uint      `json:"id"`
 	Nombre   string    `gorm:"type:varchar(100)" json:"nombre"`
@@ -55,17 +204,372 @@ type Estado struct {
 }
 type Estados []Estado
 
+// Roles de usuario
+const (
+	RolAdmin  = "admin"  // Gestiona usuarios, categorías y todas las recetas
+	RolEditor = "editor" // Gestiona categorías y todas las recetas
+	RolAutor  = "author" // Solo gestiona sus propias recetas
+)
+
+// Estados del ciclo de vida de una cuenta (ids de la tabla estados)
+const (
+	EstadoActivo     uint = 1 // Puede iniciar sesión y usar la API
+	EstadoPendiente  uint = 2 // Registrada, falta verificar el correo (antes "Inactivo")
+	EstadoEliminado  uint = 3 // Anonimizada tras la baja; no admite más cambios
+	EstadoSuspendido uint = 4 // Bloqueada temporalmente por un administrador
+	EstadoBaneado    uint = 5 // Bloqueada de forma permanente por un administrador
+)
+
+// NombresEstado son los nombres con que se crean los estados en la base de datos
+var NombresEstado = map[uint]string{
+	EstadoActivo:     "Activo",
+	EstadoPendiente:  "Pendiente",
+	EstadoEliminado:  "Eliminado",
+	EstadoSuspendido: "Suspendido",
+	EstadoBaneado:    "Baneado",
+}
+
+// TransicionesEstado indica a qué estados puede pasar una cuenta desde cada estado por
+// un cambio manual. Eliminado no es destino de ninguno: la baja solo la aplica la
+// anonimización, y una cuenta eliminada ya no admite cambios.
+var TransicionesEstado = map[uint][]uint{
+	EstadoPendiente:  {EstadoActivo, EstadoBaneado},
+	EstadoActivo:     {EstadoSuspendido, EstadoBaneado},
+	EstadoSuspendido: {EstadoActivo, EstadoBaneado},
+	EstadoBaneado:    {EstadoActivo},
+}
+
+// TransicionValida indica si una cuenta puede pasar del estado desde al estado hacia
+func TransicionValida(desde, hacia uint) bool {
+	for _, permitido := range TransicionesEstado[desde] {
+		if permitido == hacia {
+			return true
+		}
+	}
+	return false
+}
+
 type Usuario struct {
+	ID       uint    `json:"id"`
+	EstadoID uint    `json:"estado_id"`
+	Estado   *Estado `gorm:"foreignKey:EstadoID;references:ID" json:"estado"`
+	Nombre   string  `gorm:"type:varchar(100);not null" json:"nombre"`
+	Correo   string  `gorm:"type:varchar(100);not null" json:"correo"`
+	Password string  `gorm:"type:varchar(255);not null" json:"password"`
+	Token    string  `gorm:"type:varchar(100);not null" json:"token"`
+	Rol      string  `gorm:"type:varchar(20);not null;default:author" json:"rol"`
+	// TokenExpira es el vencimiento del token de verificación (nulo en registros antiguos)
+	TokenExpira *time.Time `json:"token_expira"`
+	// CorreoPendiente es el correo nuevo que espera confirmación con el enlace de verificación
+	CorreoPendiente string `gorm:"type:varchar(100)" json:"correo_pendiente"`
+	// EliminacionProgramada es la fecha en que se anonimizará la cuenta (nula si no pidió la baja)
+	EliminacionProgramada *time.Time `json:"eliminacion_programada"`
+	// Segundo factor (TOTP). El secreto queda pendiente hasta que se confirma con un código.
+	TotpSecreto    string `gorm:"type:varchar(64)" json:"-"`
+	TotpActivo     bool   `gorm:"not null;default:false" json:"totp_activo"`
+	TotpUltimoPaso int64  `json:"-"`
+	// Motivo y fecha del último cambio de estado hecho por un administrador
+	MotivoEstado     string     `gorm:"type:varchar(255)" json:"motivo_estado"`
+	EstadoCambiadoEn *time.Time `json:"estado_cambiado_en"`
+	Fecha            time.Time  `json:"fecha"`
+}
+type Usuarios []Usuario
+
+// RolValido indica si el rol es uno de los roles soportados
+func RolValido(rol string) bool {
+	return rol == RolAdmin || rol == RolEditor || rol == RolAutor
+}
+
+// RefreshToken guarda el hash de cada refresh token emitido. Todos los tokens
+// obtenidos a partir de un mismo login comparten la misma Familia.
+type RefreshToken struct {
+	ID         uint       `json:"id"`
+	UsuarioID  uint       `gorm:"index;not null" json:"usuario_id"`
+	Familia    string     `gorm:"type:varchar(36);index;not null" json:"familia"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	AccesoJti  string     `gorm:"type:varchar(36)" json:"-"`
+	ExpiraEn   time.Time  `json:"expira_en"`
+	UsadoEn    *time.Time `json:"usado_en"`
+	RevocadoEn *time.Time `json:"revocado_en"`
+	Fecha      time.Time  `json:"fecha"`
+}
+type RefreshTokens []RefreshToken
+
+// TokenRevocado es la lista de jti de tokens de acceso invalidados antes de expirar
+type TokenRevocado struct {
 	ID       uint      `json:"id"`
-	EstadoID uint      `json:"estado_id"`
-	Estado   *Estado   `gorm:"foreignKey:EstadoID;references:ID" json:"estado"`
-	Nombre   string    `gorm:"type:varchar(100);not null" json:"nombre"`
-	Correo   string    `gorm:"type:varchar(100);not null" json:"correo"`
-	Password string    `gorm:"type:varchar(100);not null" json:"password"`
-	Token    string    `gorm:"type:varchar(100);not null" json:"token"`
+	Jti      string    `gorm:"type:varchar(36);uniqueIndex;not null" json:"jti"`
+	ExpiraEn time.Time `gorm:"index" json:"expira_en"`
 	Fecha    time.Time `json:"fecha"`
 }
-type Usuarios []Usuario
+type TokensRevocados []TokenRevocado
+
+// RecuperacionPassword es un token de un solo uso para restablecer la contraseña.
+// Solo se guarda el hash del token enviado por correo.
+type RecuperacionPassword struct {
+	ID        uint       `json:"id"`
+	UsuarioID uint       `gorm:"index;not null" json:"usuario_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiraEn  time.Time  `json:"expira_en"`
+	UsadoEn   *time.Time `json:"usado_en"`
+	Fecha     time.Time  `json:"fecha"`
+}
+type RecuperacionesPassword []RecuperacionPassword
+
+// ConfirmacionBaja es un enlace de un solo uso enviado por correo para confirmar la baja
+// de la cuenta sin contraseña (cuentas creadas con OIDC, passkeys o enlaces mágicos).
+type ConfirmacionBaja struct {
+	ID        uint       `json:"id"`
+	UsuarioID uint       `gorm:"index;not null" json:"usuario_id"`
+	TokenHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	ExpiraEn  time.Time  `json:"expira_en"`
+	UsadoEn   *time.Time `json:"usado_en"`
+	Fecha     time.Time  `json:"fecha"`
+}
+type ConfirmacionesBaja []ConfirmacionBaja
+
+// EnlaceMagico es un enlace de inicio de sesión sin contraseña enviado por correo.
+// NavegadorHash liga el enlace a la cookie del navegador que lo pidió (vacío si no la hubo).
+type EnlaceMagico struct {
+	ID            uint       `json:"id"`
+	UsuarioID     uint       `gorm:"index;not null" json:"usuario_id"`
+	TokenHash     string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	NavegadorHash string     `gorm:"type:varchar(64)" json:"-"`
+	IP            string     `gorm:"type:varchar(45)" json:"ip"`
+	ExpiraEn      time.Time  `json:"expira_en"`
+	UsadoEn       *time.Time `json:"usado_en"`
+	Fecha         time.Time  `json:"fecha"`
+}
+type EnlacesMagicos []EnlaceMagico
+
+// CredencialWebauthn es una passkey registrada por el usuario (puede tener varias).
+// El id de la credencial puede medir hasta 1023 bytes, por eso se indexa su hash.
+type CredencialWebauthn struct {
+	ID             uint       `json:"id"`
+	UsuarioID      uint       `gorm:"index;not null" json:"usuario_id"`
+	Nombre         string     `gorm:"type:varchar(100)" json:"nombre"`
+	CredencialHash string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	CredencialID   string     `gorm:"type:text;not null" json:"credencial_id"` // base64url
+	ClavePublica   []byte     `gorm:"type:blob;not null" json:"-"`             // Clave COSE
+	Algoritmo      int        `json:"algoritmo"`
+	Contador       uint32     `json:"-"`
+	Respaldada     bool       `json:"respaldada"` // Passkey sincronizada entre dispositivos
+	UltimoUso      *time.Time `json:"ultimo_uso"`
+	Fecha          time.Time  `json:"fecha"`
+}
+type CredencialesWebauthn []CredencialWebauthn
+
+// DesafioWebauthn es una ceremonia de WebAuthn pendiente. En un inicio de sesión sin
+// correo UsuarioID es 0 (passkey detectable).
+type DesafioWebauthn struct {
+	ID          uint      `json:"id"`
+	UsuarioID   uint      `gorm:"index" json:"usuario_id"`
+	DesafioHash string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Tipo        string    `gorm:"type:varchar(10);not null" json:"tipo"` // registro o login
+	ExpiraEn    time.Time `gorm:"index" json:"expira_en"`
+}
+type DesafiosWebauthn []DesafioWebauthn
+
+// IntentoLogin cuenta los fallos de login por clave ("correo:..." o "ip:...")
+type IntentoLogin struct {
+	ID             uint       `json:"id"`
+	Clave          string     `gorm:"type:varchar(150);uniqueIndex;not null" json:"clave"`
+	Fallos         int        `gorm:"not null;default:0" json:"fallos"`
+	UltimoFallo    *time.Time `json:"ultimo_fallo"`
+	BloqueadoHasta *time.Time `json:"bloqueado_hasta"`
+}
+type IntentosLogin []IntentoLogin
+
+// CodigoRecuperacion es un código de un solo uso para entrar si se pierde la app de 2FA
+type CodigoRecuperacion struct {
+	ID         uint       `json:"id"`
+	UsuarioID  uint       `gorm:"index;not null" json:"usuario_id"`
+	CodigoHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsadoEn    *time.Time `json:"usado_en"`
+	Fecha      time.Time  `json:"fecha"`
+}
+type CodigosRecuperacion []CodigoRecuperacion
+
+// IdentidadExterna vincula un usuario con su cuenta en un proveedor OpenID Connect
+type IdentidadExterna struct {
+	ID        uint      `json:"id"`
+	UsuarioID uint      `gorm:"index;not null" json:"usuario_id"`
+	Emisor    string    `gorm:"type:varchar(191);uniqueIndex:idx_emisor_sujeto;not null" json:"emisor"`
+	Sujeto    string    `gorm:"type:varchar(191);uniqueIndex:idx_emisor_sujeto;not null" json:"sujeto"`
+	Correo    string    `gorm:"type:varchar(100)" json:"correo"`
+	Fecha     time.Time `json:"fecha"`
+}
+type IdentidadesExternas []IdentidadExterna
+
+// SolicitudOidc guarda el state, nonce y code_verifier de un login OIDC en curso
+type SolicitudOidc struct {
+	ID          uint      `json:"id"`
+	EstadoHash  string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Nonce       string    `gorm:"type:varchar(100);not null" json:"-"`
+	Verificador string    `gorm:"type:varchar(100);not null" json:"-"`
+	ExpiraEn    time.Time `gorm:"index" json:"expira_en"`
+}
+type SolicitudesOidc []SolicitudOidc
+
+// Scopes que se pueden conceder a una llave de API
+const (
+	ScopeRecetasLectura      = "recetas:read"     // Consultar las recetas propias
+	ScopeRecetasEscritura    = "recetas:write"    // Crear, editar y eliminar recetas (y sus fotos)
+	ScopeCategoriasEscritura = "categorias:write" // Gestionar categorías (si el rol lo permite)
+)
+
+// ScopeValido indica si el scope es uno de los soportados
+func ScopeValido(scope string) bool {
+	return scope == ScopeRecetasLectura || scope == ScopeRecetasEscritura || scope == ScopeCategoriasEscritura
+}
+
+// LlaveApi es una llave personal para clientes automáticos (scripts, integraciones).
+// Solo se guarda el hash; el Prefijo permite reconocerla en el listado.
+type LlaveApi struct {
+	ID         uint       `json:"id"`
+	UsuarioID  uint       `gorm:"index;not null" json:"usuario_id"`
+	Nombre     string     `gorm:"type:varchar(100);not null" json:"nombre"`
+	Prefijo    string     `gorm:"type:varchar(12);not null" json:"prefijo"`
+	LlaveHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"scopes"` // Separados por coma
+	UltimoUso  *time.Time `json:"ultimo_uso"`
+	RevocadaEn *time.Time `json:"revocada_en"`
+	Fecha      time.Time  `json:"fecha"`
+}
+type LlavesApi []LlaveApi
+
+// Sesion representa un login en un dispositivo. Agrupa la familia de refresh tokens
+// de ese login y los tokens de acceso la referencian con el claim "sid".
+type Sesion struct {
+	ID           uint       `json:"id"`
+	UsuarioID    uint       `gorm:"index;not null" json:"usuario_id"`
+	Familia      string     `gorm:"type:varchar(36);uniqueIndex;not null" json:"-"`
+	Dispositivo  string     `gorm:"type:varchar(255)" json:"dispositivo"` // User-Agent del login
+	IP           string     `gorm:"type:varchar(45)" json:"ip"`           // Última IP conocida
+	UltimoUso    time.Time  `json:"ultimo_uso"`
+	ExpiraEn     time.Time  `gorm:"index" json:"expira_en"` // Vencimiento del último refresh token
+	FinalizadaEn *time.Time `json:"finalizada_en"`
+	Fecha        time.Time  `json:"fecha"`
+}
+type Sesiones []Sesion
+
+// Acciones registradas en la auditoría
+const (
+	AccionLogin                 = "login"
+	AccionLogin2FA              = "login_2fa"
+	AccionLoginOidc             = "login_oidc"
+	AccionCuentaReclamadaOidc   = "cuenta_reclamada_oidc"
+	AccionLoginEnlaceMagico     = "login_enlace_magico"
+	AccionLoginWebauthn         = "login_webauthn"
+	AccionWebauthnRegistrar     = "webauthn_registrar"
+	AccionWebauthnEliminar      = "webauthn_eliminar"
+	AccionRefreshReutilizado    = "refresh_reutilizado"
+	AccionVerificacion          = "verificacion"
+	AccionResetPassword         = "reset_password"
+	AccionCambioPassword        = "cambio_password"
+	AccionCambioCorreo          = "cambio_correo"
+	Accion2FAActivar            = "2fa_activar"
+	Accion2FADesactivar         = "2fa_desactivar"
+	AccionSesionCerrar          = "sesion_cerrar"
+	AccionLlaveApiCrear         = "llave_api_crear"
+	AccionLlaveApiRevocar       = "llave_api_revocar"
+	AccionCuentaBaja            = "cuenta_baja"
+	AccionCuentaEliminar        = "cuenta_eliminar"
+	AccionCategoriaCrear        = "categoria_crear"
+	AccionCategoriaEditar       = "categoria_editar"
+	AccionCategoriaEliminar     = "categoria_eliminar"
+	AccionRecetaEliminar        = "receta_eliminar"
+	AccionUsuarioRol            = "usuario_rol"
+	AccionUsuarioDesbloquear    = "usuario_desbloquear"
+	AccionUsuarioEstado         = "usuario_estado"
+	AccionUsuarioCerrarSesiones = "usuario_cerrar_sesiones"
+	AccionNutrientesImportar    = "nutrientes_importar"
+)
+
+// Resultados de un evento de auditoría
+const (
+	ResultadoExito    = "exito"
+	ResultadoFallo    = "fallo"
+	ResultadoDenegado = "denegado" // Bloqueos por intentos o falta de permisos
+)
+
+// ErrAuditoriaSoloLectura se devuelve al intentar modificar o borrar un evento de auditoría
+var ErrAuditoriaSoloLectura = errors.New("los eventos de auditoría no se pueden modificar ni borrar")
+
+// EventoAuditoria registra una acción de seguridad o administración. La tabla es de solo
+// agregado: los hooks impiden actualizar o borrar filas (salvo la purga por retención).
+type EventoAuditoria struct {
+	ID            uint      `json:"id"`
+	ActorID       *uint     `gorm:"index" json:"actor_id"`                 // Usuario que hizo la acción (nulo si no se identificó)
+	ActorCorreo   string    `gorm:"type:varchar(100)" json:"actor_correo"` // Correo del actor o el intentado en un login fallido
+	Accion        string    `gorm:"type:varchar(50);index;not null" json:"accion"`
+	Objetivo      string    `gorm:"type:varchar(150)" json:"objetivo"` // Recurso afectado, por ejemplo "categoria:3"
+	Resultado     string    `gorm:"type:varchar(20);not null" json:"resultado"`
+	Detalle       string    `gorm:"type:varchar(255)" json:"detalle"`
+	IP            string    `gorm:"type:varchar(45)" json:"ip"`
+	AgenteUsuario string    `gorm:"type:varchar(255)" json:"agente_usuario"`
+	Fecha         time.Time `gorm:"index" json:"fecha"`
+}
+type EventosAuditoria []EventoAuditoria
+
+func (EventoAuditoria) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditoriaSoloLectura
+}
+
+func (EventoAuditoria) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditoriaSoloLectura
+}
+
+// PurgarAuditoria borra los eventos anteriores a la fecha indicada (política de retención).
+// Es la única vía de borrado: omite los hooks que protegen la tabla.
+func PurgarAuditoria(antes time.Time) (int64, error) {
+	result := database.Database.Session(&gorm.Session{SkipHooks: true}).
+		Where("fecha < ?", antes).Delete(&EventoAuditoria{})
+	return result.RowsAffected, result.Error
+}
+
+// migrarTiemposRecetas interpreta el campo Tiempo de las recetas que aún no tienen
+// tiempos en minutos y lo guarda como tiempo de preparación (el texto no distingue
+// preparación de cocción). Las que no se entienden ("toda la noche") quedan en 0.
+func migrarTiemposRecetas() (int, int, error) {
+	recetas := Recetas{}
+	err := database.Database.Unscoped().Select("id", "tiempo").
+		Where("tiempo_total = 0 AND tiempo <> ''").Find(&recetas).Error
+	if err != nil {
+		return 0, 0, err
+	}
+	migrados, sinInterpretar := 0, 0
+	for _, receta := range recetas {
+		minutos, ok := cocina.ParsearDuracion(receta.Tiempo)
+		if !ok {
+			sinInterpretar++
+			continue
+		}
+		err = database.Database.Unscoped().Model(&Receta{}).Where("id = ?", receta.ID).
+			UpdateColumns(map[string]interface{}{"tiempo_preparacion": minutos, "tiempo_total": minutos}).Error
+		if err != nil {
+			return migrados, sinInterpretar, err
+		}
+		migrados++
+	}
+	return migrados, sinInterpretar, nil
+}
+
+// importarAlimentosArchivo carga en la base de datos la tabla de nutrientes de un CSV
+func importarAlimentosArchivo(archivo string) error {
+	f, err := os.Open(archivo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	alimentos, err := cocina.LeerTablaNutrientes(f)
+	if err != nil {
+		return err
+	}
+	return database.Database.Transaction(func(tx *gorm.DB) error {
+		return ImportarAlimentos(tx, alimentos)
+	})
+}
 
 func Migraciones() {
 	err := database.Database.AutoMigrate(&Categoria{}, &Receta{}, &Contacto{}, &Estado{}, &Usuario{})
@@ -73,4 +577,127 @@ func Migraciones() {
 		panic("Error en migración de Categoria, Receta, Contacto, Estado, Usuario: " + err.Error())
 	}
 	fmt.Println("Migración de Categoria, Receta, Contacto, Estado, Usuario, ejecutada correctamente")
+
+	// Estados de usuario: se crean los que falten y se normalizan sus nombres
+	for id, nombre := range NombresEstado {
+		estado := Estado{}
+		err = database.Database.Where(Estado{ID: id}).Assign(Estado{Nombre: nombre}).FirstOrCreate(&estado).Error
+		if err != nil {
+			panic("Error al crear el estado " + nombre + ": " + err.Error())
+		}
+	}
+	fmt.Println("Estados de usuario creados correctamente")
+
+	// Ingredientes y pasos de las recetas
+	err = database.Database.AutoMigrate(&Ingrediente{}, &Paso{})
+	if err != nil {
+		panic("Error en migración de Ingrediente, Paso: " + err.Error())
+	}
+	fmt.Println("Migración de Ingrediente, Paso, ejecutada correctamente")
+
+	// Tiempos estructurados: el texto libre de las recetas anteriores pasa a minutos
+	migrados, sinInterpretar, err := migrarTiemposRecetas()
+	if err != nil {
+		panic("Error al migrar los tiempos de las recetas: " + err.Error())
+	}
+	fmt.Printf("Tiempos de recetas migrados: %d, sin interpretar: %d\n", migrados, sinInterpretar)
+
+	// Tabla de referencia de nutrientes y nutrientes calculados de cada receta
+	err = database.Database.AutoMigrate(&Alimento{}, &NutricionReceta{})
+	if err != nil {
+		panic("Error en migración de Alimento, NutricionReceta: " + err.Error())
+	}
+	fmt.Println("Migración de Alimento, NutricionReceta, ejecutada correctamente")
+
+	// La tabla incluida en el proyecto se carga solo si todavía no hay alimentos
+	var totalAlimentos int64
+	database.Database.Model(&Alimento{}).Count(&totalAlimentos)
+	if totalAlimentos == 0 {
+		archivo := os.Getenv("NUTRIENTES_CSV")
+		if archivo == "" {
+			archivo = "datos/nutrientes.csv"
+		}
+		if err := importarAlimentosArchivo(archivo); err != nil {
+			fmt.Println("No se pudo cargar la tabla de nutrientes " + archivo + ": " + err.Error())
+		} else {
+			fmt.Println("Tabla de nutrientes cargada desde " + archivo)
+		}
+	}
+
+	// Tablas de sesión: refresh tokens y tokens de acceso revocados
+	err = database.Database.AutoMigrate(&RefreshToken{}, &TokenRevocado{})
+	if err != nil {
+		panic("Error en migración de RefreshToken, TokenRevocado: " + err.Error())
+	}
+	fmt.Println("Migración de RefreshToken, TokenRevocado, ejecutada correctamente")
+
+	// Tokens de recuperación de contraseña
+	err = database.Database.AutoMigrate(&RecuperacionPassword{})
+	if err != nil {
+		panic("Error en migración de RecuperacionPassword: " + err.Error())
+	}
+	fmt.Println("Migración de RecuperacionPassword, ejecutada correctamente")
+
+	// Enlaces de inicio de sesión sin contraseña
+	err = database.Database.AutoMigrate(&EnlaceMagico{})
+	if err != nil {
+		panic("Error en migración de EnlaceMagico: " + err.Error())
+	}
+	fmt.Println("Migración de EnlaceMagico, ejecutada correctamente")
+
+	// Enlaces de confirmación de la baja de cuentas
+	err = database.Database.AutoMigrate(&ConfirmacionBaja{})
+	if err != nil {
+		panic("Error en migración de ConfirmacionBaja: " + err.Error())
+	}
+	fmt.Println("Migración de ConfirmacionBaja, ejecutada correctamente")
+
+	// Passkeys (WebAuthn) y sus ceremonias pendientes
+	err = database.Database.AutoMigrate(&CredencialWebauthn{}, &DesafioWebauthn{})
+	if err != nil {
+		panic("Error en migración de CredencialWebauthn, DesafioWebauthn: " + err.Error())
+	}
+	fmt.Println("Migración de CredencialWebauthn, DesafioWebauthn, ejecutada correctamente")
+
+	// Contadores de intentos fallidos de login
+	err = database.Database.AutoMigrate(&IntentoLogin{})
+	if err != nil {
+		panic("Error en migración de IntentoLogin: " + err.Error())
+	}
+	fmt.Println("Migración de IntentoLogin, ejecutada correctamente")
+
+	// Códigos de recuperación del 2FA
+	err = database.Database.AutoMigrate(&CodigoRecuperacion{})
+	if err != nil {
+		panic("Error en migración de CodigoRecuperacion: " + err.Error())
+	}
+	fmt.Println("Migración de CodigoRecuperacion, ejecutada correctamente")
+
+	// Login con proveedores OpenID Connect
+	err = database.Database.AutoMigrate(&IdentidadExterna{}, &SolicitudOidc{})
+	if err != nil {
+		panic("Error en migración de IdentidadExterna, SolicitudOidc: " + err.Error())
+	}
+	fmt.Println("Migración de IdentidadExterna, SolicitudOidc, ejecutada correctamente")
+
+	// Llaves de API personales
+	err = database.Database.AutoMigrate(&LlaveApi{})
+	if err != nil {
+		panic("Error en migración de LlaveApi: " + err.Error())
+	}
+	fmt.Println("Migración de LlaveApi, ejecutada correctamente")
+
+	// Sesiones activas por dispositivo
+	err = database.Database.AutoMigrate(&Sesion{})
+	if err != nil {
+		panic("Error en migración de Sesion: " + err.Error())
+	}
+	fmt.Println("Migración de Sesion, ejecutada correctamente")
+
+	// Registro de auditoría
+	err = database.Database.AutoMigrate(&EventoAuditoria{})
+	if err != nil {
+		panic("Error en migración de EventoAuditoria: " + err.Error())
+	}
+	fmt.Println("Migración de EventoAuditoria, ejecutada correctamente")
 }
@@ -0,0 +1,75 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+)
+
+// jwk es una clave pública del JWKS del proveedor (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) clavePublica() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := enteroB64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := enteroB64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curva elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curva = elliptic.P256()
+		case "P-384":
+			curva = elliptic.P384()
+		default:
+			return nil, errors.New("curva no soportada: " + k.Crv)
+		}
+		x, err := enteroB64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := enteroB64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curva, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.New("curva no soportada: " + k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("clave Ed25519 inválida")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, errors.New("tipo de clave no soportado: " + k.Kty)
+}
+
+func enteroB64(valor string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(valor)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,258 @@
+package oidc
+
+// Cliente OpenID Connect genérico: descubrimiento, flujo authorization code con
+// PKCE (S256) y verificación del id_token con las claves JWKS del proveedor.
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Configuracion del proveedor (variables OIDC_* del .env)
+type Configuracion struct {
+	Emisor       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ConfiguracionDesdeEntorno lee OIDC_EMISOR, OIDC_CLIENT_ID, OIDC_CLIENT_SECRET,
+// OIDC_REDIRECT_URL y OIDC_SCOPES. Devuelve false si el login externo no está configurado.
+func ConfiguracionDesdeEntorno() (Configuracion, bool) {
+	cfg := Configuracion{
+		Emisor:       strings.TrimSuffix(os.Getenv("OIDC_EMISOR"), "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return cfg, cfg.Emisor != "" && cfg.ClientID != "" && cfg.RedirectURL != ""
+}
+
+// Identidad son los datos del usuario tomados del id_token
+type Identidad struct {
+	Emisor           string
+	Sujeto           string
+	Correo           string
+	CorreoVerificado bool
+	Nombre           string
+}
+
+type descubrimiento struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+// Proveedor es un proveedor OIDC ya descubierto
+type Proveedor struct {
+	cfg     Configuracion
+	meta    descubrimiento
+	cliente *http.Client
+
+	mu    sync.Mutex
+	jwks  map[string]interface{}
+	leido time.Time
+}
+
+// NuevoProveedor consulta /.well-known/openid-configuration del emisor
+func NuevoProveedor(ctx context.Context, cfg Configuracion) (*Proveedor, error) {
+	p := &Proveedor{cfg: cfg, cliente: &http.Client{Timeout: 10 * time.Second}}
+	if err := p.obtenerJSON(ctx, cfg.Emisor+"/.well-known/openid-configuration", &p.meta); err != nil {
+		return nil, fmt.Errorf("descubrimiento OIDC: %v", err)
+	}
+	if strings.TrimSuffix(p.meta.Issuer, "/") != cfg.Emisor {
+		return nil, fmt.Errorf("el issuer %q no coincide con OIDC_EMISOR", p.meta.Issuer)
+	}
+	if p.meta.AuthorizationEndpoint == "" || p.meta.TokenEndpoint == "" || p.meta.JwksURI == "" {
+		return nil, errors.New("el documento de descubrimiento está incompleto")
+	}
+	return p, nil
+}
+
+// GenerarPKCE devuelve el code_verifier y su code_challenge S256 (RFC 7636)
+func GenerarPKCE() (string, string, error) {
+	verificador, err := aleatorio(32)
+	if err != nil {
+		return "", "", err
+	}
+	suma := sha256.Sum256([]byte(verificador))
+	return verificador, base64.RawURLEncoding.EncodeToString(suma[:]), nil
+}
+
+// GenerarValor devuelve un valor aleatorio para state o nonce
+func GenerarValor() (string, error) {
+	return aleatorio(32)
+}
+
+// URLAutorizacion construye la URL a la que se redirige el navegador
+func (p *Proveedor) URLAutorizacion(estado, nonce, desafioPKCE string) string {
+	parametros := url.Values{}
+	parametros.Set("response_type", "code")
+	parametros.Set("client_id", p.cfg.ClientID)
+	parametros.Set("redirect_uri", p.cfg.RedirectURL)
+	parametros.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	parametros.Set("state", estado)
+	parametros.Set("nonce", nonce)
+	parametros.Set("code_challenge", desafioPKCE)
+	parametros.Set("code_challenge_method", "S256")
+	separador := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		separador = "&"
+	}
+	return p.meta.AuthorizationEndpoint + separador + parametros.Encode()
+}
+
+// Intercambiar canjea el código de autorización por tokens y valida el id_token
+func (p *Proveedor) Intercambiar(ctx context.Context, codigo, verificador, nonce string) (Identidad, error) {
+	formulario := url.Values{}
+	formulario.Set("grant_type", "authorization_code")
+	formulario.Set("code", codigo)
+	formulario.Set("redirect_uri", p.cfg.RedirectURL)
+	formulario.Set("client_id", p.cfg.ClientID)
+	formulario.Set("code_verifier", verificador)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(formulario.Encode()))
+	if err != nil {
+		return Identidad{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	res, err := p.cliente.Do(req)
+	if err != nil {
+		return Identidad{}, err
+	}
+	defer res.Body.Close()
+	cuerpo, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode != http.StatusOK {
+		return Identidad{}, fmt.Errorf("el token endpoint respondió %d: %s", res.StatusCode, cuerpo)
+	}
+	var respuesta struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(cuerpo, &respuesta); err != nil || respuesta.IDToken == "" {
+		return Identidad{}, errors.New("la respuesta no incluye id_token")
+	}
+	return p.VerificarIDToken(ctx, respuesta.IDToken, nonce)
+}
+
+// VerificarIDToken valida firma, emisor, audiencia, expiración y nonce del id_token
+func (p *Proveedor) VerificarIDToken(ctx context.Context, idToken, nonce string) (Identidad, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.llave(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Identidad{}, err
+	}
+	if valor, _ := claims["nonce"].(string); valor == "" || valor != nonce {
+		return Identidad{}, errors.New("el nonce del id_token no coincide")
+	}
+	identidad := Identidad{Emisor: p.cfg.Emisor}
+	identidad.Sujeto, _ = claims["sub"].(string)
+	identidad.Correo, _ = claims["email"].(string)
+	identidad.Nombre, _ = claims["name"].(string)
+	switch verificado := claims["email_verified"].(type) {
+	case bool:
+		identidad.CorreoVerificado = verificado
+	case string:
+		identidad.CorreoVerificado = verificado == "true"
+	}
+	if identidad.Sujeto == "" {
+		return Identidad{}, errors.New("el id_token no incluye sub")
+	}
+	return identidad, nil
+}
+
+// llave busca la clave pública por kid; si no está se vuelve a leer el JWKS
+// (como mucho una vez por minuto) por si el proveedor rotó sus claves
+func (p *Proveedor) llave(ctx context.Context, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if clave, ok := p.jwks[kid]; ok {
+		return clave, nil
+	}
+	if time.Since(p.leido) < time.Minute && p.jwks != nil {
+		return nil, fmt.Errorf("kid desconocido: %q", kid)
+	}
+	var conjunto struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.obtenerJSON(ctx, p.meta.JwksURI, &conjunto); err != nil {
+		return nil, err
+	}
+	p.jwks = map[string]interface{}{}
+	p.leido = time.Now()
+	for _, k := range conjunto.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if clave, err := k.clavePublica(); err == nil {
+			p.jwks[k.Kid] = clave
+		}
+	}
+	if clave, ok := p.jwks[kid]; ok {
+		return clave, nil
+	}
+	// Algunos proveedores publican una sola clave sin kid
+	if len(p.jwks) == 1 && kid == "" {
+		for _, clave := range p.jwks {
+			return clave, nil
+		}
+	}
+	return nil, fmt.Errorf("kid desconocido: %q", kid)
+}
+
+func (p *Proveedor) obtenerJSON(ctx context.Context, direccion string, destino interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, direccion, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := p.cliente.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s respondió %d", direccion, res.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(destino)
+}
+
+func aleatorio(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
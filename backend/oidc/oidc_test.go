@@ -0,0 +1,206 @@
+package oidc_test
+
+import (
+	"backend/oidc"
+	"backend/oidc/oidctest"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// proveedorPrueba inicia el proveedor simulado y lo descubre como lo hace rutas
+func proveedorPrueba(t *testing.T) (*oidctest.Proveedor, *oidc.Proveedor) {
+	t.Helper()
+	simulado, err := oidctest.Nuevo("cliente-recetas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(simulado.Cerrar)
+	proveedor, err := oidc.NuevoProveedor(context.Background(), oidc.Configuracion{
+		Emisor:      simulado.Emisor(),
+		ClientID:    "cliente-recetas",
+		RedirectURL: "https://recetas.example/api/v1/seguridad/oidc/callback",
+		Scopes:      []string{"openid", "email"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return simulado, proveedor
+}
+
+func TestNuevoProveedorEmisorDistinto(t *testing.T) {
+	simulado, err := oidctest.Nuevo("cliente-recetas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer simulado.Cerrar()
+	// El issuer publicado debe ser el mismo que OIDC_EMISOR
+	_, err = oidc.NuevoProveedor(context.Background(), oidc.Configuracion{
+		Emisor:   strings.Replace(simulado.Emisor(), "127.0.0.1", "localhost", 1),
+		ClientID: "cliente-recetas",
+	})
+	if err == nil || !strings.Contains(err.Error(), "no coincide") {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestVerificarIDToken(t *testing.T) {
+	simulado, proveedor := proveedorPrueba(t)
+	otraClave, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hace := func(d time.Duration) int64 { return time.Now().Add(-d).Unix() }
+
+	casos := []struct {
+		nombre  string
+		ajustar func(jwt.MapClaims)
+		firmar  func(jwt.MapClaims) (string, error)
+		valido  bool
+	}{
+		{nombre: "válido", valido: true},
+		{nombre: "expirado dentro del margen", ajustar: func(c jwt.MapClaims) { c["exp"] = hace(30 * time.Second) }, valido: true},
+		{nombre: "emisor distinto", ajustar: func(c jwt.MapClaims) { c["iss"] = "https://otro.example" }},
+		{nombre: "audiencia distinta", ajustar: func(c jwt.MapClaims) { c["aud"] = "otro-cliente" }},
+		{nombre: "audiencia en lista", ajustar: func(c jwt.MapClaims) { c["aud"] = []string{"otro-cliente", "cliente-recetas"} }, valido: true},
+		{nombre: "nonce distinto", ajustar: func(c jwt.MapClaims) { c["nonce"] = "otro-nonce" }},
+		{nombre: "sin nonce", ajustar: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{nombre: "expirado", ajustar: func(c jwt.MapClaims) { c["exp"] = hace(2 * time.Minute) }},
+		{nombre: "sin expiración", ajustar: func(c jwt.MapClaims) { delete(c, "exp") }},
+		{nombre: "sin sub", ajustar: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{nombre: "firmado con otra clave", firmar: func(c jwt.MapClaims) (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+			token.Header["kid"] = simulado.Kid
+			return token.SignedString(otraClave)
+		}},
+		{nombre: "kid desconocido", firmar: func(c jwt.MapClaims) (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+			token.Header["kid"] = "otro-kid"
+			return token.SignedString(otraClave)
+		}},
+		{nombre: "HS256 con el client_id", firmar: func(c jwt.MapClaims) (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+			token.Header["kid"] = simulado.Kid
+			return token.SignedString([]byte("cliente-recetas"))
+		}},
+		{nombre: "firma alterada", firmar: func(c jwt.MapClaims) (string, error) {
+			token, err := simulado.Firmar(c)
+			return token[:len(token)-4] + "AAAA", err
+		}},
+	}
+	for _, caso := range casos {
+		claims := simulado.Claims("sujeto-1", "ana@example.com", "nonce-1")
+		if caso.ajustar != nil {
+			caso.ajustar(claims)
+		}
+		firmar := simulado.Firmar
+		if caso.firmar != nil {
+			firmar = caso.firmar
+		}
+		idToken, err := firmar(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identidad, err := proveedor.VerificarIDToken(context.Background(), idToken, "nonce-1")
+		if caso.valido && (err != nil || identidad.Sujeto != "sujeto-1") {
+			t.Errorf("%s: %+v, %v", caso.nombre, identidad, err)
+		}
+		if !caso.valido && err == nil {
+			t.Errorf("%s: se aceptó el id_token", caso.nombre)
+		}
+	}
+}
+
+func TestVerificarIDTokenCorreoVerificado(t *testing.T) {
+	simulado, proveedor := proveedorPrueba(t)
+	casos := []struct {
+		valor      interface{}
+		verificado bool
+	}{
+		{true, true},
+		{false, false},
+		{"true", true},
+		{"false", false},
+		{"TRUE", false},
+		{1, false},
+		{nil, false},
+	}
+	for _, caso := range casos {
+		claims := simulado.Claims("sujeto-1", "ana@example.com", "nonce-1")
+		claims["name"] = "Ana"
+		if caso.valor == nil {
+			delete(claims, "email_verified")
+		} else {
+			claims["email_verified"] = caso.valor
+		}
+		idToken, err := simulado.Firmar(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		identidad, err := proveedor.VerificarIDToken(context.Background(), idToken, "nonce-1")
+		if err != nil {
+			t.Fatalf("email_verified %#v: %v", caso.valor, err)
+		}
+		esperada := oidc.Identidad{Emisor: simulado.Emisor(), Sujeto: "sujeto-1", Correo: "ana@example.com", CorreoVerificado: caso.verificado, Nombre: "Ana"}
+		if identidad != esperada {
+			t.Errorf("email_verified %#v: %+v", caso.valor, identidad)
+		}
+	}
+}
+
+func TestIntercambiar(t *testing.T) {
+	simulado, proveedor := proveedorPrueba(t)
+	codigo, err := simulado.Autorizar(simulado.Claims("sujeto-1", "ana@example.com", "nonce-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identidad, err := proveedor.Intercambiar(context.Background(), codigo, "verificador-1", "nonce-1")
+	if err != nil || identidad.Sujeto != "sujeto-1" || !identidad.CorreoVerificado {
+		t.Fatalf("Intercambiar = %+v, %v", identidad, err)
+	}
+	// El code_verifier de PKCE llega al proveedor
+	if verificador := simulado.Verificador(codigo); verificador != "verificador-1" {
+		t.Errorf("code_verifier recibido: %q", verificador)
+	}
+	// El código es de un solo uso
+	if _, err := proveedor.Intercambiar(context.Background(), codigo, "verificador-1", "nonce-1"); err == nil {
+		t.Error("se canjeó dos veces el mismo código")
+	}
+	if _, err := proveedor.Intercambiar(context.Background(), "codigo-inventado", "verificador-1", "nonce-1"); err == nil {
+		t.Error("se canjeó un código desconocido")
+	}
+
+	// El id_token del canje también se valida
+	codigo, err = simulado.Autorizar(simulado.Claims("sujeto-1", "ana@example.com", "nonce-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proveedor.Intercambiar(context.Background(), codigo, "verificador-1", "otro-nonce"); err == nil {
+		t.Error("se aceptó un id_token con otro nonce")
+	}
+}
+
+func TestURLAutorizacion(t *testing.T) {
+	simulado, proveedor := proveedorPrueba(t)
+	direccion := proveedor.URLAutorizacion("estado-1", "nonce-1", "desafio-1")
+	for _, parte := range []string{
+		simulado.Emisor() + "/authorize?",
+		"response_type=code",
+		"client_id=cliente-recetas",
+		"scope=openid+email",
+		"state=estado-1",
+		"nonce=nonce-1",
+		"code_challenge=desafio-1",
+		"code_challenge_method=S256",
+	} {
+		if !strings.Contains(direccion, parte) {
+			t.Errorf("falta %q en %s", parte, direccion)
+		}
+	}
+}
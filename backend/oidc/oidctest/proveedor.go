@@ -0,0 +1,163 @@
+// Package oidctest implementa un proveedor OpenID Connect en memoria para probar el
+// login externo sin red: sirve el descubrimiento, el token endpoint y el JWKS, y firma
+// los id_token con una clave RSA propia.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Proveedor es un proveedor OIDC servido por httptest
+type Proveedor struct {
+	Servidor *httptest.Server
+	ClientID string
+	Kid      string
+
+	privada *rsa.PrivateKey
+
+	mu            sync.Mutex
+	codigos       map[string]string // Código de autorización -> id_token
+	verificadores map[string]string // Código canjeado -> code_verifier recibido
+}
+
+// Nuevo inicia un proveedor que emite tokens para clientID. Hay que cerrarlo con Cerrar.
+func Nuevo(clientID string) (*Proveedor, error) {
+	privada, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proveedor{
+		ClientID:      clientID,
+		Kid:           "clave-prueba",
+		privada:       privada,
+		codigos:       map[string]string{},
+		verificadores: map[string]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.descubrimiento)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	p.Servidor = httptest.NewServer(mux)
+	return p, nil
+}
+
+// Emisor es la URL base del proveedor (OIDC_EMISOR)
+func (p *Proveedor) Emisor() string {
+	return p.Servidor.URL
+}
+
+// Cerrar detiene el servidor
+func (p *Proveedor) Cerrar() {
+	p.Servidor.Close()
+}
+
+// Claims devuelve claims válidos para el sujeto, con correo verificado y una hora de vigencia
+func (p *Proveedor) Claims(sujeto, correo, nonce string) jwt.MapClaims {
+	ahora := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Emisor(),
+		"aud":            p.ClientID,
+		"sub":            sujeto,
+		"email":          correo,
+		"email_verified": true,
+		"nonce":          nonce,
+		"iat":            ahora.Unix(),
+		"exp":            ahora.Add(time.Hour).Unix(),
+	}
+}
+
+// Firmar firma los claims con RS256 y el kid del proveedor
+func (p *Proveedor) Firmar(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.Kid
+	return token.SignedString(p.privada)
+}
+
+// Autorizar simula que el usuario aceptó en el proveedor: devuelve un código de un solo
+// uso que el token endpoint canjea por un id_token con los claims indicados
+func (p *Proveedor) Autorizar(claims jwt.MapClaims) (string, error) {
+	idToken, err := p.Firmar(claims)
+	if err != nil {
+		return "", err
+	}
+	codigo := make([]byte, 16)
+	if _, err := rand.Read(codigo); err != nil {
+		return "", err
+	}
+	valor := base64.RawURLEncoding.EncodeToString(codigo)
+	p.mu.Lock()
+	p.codigos[valor] = idToken
+	p.mu.Unlock()
+	return valor, nil
+}
+
+// Verificador devuelve el code_verifier con el que se canjeó el código
+func (p *Proveedor) Verificador(codigo string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.verificadores[codigo]
+}
+
+func (p *Proveedor) descubrimiento(w http.ResponseWriter, r *http.Request) {
+	escribirJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 p.Emisor(),
+		"authorization_endpoint": p.Emisor() + "/authorize",
+		"token_endpoint":         p.Emisor() + "/token",
+		"jwks_uri":               p.Emisor() + "/jwks",
+	})
+}
+
+func (p *Proveedor) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("client_id") != p.ClientID {
+		escribirJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	codigo := r.PostForm.Get("code")
+	p.mu.Lock()
+	idToken, ok := p.codigos[codigo]
+	delete(p.codigos, codigo)
+	if ok {
+		p.verificadores[codigo] = r.PostForm.Get("code_verifier")
+	}
+	p.mu.Unlock()
+	if !ok {
+		escribirJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	escribirJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "acceso",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func (p *Proveedor) jwks(w http.ResponseWriter, r *http.Request) {
+	publica := p.privada.PublicKey
+	escribirJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": p.Kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(publica.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publica.E)).Bytes()),
+		}},
+	})
+}
+
+func escribirJSON(w http.ResponseWriter, codigo int, valor interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(codigo)
+	json.NewEncoder(w).Encode(valor)
+}
@@ -0,0 +1,159 @@
+package password
+
+// Hash de contraseñas con Argon2id (RFC 9106) en formato PHC, con compatibilidad
+// para los hashes bcrypt anteriores. Verificar indica además si el hash debe
+// regenerarse con el algoritmo y los parámetros actuales.
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algoritmos admitidos en PASSWORD_HASH_ALGORITMO
+const (
+	AlgoritmoArgon2id = "argon2id"
+	AlgoritmoBcrypt   = "bcrypt"
+)
+
+// ErrHashDesconocido se devuelve si el hash guardado no es de un algoritmo conocido
+var ErrHashDesconocido = errors.New("formato de hash de contraseña desconocido")
+
+var codificacion = base64.RawStdEncoding
+
+// Configuracion define el algoritmo con el que se generan los hashes nuevos
+type Configuracion struct {
+	Algoritmo string
+	// Parámetros de Argon2id
+	Memoria     uint32 // KiB
+	Iteraciones uint32
+	Paralelismo uint8
+	LargoSal    uint32
+	LargoClave  uint32
+	// Costo de bcrypt (si el algoritmo actual es bcrypt)
+	CostoBcrypt int
+}
+
+var (
+	cargaConfiguracion  sync.Once
+	configuracionActual Configuracion
+)
+
+// ConfiguracionActual devuelve la configuración del entorno (se lee una vez)
+func ConfiguracionActual() Configuracion {
+	cargaConfiguracion.Do(func() {
+		configuracionActual = ConfiguracionDesdeEntorno()
+	})
+	return configuracionActual
+}
+
+// ConfiguracionDesdeEntorno lee PASSWORD_HASH_ALGORITMO (argon2id), ARGON2_MEMORIA_KIB
+// (65536 = 64 MiB), ARGON2_ITERACIONES (3), ARGON2_PARALELISMO (2) y BCRYPT_COSTO (12)
+func ConfiguracionDesdeEntorno() Configuracion {
+	cfg := Configuracion{
+		Algoritmo:   strings.ToLower(os.Getenv("PASSWORD_HASH_ALGORITMO")),
+		Memoria:     uint32(enteroEntorno("ARGON2_MEMORIA_KIB", 64*1024)),
+		Iteraciones: uint32(enteroEntorno("ARGON2_ITERACIONES", 3)),
+		Paralelismo: uint8(min(enteroEntorno("ARGON2_PARALELISMO", 2), 255)),
+		LargoSal:    16,
+		LargoClave:  32,
+		CostoBcrypt: min(max(enteroEntorno("BCRYPT_COSTO", 12), bcrypt.MinCost), bcrypt.MaxCost),
+	}
+	if cfg.Algoritmo != AlgoritmoBcrypt {
+		cfg.Algoritmo = AlgoritmoArgon2id
+	}
+	return cfg
+}
+
+// Generar devuelve el hash de la contraseña con la configuración actual
+func Generar(password string) (string, error) {
+	return ConfiguracionActual().Generar(password)
+}
+
+// Verificar compara la contraseña con el hash guardado. rehash indica que la
+// contraseña es correcta pero el hash es de un algoritmo o parámetros anteriores.
+func Verificar(hash, password string) (ok bool, rehash bool) {
+	return ConfiguracionActual().Verificar(hash, password)
+}
+
+// Generar devuelve el hash de la contraseña con esta configuración
+func (cfg Configuracion) Generar(password string) (string, error) {
+	if cfg.Algoritmo == AlgoritmoBcrypt {
+		bytes, err := bcrypt.GenerateFromPassword([]byte(password), cfg.CostoBcrypt)
+		return string(bytes), err
+	}
+	sal := make([]byte, cfg.LargoSal)
+	if _, err := rand.Read(sal); err != nil {
+		return "", err
+	}
+	clave := argon2.IDKey([]byte(password), sal, cfg.Iteraciones, cfg.Memoria, cfg.Paralelismo, cfg.LargoClave)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, cfg.Memoria, cfg.Iteraciones, cfg.Paralelismo,
+		codificacion.EncodeToString(sal), codificacion.EncodeToString(clave)), nil
+}
+
+// Verificar compara la contraseña con el hash y dice si conviene regenerarlo
+func (cfg Configuracion) Verificar(hash, password string) (ok bool, rehash bool) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		parametros, sal, clave, err := parsearArgon2id(hash)
+		if err != nil {
+			return false, false
+		}
+		calculada := argon2.IDKey([]byte(password), sal, parametros.Iteraciones, parametros.Memoria, parametros.Paralelismo, uint32(len(clave)))
+		if subtle.ConstantTimeCompare(calculada, clave) != 1 {
+			return false, false
+		}
+		vigente := cfg.Algoritmo == AlgoritmoArgon2id &&
+			parametros.Memoria >= cfg.Memoria && parametros.Iteraciones >= cfg.Iteraciones &&
+			parametros.Paralelismo >= cfg.Paralelismo && uint32(len(clave)) >= cfg.LargoClave
+		return true, !vigente
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false, false
+	}
+	// Un hash bcrypt se regenera si el actual es Argon2id o si su costo es menor al configurado
+	costo, err := bcrypt.Cost([]byte(hash))
+	return true, err != nil || cfg.Algoritmo != AlgoritmoBcrypt || costo < cfg.CostoBcrypt
+}
+
+// parsearArgon2id interpreta $argon2id$v=19$m=...,t=...,p=...$sal$clave
+func parsearArgon2id(hash string) (Configuracion, []byte, []byte, error) {
+	partes := strings.Split(hash, "$")
+	if len(partes) != 6 || partes[1] != AlgoritmoArgon2id {
+		return Configuracion{}, nil, nil, ErrHashDesconocido
+	}
+	var version int
+	if _, err := fmt.Sscanf(partes[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Configuracion{}, nil, nil, ErrHashDesconocido
+	}
+	var parametros Configuracion
+	if _, err := fmt.Sscanf(partes[3], "m=%d,t=%d,p=%d", &parametros.Memoria, &parametros.Iteraciones, &parametros.Paralelismo); err != nil ||
+		parametros.Memoria == 0 || parametros.Iteraciones == 0 || parametros.Paralelismo == 0 {
+		return Configuracion{}, nil, nil, ErrHashDesconocido
+	}
+	sal, err := codificacion.DecodeString(partes[4])
+	if err != nil {
+		return Configuracion{}, nil, nil, ErrHashDesconocido
+	}
+	clave, err := codificacion.DecodeString(partes[5])
+	if err != nil || len(clave) == 0 {
+		return Configuracion{}, nil, nil, ErrHashDesconocido
+	}
+	return parametros, sal, clave, nil
+}
+
+func enteroEntorno(variable string, defecto int) int {
+	valor, err := strconv.Atoi(os.Getenv(variable))
+	if err != nil || valor <= 0 {
+		return defecto
+	}
+	return valor
+}
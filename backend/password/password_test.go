@@ -0,0 +1,140 @@
+package password_test
+
+import (
+	"backend/password"
+	"strings"
+	"testing"
+)
+
+const clave = "correcto caballo batería grapa"
+
+// Hashes fijos de clave: bcrypt de costo 10 y Argon2id con m=64,t=1,p=1
+const (
+	hashBcrypt   = "$2a$10$/DMMLsd7H35MJC4.rMpGk.YhIJSYU7XBbnLMSEnkw9KJg89yKNRw."
+	hashArgon2id = "$argon2id$v=19$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo"
+)
+
+// configuracion usa parámetros bajos para que las pruebas sean rápidas
+func configuracion() password.Configuracion {
+	return password.Configuracion{
+		Algoritmo:   password.AlgoritmoArgon2id,
+		Memoria:     64,
+		Iteraciones: 1,
+		Paralelismo: 1,
+		LargoSal:    16,
+		LargoClave:  32,
+		CostoBcrypt: 10,
+	}
+}
+
+func TestGenerarYVerificar(t *testing.T) {
+	for _, algoritmo := range []string{password.AlgoritmoArgon2id, password.AlgoritmoBcrypt} {
+		cfg := configuracion()
+		cfg.Algoritmo = algoritmo
+		hash, err := cfg.Generar(clave)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, rehash := cfg.Verificar(hash, clave); !ok || rehash {
+			t.Errorf("%s: Verificar(clave) = %v, %v; se esperaba true, false", algoritmo, ok, rehash)
+		}
+		if ok, rehash := cfg.Verificar(hash, clave+" "); ok || rehash {
+			t.Errorf("%s: Verificar(otra) = %v, %v; se esperaba false, false", algoritmo, ok, rehash)
+		}
+		// Cada hash lleva su propia sal
+		if otro, _ := cfg.Generar(clave); otro == hash {
+			t.Errorf("%s: dos hashes iguales para la misma contraseña", algoritmo)
+		}
+	}
+	if hash, _ := configuracion().Generar(clave); !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("formato PHC inesperado: %s", hash)
+	}
+}
+
+func TestVerificarRehash(t *testing.T) {
+	conBcrypt := configuracion()
+	conBcrypt.Algoritmo = password.AlgoritmoBcrypt
+	bcryptCostoso := conBcrypt
+	bcryptCostoso.CostoBcrypt = 12
+	masMemoria := configuracion()
+	masMemoria.Memoria = 128
+	masIteraciones := configuracion()
+	masIteraciones.Iteraciones = 2
+	masParalelismo := configuracion()
+	masParalelismo.Paralelismo = 2
+	claveMasLarga := configuracion()
+	claveMasLarga.LargoClave = 64
+
+	casos := []struct {
+		nombre string
+		cfg    password.Configuracion
+		hash   string
+		rehash bool
+	}{
+		{"bcrypt con Argon2id configurado", configuracion(), hashBcrypt, true},
+		{"bcrypt con el mismo costo", conBcrypt, hashBcrypt, false},
+		{"bcrypt con costo menor", bcryptCostoso, hashBcrypt, true},
+		{"Argon2id con los parámetros actuales", configuracion(), hashArgon2id, false},
+		{"Argon2id con bcrypt configurado", conBcrypt, hashArgon2id, true},
+		{"Argon2id con menos memoria", masMemoria, hashArgon2id, true},
+		{"Argon2id con menos iteraciones", masIteraciones, hashArgon2id, true},
+		{"Argon2id con menos paralelismo", masParalelismo, hashArgon2id, true},
+		{"Argon2id con clave más corta", claveMasLarga, hashArgon2id, true},
+	}
+	for _, caso := range casos {
+		ok, rehash := caso.cfg.Verificar(caso.hash, clave)
+		if !ok || rehash != caso.rehash {
+			t.Errorf("%s: Verificar = %v, %v; se esperaba true, %v", caso.nombre, ok, rehash, caso.rehash)
+		}
+		// Con la contraseña incorrecta nunca se pide regenerar
+		if ok, rehash := caso.cfg.Verificar(caso.hash, "incorrecta"); ok || rehash {
+			t.Errorf("%s: contraseña incorrecta = %v, %v", caso.nombre, ok, rehash)
+		}
+	}
+}
+
+func TestVerificarHashInvalido(t *testing.T) {
+	casos := map[string]string{
+		"vacío":                "",
+		"texto plano":          clave,
+		"versión distinta":     "$argon2id$v=16$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"sin versión":          "$argon2id$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"memoria cero":         "$argon2id$v=19$m=0,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"iteraciones cero":     "$argon2id$v=19$m=64,t=0,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"paralelismo cero":     "$argon2id$v=19$m=64,t=1,p=0$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"parámetros ilegibles": "$argon2id$v=19$m=x,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"sal en base64 mala":   "$argon2id$v=19$m=64,t=1,p=1$c2Fsc2F*c2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"clave en base64 mala": "$argon2id$v=19$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR5==IHeWuZEsHWDvFpFx3KO9kbo",
+		"clave vacía":          "$argon2id$v=19$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$",
+		"partes de más":        hashArgon2id + "$extra",
+		"otro algoritmo":       "$argon2i$v=19$m=64,t=1,p=1$c2Fsc2Fsc2Fsc2Fsc2FsIQ$5mFFfav8QI1ofAuFR541IHeWuZEsHWDvFpFx3KO9kbo",
+		"bcrypt truncado":      hashBcrypt[:30],
+	}
+	for nombre, hash := range casos {
+		if ok, rehash := configuracion().Verificar(hash, clave); ok || rehash {
+			t.Errorf("%s: Verificar = %v, %v; se esperaba false, false", nombre, ok, rehash)
+		}
+	}
+}
+
+func TestConfiguracionDesdeEntorno(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGORITMO", "")
+	t.Setenv("ARGON2_MEMORIA_KIB", "")
+	t.Setenv("ARGON2_ITERACIONES", "0")
+	t.Setenv("ARGON2_PARALELISMO", "x")
+	t.Setenv("BCRYPT_COSTO", "99")
+	cfg := password.ConfiguracionDesdeEntorno()
+	if cfg.Algoritmo != password.AlgoritmoArgon2id || cfg.Memoria != 64*1024 || cfg.Iteraciones != 3 || cfg.Paralelismo != 2 || cfg.CostoBcrypt != 31 {
+		t.Fatalf("valores por defecto: %+v", cfg)
+	}
+	t.Setenv("PASSWORD_HASH_ALGORITMO", "BCRYPT")
+	t.Setenv("ARGON2_MEMORIA_KIB", "19456")
+	if cfg := password.ConfiguracionDesdeEntorno(); cfg.Algoritmo != password.AlgoritmoBcrypt || cfg.Memoria != 19456 {
+		t.Fatalf("configuración leída: %+v", cfg)
+	}
+	// Un algoritmo desconocido usa Argon2id
+	t.Setenv("PASSWORD_HASH_ALGORITMO", "md5")
+	if cfg := password.ConfiguracionDesdeEntorno(); cfg.Algoritmo != password.AlgoritmoArgon2id {
+		t.Fatalf("algoritmo = %s", cfg.Algoritmo)
+	}
+}
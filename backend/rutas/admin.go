@@ -0,0 +1,296 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/middleware"
+	"backend/models"
+	"backend/utilidades"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Admin_usuario_rol(c *gin.Context) {
+	var body dto.RolDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !models.RolValido(body.Rol) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El rol debe ser admin, editor o author",
+		})
+		return
+	}
+	// Validamos que exista el usuario por id
+	id := c.Param("id")
+	usuario := models.Usuario{}
+	if err := database.Database.First(&usuario, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	// Un admin no puede quitarse el rol a sí mismo (evita quedarse sin administradores)
+	actual, _ := middleware.UsuarioActual(c)
+	if usuario.ID == actual.ID && body.Rol != models.RolAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "No puede quitarse a sí mismo el rol admin",
+		})
+		return
+	}
+	if err := database.Database.Model(&usuario).Update("rol", body.Rol).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo actualizar el registro",
+			"error":   err.Error(),
+		})
+		return
+	}
+	// Cerramos sus sesiones para que el nuevo rol se aplique en el próximo login
+	revocarSesionesUsuario(usuario.ID)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionUsuarioRol, Objetivo: "usuario:" + id, Resultado: models.ResultadoExito, Detalle: usuario.Rol + " -> " + body.Rol})
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Rol actualizado correctamente",
+	})
+}
+
+func Admin_usuario_desbloquear(c *gin.Context) {
+	// Validamos que exista el usuario por id
+	id := c.Param("id")
+	usuario := models.Usuario{}
+	if err := database.Database.First(&usuario, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	// Borramos los fallos y el bloqueo asociados a su correo
+	if err := AlmacenIntentos.Reiniciar("correo:" + strings.ToLower(usuario.Correo)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo desbloquear la cuenta",
+			"error":   err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionUsuarioDesbloquear, Objetivo: "usuario:" + id, Resultado: models.ResultadoExito})
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Cuenta desbloqueada correctamente",
+	})
+}
+
+func Admin_usuarios_get(c *gin.Context) {
+	consulta := database.Database.Model(&models.Usuario{})
+	// Búsqueda por nombre o correo
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		patron := "%" + q + "%"
+		consulta = consulta.Where("nombre LIKE ? OR correo LIKE ?", patron, patron)
+	}
+	if estado := c.Query("estado_id"); estado != "" {
+		consulta = consulta.Where("estado_id = ?", estado)
+	}
+	if rol := c.Query("rol"); rol != "" {
+		consulta = consulta.Where("rol = ?", rol)
+	}
+
+	pagina, err := strconv.Atoi(c.DefaultQuery("pagina", "1"))
+	if err != nil || pagina < 1 {
+		pagina = 1
+	}
+	limite, err := strconv.Atoi(c.DefaultQuery("limite", "50"))
+	if err != nil || limite < 1 || limite > 200 {
+		limite = 50
+	}
+	var total int64
+	consulta.Count(&total)
+	usuarios := models.Usuarios{}
+	result := consulta.Preload("Estado").Order("fecha desc, id desc").Offset((pagina - 1) * limite).Limit(limite).Find(&usuarios)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": result.Error.Error(),
+		})
+		return
+	}
+	datos := []gin.H{}
+	for _, usuario := range usuarios {
+		datos = append(datos, respuestaAdminUsuario(usuario))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  datos,
+		"total":  total,
+		"pagina": pagina,
+		"limite": limite,
+	})
+}
+
+func Admin_usuario_estado(c *gin.Context) {
+	var body dto.EstadoUsuarioDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if _, existe := models.NombresEstado[body.EstadoID]; !existe {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El estado indicado no existe",
+		})
+		return
+	}
+	// Validamos que exista el usuario por id
+	id := c.Param("id")
+	usuario := models.Usuario{}
+	if err := database.Database.First(&usuario, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	actual, _ := middleware.UsuarioActual(c)
+	if usuario.ID == actual.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "No puede cambiar el estado de su propia cuenta",
+		})
+		return
+	}
+	anterior := usuario.EstadoID
+	if !models.TransicionValida(anterior, body.EstadoID) {
+		c.JSON(http.StatusConflict, gin.H{
+			"estado":  "error",
+			"mensaje": "La cuenta no puede pasar de " + models.NombresEstado[anterior] + " a " + models.NombresEstado[body.EstadoID],
+		})
+		return
+	}
+	ahora := time.Now()
+	cambios := map[string]interface{}{
+		"estado_id":          body.EstadoID,
+		"motivo_estado":      strings.TrimSpace(body.Motivo),
+		"estado_cambiado_en": ahora,
+	}
+	// Activar una cuenta pendiente equivale a verificarla a mano
+	if anterior == models.EstadoPendiente {
+		cambios["token"] = ""
+		cambios["token_expira"] = nil
+	}
+	// Solo se aplica si nadie cambió el estado mientras tanto
+	result := database.Database.Model(&models.Usuario{}).Where("id = ? AND estado_id = ?", usuario.ID, anterior).Updates(cambios)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo actualizar el registro",
+			"error":   result.Error.Error(),
+		})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"estado":  "error",
+			"mensaje": "El estado de la cuenta cambió mientras tanto, vuelva a intentarlo",
+		})
+		return
+	}
+	// Una cuenta que deja de estar activa pierde sus sesiones de inmediato
+	if body.EstadoID != models.EstadoActivo {
+		revocarSesionesUsuario(usuario.ID)
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionUsuarioEstado, Objetivo: "usuario:" + id, Resultado: models.ResultadoExito, Detalle: models.NombresEstado[anterior] + " -> " + models.NombresEstado[body.EstadoID] + ": " + body.Motivo})
+	notificarCambioEstado(usuario, body.EstadoID, strings.TrimSpace(body.Motivo))
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Estado actualizado correctamente",
+	})
+}
+
+func Admin_usuario_cerrar_sesiones(c *gin.Context) {
+	// Validamos que exista el usuario por id
+	id := c.Param("id")
+	usuario := models.Usuario{}
+	if err := database.Database.First(&usuario, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := revocarSesionesUsuario(usuario.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudieron cerrar las sesiones",
+			"error":   err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionUsuarioCerrarSesiones, Objetivo: "usuario:" + id, Resultado: models.ResultadoExito})
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Sesiones cerradas correctamente",
+	})
+}
+
+// respuestaAdminUsuario devuelve los datos de un usuario que ve un administrador
+func respuestaAdminUsuario(usuario models.Usuario) gin.H {
+	return gin.H{
+		"id":                 usuario.ID,
+		"nombre":             usuario.Nombre,
+		"correo":             usuario.Correo,
+		"rol":                usuario.Rol,
+		"estado_id":          usuario.EstadoID,
+		"estado":             models.NombresEstado[usuario.EstadoID],
+		"motivo_estado":      usuario.MotivoEstado,
+		"estado_cambiado_en": usuario.EstadoCambiadoEn,
+		"totp_activo":        usuario.TotpActivo,
+		"fecha":              usuario.Fecha,
+	}
+}
+
+// notificarCambioEstado avisa al usuario de que su cuenta fue suspendida, baneada o reactivada
+func notificarCambioEstado(usuario models.Usuario, estado uint, motivo string) {
+	var detalle string
+	switch estado {
+	case models.EstadoSuspendido:
+		detalle = "Tu cuenta fue suspendida y se cerraron todas tus sesiones."
+	case models.EstadoBaneado:
+		detalle = "Tu cuenta fue bloqueada de forma permanente y se cerraron todas tus sesiones."
+	default:
+		detalle = "Tu cuenta está activa y ya puedes iniciar sesión."
+	}
+	var mensaje = "<h1>Cambio en el estado de tu cuenta</h1>" +
+		"Hola " + usuario.Nombre + ",<br><br>" +
+		detalle + "<br><br>" +
+		"Motivo: " + html.EscapeString(motivo)
+	go func(correo, nombre string) {
+		if err := utilidades.EnviarCorreo(correo, "Cambio en el estado de tu cuenta - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar aviso de cambio de estado:", err)
+		}
+	}(usuario.Correo, usuario.Nombre)
+}
@@ -0,0 +1,180 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/middleware"
+	"backend/models"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configurarAdminPrueba prepara la base y un directorio con .env vacío, que el
+// middleware necesita para cargar el entorno
+func configurarAdminPrueba(t *testing.T) models.Usuario {
+	t.Helper()
+	directorio := t.TempDir()
+	if err := os.WriteFile(filepath.Join(directorio, ".env"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(directorio)
+	baseDatosPrueba(t, &models.RefreshToken{}, &models.TokenRevocado{}, &models.Sesion{})
+	admin := crearUsuarioPrueba(t, "admin@example.com")
+	admin.Rol = models.RolAdmin
+	database.Database.Save(&admin)
+	return admin
+}
+
+// estadoPrueba pide a Admin_usuario_estado que lleve al usuario id al estado indicado
+func estadoPrueba(t *testing.T, admin models.Usuario, id uint, estado uint) (int, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, Admin_usuario_estado, &admin, map[string]interface{}{"estado_id": estado, "motivo": "Prueba"}, func(c *gin.Context) {
+		c.Params = gin.Params{{Key: "id", Value: fmt.Sprint(id)}}
+	})
+	return grabador.Code, respuestaPrueba(t, grabador)
+}
+
+// loginPrueba abre una sesión como lo hace el login y devuelve el token de acceso
+func loginPrueba(t *testing.T, usuario models.Usuario) string {
+	t.Helper()
+	grabador := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(grabador)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	respuesta, err := emitirSesion(c, usuario, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return respuesta["token"].(string)
+}
+
+// autenticarPrueba pasa el token por ValidarJWTMiddleware y devuelve el código
+func autenticarPrueba(t *testing.T, token string) int {
+	t.Helper()
+	router := gin.New()
+	router.GET("/", middleware.ValidarJWTMiddleware, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"estado": "ok"})
+	})
+	grabador := httptest.NewRecorder()
+	peticion := httptest.NewRequest(http.MethodGet, "/", nil)
+	peticion.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(grabador, peticion)
+	return grabador.Code
+}
+
+func TestAdminUsuarioEstadoTransiciones(t *testing.T) {
+	admin := configurarAdminPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	pasos := []struct {
+		estado uint
+		codigo int
+	}{
+		{models.EstadoSuspendido, http.StatusOK},
+		{models.EstadoSuspendido, http.StatusConflict}, // Ya está suspendida
+		{models.EstadoPendiente, http.StatusConflict},  // Nunca se vuelve a Pendiente
+		{models.EstadoEliminado, http.StatusConflict},  // La baja no se aplica a mano
+		{models.EstadoBaneado, http.StatusOK},
+		{models.EstadoSuspendido, http.StatusConflict}, // Un baneo solo se levanta activando
+		{models.EstadoActivo, http.StatusOK},
+		{99, http.StatusBadRequest},
+	}
+	for _, paso := range pasos {
+		anterior := models.Usuario{}
+		database.Database.First(&anterior, usuario.ID)
+		codigo, respuesta := estadoPrueba(t, admin, usuario.ID, paso.estado)
+		if codigo != paso.codigo {
+			t.Fatalf("%s -> %d: %d %v; se esperaba %d", models.NombresEstado[anterior.EstadoID], paso.estado, codigo, respuesta, paso.codigo)
+		}
+		guardado := models.Usuario{}
+		database.Database.First(&guardado, usuario.ID)
+		if paso.codigo == http.StatusOK && guardado.EstadoID != paso.estado || paso.codigo != http.StatusOK && guardado.EstadoID != anterior.EstadoID {
+			t.Fatalf("-> %d: estado guardado %d", paso.estado, guardado.EstadoID)
+		}
+	}
+
+	// Una cuenta eliminada ya no cambia de estado
+	database.Database.Model(&usuario).Update("estado_id", models.EstadoEliminado)
+	for _, estado := range []uint{models.EstadoActivo, models.EstadoSuspendido, models.EstadoBaneado} {
+		if codigo, respuesta := estadoPrueba(t, admin, usuario.ID, estado); codigo != http.StatusConflict {
+			t.Errorf("Eliminado -> %d: %d %v", estado, codigo, respuesta)
+		}
+	}
+
+	if codigo, respuesta := estadoPrueba(t, admin, 999, models.EstadoSuspendido); codigo != http.StatusNotFound {
+		t.Errorf("usuario inexistente: %d %v", codigo, respuesta)
+	}
+}
+
+func TestAdminUsuarioEstadoPropiaCuenta(t *testing.T) {
+	admin := configurarAdminPrueba(t)
+	if codigo, respuesta := estadoPrueba(t, admin, admin.ID, models.EstadoSuspendido); codigo != http.StatusBadRequest {
+		t.Fatalf("%d %v", codigo, respuesta)
+	}
+	guardado := models.Usuario{}
+	database.Database.First(&guardado, admin.ID)
+	if guardado.EstadoID != models.EstadoActivo {
+		t.Fatalf("el admin cambió su propio estado a %d", guardado.EstadoID)
+	}
+}
+
+func TestAdminUsuarioEstadoCierraSesiones(t *testing.T) {
+	admin := configurarAdminPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	tokens := []string{loginPrueba(t, usuario), loginPrueba(t, usuario)}
+	tokenAdmin := loginPrueba(t, admin)
+	for _, token := range tokens {
+		if codigo := autenticarPrueba(t, token); codigo != http.StatusOK {
+			t.Fatalf("antes de suspender: %d", codigo)
+		}
+	}
+
+	if codigo, respuesta := estadoPrueba(t, admin, usuario.ID, models.EstadoSuspendido); codigo != http.StatusOK {
+		t.Fatalf("suspender: %d %v", codigo, respuesta)
+	}
+	for _, token := range tokens {
+		if codigo := autenticarPrueba(t, token); codigo == http.StatusOK {
+			t.Fatal("un token de la cuenta suspendida sigue funcionando")
+		}
+	}
+	var abiertas, vigentes int64
+	database.Database.Model(&models.Sesion{}).Where("usuario_id = ? AND finalizada_en IS NULL", usuario.ID).Count(&abiertas)
+	database.Database.Model(&models.RefreshToken{}).Where("usuario_id = ? AND revocado_en IS NULL", usuario.ID).Count(&vigentes)
+	if abiertas != 0 || vigentes != 0 {
+		t.Fatalf("quedan %d sesiones y %d refresh tokens", abiertas, vigentes)
+	}
+	// Las sesiones de otros usuarios no se tocan
+	if codigo := autenticarPrueba(t, tokenAdmin); codigo != http.StatusOK {
+		t.Fatalf("token del admin: %d", codigo)
+	}
+
+	// Reactivar no devuelve las sesiones cerradas
+	if codigo, respuesta := estadoPrueba(t, admin, usuario.ID, models.EstadoActivo); codigo != http.StatusOK {
+		t.Fatalf("activar: %d %v", codigo, respuesta)
+	}
+	if codigo := autenticarPrueba(t, tokens[0]); codigo == http.StatusOK {
+		t.Fatal("el token volvió a funcionar al reactivar la cuenta")
+	}
+}
+
+func TestMiddlewareCuentaNoActiva(t *testing.T) {
+	configurarAdminPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	token := loginPrueba(t, usuario)
+
+	// Aunque el token siga vigente y su sesión abierta, el estado se comprueba en cada petición
+	for _, estado := range []uint{models.EstadoSuspendido, models.EstadoBaneado, models.EstadoPendiente, models.EstadoEliminado} {
+		database.Database.Model(&usuario).Update("estado_id", estado)
+		if codigo := autenticarPrueba(t, token); codigo != http.StatusForbidden {
+			t.Errorf("%s: %d", models.NombresEstado[estado], codigo)
+		}
+	}
+	database.Database.Model(&usuario).Update("estado_id", models.EstadoActivo)
+	if codigo := autenticarPrueba(t, token); codigo != http.StatusOK {
+		t.Fatalf("activo: %d", codigo)
+	}
+}
@@ -0,0 +1,123 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/middleware"
+	"backend/models"
+	"backend/utilidades"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Admin_auditoria_get(c *gin.Context) {
+	consulta := database.Database.Model(&models.EventoAuditoria{})
+	if usuarioID := c.Query("usuario_id"); usuarioID != "" {
+		consulta = consulta.Where("actor_id = ?", usuarioID)
+	}
+	if accion := c.Query("accion"); accion != "" {
+		consulta = consulta.Where("accion = ?", accion)
+	}
+	if resultado := c.Query("resultado"); resultado != "" {
+		consulta = consulta.Where("resultado = ?", resultado)
+	}
+	// Fechas en formato AAAA-MM-DD; "hasta" incluye el día completo
+	if desde := c.Query("desde"); desde != "" {
+		fecha, err := time.ParseInLocation("2006-01-02", desde, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"estado":  "error",
+				"mensaje": "El parámetro desde debe tener el formato AAAA-MM-DD",
+			})
+			return
+		}
+		consulta = consulta.Where("fecha >= ?", fecha)
+	}
+	if hasta := c.Query("hasta"); hasta != "" {
+		fecha, err := time.ParseInLocation("2006-01-02", hasta, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"estado":  "error",
+				"mensaje": "El parámetro hasta debe tener el formato AAAA-MM-DD",
+			})
+			return
+		}
+		consulta = consulta.Where("fecha < ?", fecha.AddDate(0, 0, 1))
+	}
+
+	pagina, err := strconv.Atoi(c.DefaultQuery("pagina", "1"))
+	if err != nil || pagina < 1 {
+		pagina = 1
+	}
+	limite, err := strconv.Atoi(c.DefaultQuery("limite", "50"))
+	if err != nil || limite < 1 || limite > 200 {
+		limite = 50
+	}
+	var total int64
+	consulta.Count(&total)
+	datos := models.EventosAuditoria{}
+	result := consulta.Order("fecha desc, id desc").Offset((pagina - 1) * limite).Limit(limite).Find(&datos)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": result.Error.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  datos,
+		"total":  total,
+		"pagina": pagina,
+		"limite": limite,
+	})
+}
+
+// auditar guarda un evento de auditoría completando IP, agente y fecha desde la petición.
+// Si no se indica actor se usa el usuario autenticado. Un fallo al guardar solo se
+// registra en el log para no interrumpir la acción auditada.
+func auditar(c *gin.Context, evento models.EventoAuditoria) {
+	if c != nil {
+		if evento.ActorID == nil {
+			if usuario, ok := middleware.UsuarioActual(c); ok {
+				evento.ActorID = &usuario.ID
+				evento.ActorCorreo = usuario.Correo
+			}
+		}
+		evento.IP = c.ClientIP()
+		evento.AgenteUsuario = utilidades.Truncar(c.Request.UserAgent(), 255)
+	}
+	evento.ActorCorreo = utilidades.Truncar(evento.ActorCorreo, 100)
+	evento.Detalle = utilidades.Truncar(evento.Detalle, 255)
+	evento.Fecha = time.Now()
+	if err := database.Database.Create(&evento).Error; err != nil {
+		log.Println("Error al registrar evento de auditoría:", err)
+	}
+}
+
+// actorAuditoria devuelve el id del usuario para usarlo como ActorID de un evento
+func actorAuditoria(usuario models.Usuario) *uint {
+	id := usuario.ID
+	return &id
+}
+
+// IniciarTareaRetencionAuditoria borra periódicamente los eventos más antiguos que
+// AUDITORIA_RETENCION_DIAS (365 por defecto). Se ejecuta en segundo plano desde main.
+func IniciarTareaRetencionAuditoria(intervalo time.Duration) {
+	for {
+		dias, err := strconv.Atoi(os.Getenv("AUDITORIA_RETENCION_DIAS"))
+		if err != nil || dias <= 0 {
+			dias = 365
+		}
+		if borrados, err := models.PurgarAuditoria(time.Now().AddDate(0, 0, -dias)); err != nil {
+			log.Println("Error al purgar la auditoría:", err)
+		} else if borrados > 0 {
+			log.Println("Eventos de auditoría purgados:", borrados)
+		}
+		time.Sleep(intervalo)
+	}
+}
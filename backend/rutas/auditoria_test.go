@@ -0,0 +1,173 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventoPrueba guarda un evento con la fecha indicada sin pasar por auditar
+func eventoPrueba(t *testing.T, actor *uint, accion, resultado string, fecha time.Time) models.EventoAuditoria {
+	t.Helper()
+	evento := models.EventoAuditoria{ActorID: actor, Accion: accion, Resultado: resultado, Fecha: fecha}
+	if err := database.Database.Create(&evento).Error; err != nil {
+		t.Fatal(err)
+	}
+	return evento
+}
+
+// auditoriaPrueba consulta Admin_auditoria_get con los parámetros indicados
+func auditoriaPrueba(t *testing.T, consulta string) (int, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, Admin_auditoria_get, nil, nil, func(c *gin.Context) {
+		c.Request.URL.RawQuery = consulta
+	})
+	return grabador.Code, respuestaPrueba(t, grabador)
+}
+
+func TestAuditarTruncaPorCaracteres(t *testing.T) {
+	baseDatosPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	agente := strings.Repeat("ñ", 300)
+	correo := strings.Repeat("é", 120) + "@example.com"
+	solicitudPrueba(t, func(c *gin.Context) {
+		auditar(c, models.EventoAuditoria{
+			ActorID:     actorAuditoria(usuario),
+			ActorCorreo: correo,
+			Accion:      models.AccionLogin,
+			Resultado:   models.ResultadoFallo,
+			Detalle:     strings.Repeat("日本", 200),
+		})
+	}, nil, nil, func(c *gin.Context) {
+		c.Request.Header.Set("User-Agent", agente)
+	})
+
+	evento := models.EventoAuditoria{}
+	if err := database.Database.First(&evento).Error; err != nil {
+		t.Fatal(err)
+	}
+	campos := []struct {
+		nombre string
+		valor  string
+		max    int
+	}{
+		{"agente", evento.AgenteUsuario, 255},
+		{"correo", evento.ActorCorreo, 100},
+		{"detalle", evento.Detalle, 255},
+	}
+	for _, campo := range campos {
+		if !utf8.ValidString(campo.valor) || utf8.RuneCountInString(campo.valor) != campo.max {
+			t.Errorf("%s: %d caracteres, UTF-8 válido %v; se esperaban %d", campo.nombre, utf8.RuneCountInString(campo.valor), utf8.ValidString(campo.valor), campo.max)
+		}
+	}
+	if evento.IP != "192.0.2.1" || evento.Fecha.IsZero() {
+		t.Errorf("evento sin datos de la petición: %+v", evento)
+	}
+}
+
+func TestAuditoriaSoloLectura(t *testing.T) {
+	baseDatosPrueba(t)
+	evento := eventoPrueba(t, nil, models.AccionLogin, models.ResultadoExito, time.Now())
+
+	if err := database.Database.Model(&evento).Update("resultado", models.ResultadoFallo).Error; !errors.Is(err, models.ErrAuditoriaSoloLectura) {
+		t.Errorf("Update: %v", err)
+	}
+	evento.Detalle = "modificado"
+	if err := database.Database.Save(&evento).Error; !errors.Is(err, models.ErrAuditoriaSoloLectura) {
+		t.Errorf("Save: %v", err)
+	}
+	if err := database.Database.Delete(&evento).Error; !errors.Is(err, models.ErrAuditoriaSoloLectura) {
+		t.Errorf("Delete: %v", err)
+	}
+
+	guardado := models.EventoAuditoria{}
+	if err := database.Database.First(&guardado, evento.ID).Error; err != nil {
+		t.Fatalf("el evento fue borrado: %v", err)
+	}
+	if guardado.Resultado != models.ResultadoExito || guardado.Detalle != "" {
+		t.Fatalf("el evento fue modificado: %+v", guardado)
+	}
+}
+
+func TestPurgarAuditoria(t *testing.T) {
+	baseDatosPrueba(t)
+	corte := time.Now().AddDate(0, 0, -30)
+	antiguo := eventoPrueba(t, nil, models.AccionLogin, models.ResultadoExito, corte.Add(-time.Hour))
+	muyAntiguo := eventoPrueba(t, nil, models.AccionLogin, models.ResultadoExito, corte.AddDate(-1, 0, 0))
+	reciente := eventoPrueba(t, nil, models.AccionLogin, models.ResultadoExito, corte.Add(time.Hour))
+	actual := eventoPrueba(t, nil, models.AccionLogin, models.ResultadoExito, time.Now())
+
+	borrados, err := models.PurgarAuditoria(corte)
+	if err != nil || borrados != 2 {
+		t.Fatalf("PurgarAuditoria = %d, %v; se esperaban 2 borrados", borrados, err)
+	}
+	var quedan []uint
+	database.Database.Model(&models.EventoAuditoria{}).Order("id").Pluck("id", &quedan)
+	if len(quedan) != 2 || quedan[0] != reciente.ID || quedan[1] != actual.ID {
+		t.Fatalf("quedan %v; se borraron %d y %d, se esperaban %d y %d", quedan, antiguo.ID, muyAntiguo.ID, reciente.ID, actual.ID)
+	}
+}
+
+func TestAdminAuditoriaGet(t *testing.T) {
+	baseDatosPrueba(t)
+	ana := crearUsuarioPrueba(t, "ana@example.com")
+	beto := crearUsuarioPrueba(t, "beto@example.com")
+	hoy := time.Now()
+	ayer := hoy.AddDate(0, 0, -1)
+	haceUnaSemana := hoy.AddDate(0, 0, -7)
+
+	eventoPrueba(t, actorAuditoria(ana), models.AccionLogin, models.ResultadoExito, haceUnaSemana)
+	eventoPrueba(t, actorAuditoria(ana), models.AccionLogin, models.ResultadoFallo, ayer)
+	eventoPrueba(t, actorAuditoria(ana), models.AccionCambioPassword, models.ResultadoExito, hoy)
+	eventoPrueba(t, actorAuditoria(beto), models.AccionLogin, models.ResultadoDenegado, hoy)
+	eventoPrueba(t, nil, models.AccionLogin, models.ResultadoFallo, ayer)
+
+	formato := "2006-01-02"
+	casos := []struct {
+		consulta string
+		total    int
+	}{
+		{"", 5},
+		{"usuario_id=" + fmt.Sprint(ana.ID), 3},
+		{"usuario_id=" + fmt.Sprint(beto.ID), 1},
+		{"accion=" + models.AccionLogin, 4},
+		{"resultado=" + models.ResultadoFallo, 2},
+		{"usuario_id=" + fmt.Sprint(ana.ID) + "&accion=" + models.AccionLogin + "&resultado=" + models.ResultadoFallo, 1},
+		{"desde=" + ayer.Format(formato), 4},
+		{"hasta=" + ayer.Format(formato), 3},
+		{"desde=" + ayer.Format(formato) + "&hasta=" + ayer.Format(formato), 2},
+		{"desde=" + hoy.AddDate(0, 0, 1).Format(formato), 0},
+	}
+	for _, caso := range casos {
+		codigo, respuesta := auditoriaPrueba(t, caso.consulta)
+		datos, _ := respuesta["datos"].([]interface{})
+		if codigo != http.StatusOK || respuesta["total"] != float64(caso.total) || len(datos) != caso.total {
+			t.Errorf("%q: %d, total %v, %d eventos; se esperaban %d", caso.consulta, codigo, respuesta["total"], len(datos), caso.total)
+		}
+	}
+
+	// Los eventos salen del más reciente al más antiguo, paginados
+	codigo, respuesta := auditoriaPrueba(t, "limite=2&pagina=3")
+	datos, _ := respuesta["datos"].([]interface{})
+	if codigo != http.StatusOK || respuesta["total"] != float64(5) || len(datos) != 1 {
+		t.Fatalf("paginación: %d %v", codigo, respuesta)
+	}
+	if primero, _ := datos[0].(map[string]interface{}); primero["resultado"] != models.ResultadoExito || primero["accion"] != models.AccionLogin {
+		t.Errorf("último evento de la lista: %v", primero)
+	}
+
+	for _, consulta := range []string{"desde=ayer", "hasta=2024-13-01"} {
+		if codigo, respuesta := auditoriaPrueba(t, consulta); codigo != http.StatusBadRequest {
+			t.Errorf("%q: %d %v", consulta, codigo, respuesta)
+		}
+	}
+}
@@ -77,6 +77,7 @@ func Categoria_post(c *gin.Context) {
 	// Creamos el registro
 	datos := models.Categoria{Nombre: body.Nombre, Slug: slug.Make(body.Nombre)}
 	database.Database.Save(&datos)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCategoriaCrear, Objetivo: "categoria:" + strconv.FormatUint(uint64(datos.ID), 10), Resultado: models.ResultadoExito, Detalle: datos.Nombre})
 	c.JSON(http.StatusCreated, gin.H{
 		"estado":  "ok",
 		"mensaje": "Registro creado correctamente",
@@ -110,6 +111,7 @@ func Categoria_put(c *gin.Context) {
 	datos.Nombre = body.Nombre
 	datos.Slug = slug.Make(body.Nombre)
 	database.Database.Save(&datos)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCategoriaEditar, Objetivo: "categoria:" + id, Resultado: models.ResultadoExito, Detalle: datos.Nombre})
 	// Retornamos el registro actualizado
 	c.JSON(http.StatusOK, gin.H{
 		"estado":  "ok",
@@ -144,6 +146,7 @@ func Categoria_delete(c *gin.Context) {
 
 	// Eliminamos el registro
 	database.Database.Delete(&datos)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCategoriaEliminar, Objetivo: "categoria:" + id, Resultado: models.ResultadoExito, Detalle: datos.Nombre})
 	// Retornamos
 	c.JSON(http.StatusOK, gin.H{
 		"estado":  "ok",
@@ -0,0 +1,416 @@
+package rutas
+
+import (
+	"archive/zip"
+	"backend/database"
+	"backend/dto"
+	"backend/middleware"
+	"backend/models"
+	"backend/password"
+	"backend/utilidades"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func Perfil_exportar(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+
+	// Reunimos todo lo asociado al usuario (sin hashes ni secretos)
+	recetas := models.Recetas{}
+	database.Database.Scopes(preloadReceta).Where(&models.Receta{UsuarioID: usuario.ID}).Find(&recetas)
+	contactos := models.Contactos{}
+	database.Database.Where(&models.Contacto{Correo: usuario.Correo}).Find(&contactos)
+	sesiones := models.Sesiones{}
+	database.Database.Where(&models.Sesion{UsuarioID: usuario.ID}).Find(&sesiones)
+	llaves := models.LlavesApi{}
+	database.Database.Where(&models.LlaveApi{UsuarioID: usuario.ID}).Find(&llaves)
+	identidades := models.IdentidadesExternas{}
+	database.Database.Where(&models.IdentidadExterna{UsuarioID: usuario.ID}).Find(&identidades)
+	passkeys := models.CredencialesWebauthn{}
+	database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).Find(&passkeys)
+
+	exportRecetas := make([]gin.H, 0, len(recetas))
+	for _, r := range recetas {
+		categoria := ""
+		if r.Categoria != nil {
+			categoria = r.Categoria.Nombre
+		}
+		foto := ""
+		if r.Foto != "" {
+			foto = "fotos/" + filepath.Base(r.Foto)
+		}
+		detalle := respuestaReceta(r, "")
+		exportRecetas = append(exportRecetas, gin.H{
+			"id":                 r.ID,
+			"nombre":             r.Nombre,
+			"slug":               r.Slug,
+			"categoria":          categoria,
+			"tiempo":             r.Tiempo,
+			"tiempo_preparacion": r.TiempoPreparacion,
+			"tiempo_coccion":     r.TiempoCoccion,
+			"tiempo_reposo":      r.TiempoReposo,
+			"descripcion":        r.Descripcion,
+			"porciones":          r.Porciones,
+			"ingredientes":       detalle.Ingredientes,
+			"pasos":              detalle.Pasos,
+			"foto":               foto,
+			"fecha":              r.Fecha,
+		})
+	}
+	datos := gin.H{
+		"exportado_en":         time.Now(),
+		"perfil":               respuestaPerfil(usuario),
+		"recetas":              exportRecetas,
+		"contactos":            contactos,
+		"sesiones":             sesiones,
+		"llaves_api":           llaves,
+		"identidades_externas": identidades,
+		"passkeys":             passkeys,
+	}
+	contenido, err := json.MarshalIndent(datos, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error al exportar los datos",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Respondemos un ZIP con datos.json y las fotos de las recetas
+	nombre := "datos-usuario-" + strconv.FormatUint(uint64(usuario.ID), 10) + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename=\""+nombre+"\"")
+	c.Status(http.StatusOK)
+	archivo := zip.NewWriter(c.Writer)
+	defer archivo.Close()
+	if w, err := archivo.Create("datos.json"); err == nil {
+		w.Write(contenido)
+	}
+	for _, r := range recetas {
+		if r.Foto == "" {
+			continue
+		}
+		if err := agregarArchivoZip(archivo, "public/recetas/"+filepath.Base(r.Foto), "fotos/"+filepath.Base(r.Foto)); err != nil {
+			log.Println("Exportar datos - no se pudo agregar la foto:", err)
+		}
+	}
+}
+
+func Perfil_eliminar(c *gin.Context) {
+	var body dto.EliminarCuentaDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Datos de entrada inválidos. Verifique que todos los campos requeridos estén completos y sean correctos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	if usuario.EliminacionProgramada == nil {
+		// Las cuentas creadas con OIDC, passkeys o enlaces mágicos pueden no conocer su
+		// contraseña: basta con haber iniciado sesión hace poco o con confirmar por correo
+		switch {
+		case len(body.Password) > 0:
+			if ok, _ := password.Verificar(usuario.Password, body.Password); !ok {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"estado":        "error",
+					"mensaje":       "Ocurrió un error al solicitar la baja.",
+					"errorOpcional": "La contraseña no es válida.",
+				})
+				return
+			}
+		case !sesionReciente(c, usuario):
+			if err := enviarConfirmacionBaja(usuario); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"estado":        "error",
+					"mensaje":       "Ocurrió un error al solicitar la baja.",
+					"errorOpcional": err.Error(),
+				})
+				return
+			}
+			auditar(c, models.EventoAuditoria{Accion: models.AccionCuentaBaja, Resultado: models.ResultadoExito, Detalle: "Confirmación enviada por correo"})
+			c.JSON(http.StatusAccepted, gin.H{
+				"estado":  "confirmacion_requerida",
+				"mensaje": "Te enviamos un correo con un enlace para confirmar la baja de la cuenta.",
+			})
+			return
+		}
+		if err := programarBaja(c, &usuario); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al solicitar la baja.",
+				"errorOpcional": err.Error(),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":                 "ok",
+		"mensaje":                "La cuenta se eliminará al terminar el plazo de gracia. Puede cancelar la baja hasta entonces.",
+		"eliminacion_programada": usuario.EliminacionProgramada,
+	})
+}
+
+func Perfil_confirmar_eliminacion(c *gin.Context) {
+	var body dto.ConfirmarBajaDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	respuestaInvalido := gin.H{
+		"estado":        "error",
+		"mensaje":       "No autorizado",
+		"errorOpcional": "El enlace no es válido, ya fue usado o está expirado.",
+	}
+	confirmacion := models.ConfirmacionBaja{}
+	result := database.Database.Where(&models.ConfirmacionBaja{TokenHash: utilidades.HashToken(body.Token)}).First(&confirmacion)
+	if result.Error != nil || confirmacion.UsadoEn != nil || time.Now().After(confirmacion.ExpiraEn) {
+		c.JSON(http.StatusUnauthorized, respuestaInvalido)
+		return
+	}
+	// Consumimos el enlace (un solo uso, incluso con peticiones concurrentes)
+	marcado := database.Database.Model(&models.ConfirmacionBaja{}).
+		Where("id = ? AND usado_en IS NULL", confirmacion.ID).
+		Update("usado_en", time.Now())
+	if marcado.Error != nil || marcado.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, respuestaInvalido)
+		return
+	}
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, confirmacion.UsuarioID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El usuario no existe o no está activo.",
+		})
+		return
+	}
+	if usuario.EliminacionProgramada == nil {
+		if err := programarBaja(c, &usuario); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al solicitar la baja.",
+				"errorOpcional": err.Error(),
+			})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":                 "ok",
+		"mensaje":                "La cuenta se eliminará al terminar el plazo de gracia. Puede cancelar la baja hasta entonces.",
+		"eliminacion_programada": usuario.EliminacionProgramada,
+	})
+}
+
+func Perfil_cancelar_eliminacion(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	if usuario.EliminacionProgramada == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "La cuenta no tiene una baja programada",
+		})
+		return
+	}
+	database.Database.Model(&usuario).Update("eliminacion_programada", nil)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCuentaBaja, Resultado: models.ResultadoExito, Detalle: "Cancelada"})
+	notificarCorreoActual(usuario, "Baja de cuenta cancelada", "Se canceló la baja de tu cuenta, que seguirá activa.")
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Baja cancelada correctamente",
+	})
+}
+
+// programarBaja fija la fecha de la baja al terminar el plazo de gracia y la avisa por correo
+func programarBaja(c *gin.Context, usuario *models.Usuario) error {
+	fecha := time.Now().Add(plazoEliminacion())
+	if err := database.Database.Model(usuario).Update("eliminacion_programada", fecha).Error; err != nil {
+		return err
+	}
+	usuario.EliminacionProgramada = &fecha
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCuentaBaja, ActorID: actorAuditoria(*usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoExito, Detalle: "Programada para " + fecha.Format("2006-01-02")})
+	notificarCorreoActual(*usuario, "Baja de cuenta programada", "Tu cuenta y tus datos personales se eliminarán el "+fecha.Format("02/01/2006 15:04")+
+		". Hasta esa fecha puedes cancelar la baja iniciando sesión.")
+	return nil
+}
+
+// sesionReciente indica si la sesión de la petición se abrió (con cualquier método de
+// login) hace menos de REAUTENTICACION_MINUTOS, 10 por defecto. Renovar el token con
+// el refresh no cuenta como volver a autenticarse.
+func sesionReciente(c *gin.Context, usuario models.Usuario) bool {
+	minutos, err := strconv.Atoi(os.Getenv("REAUTENTICACION_MINUTOS"))
+	if err != nil || minutos < 0 {
+		minutos = 10
+	}
+	sesion := models.Sesion{}
+	if err := database.Database.Where("id = ? AND usuario_id = ?", c.GetUint("sid"), usuario.ID).First(&sesion).Error; err != nil {
+		return false
+	}
+	return time.Since(sesion.Fecha) < time.Duration(minutos)*time.Minute
+}
+
+// enviarConfirmacionBaja envía el enlace que confirma la baja sin contraseña. Los
+// enlaces anteriores que no se usaron dejan de servir.
+func enviarConfirmacionBaja(usuario models.Usuario) error {
+	token, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		return err
+	}
+	ahora := time.Now()
+	database.Database.Model(&models.ConfirmacionBaja{}).
+		Where("usuario_id = ? AND usado_en IS NULL", usuario.ID).
+		Update("usado_en", ahora)
+	save := models.ConfirmacionBaja{
+		UsuarioID: usuario.ID,
+		TokenHash: utilidades.HashToken(token),
+		ExpiraEn:  ahora.Add(duracionConfirmacionBaja),
+		Fecha:     ahora,
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		return err
+	}
+	enlace := os.Getenv("RUTA_FRONTEND") + "/eliminar-cuenta?token=" + url.QueryEscape(token)
+	var mensaje = "<h1>Confirma la baja de tu cuenta</h1>" +
+		"Hola " + usuario.Nombre + ",<br><br>" +
+		"Para eliminar tu cuenta y tus datos personales haz click en el siguiente enlace:<br>" +
+		"<a href='" + enlace + "'>" + enlace + "</a><br><br>" +
+		"El enlace vence en " + strconv.Itoa(int(duracionConfirmacionBaja.Minutes())) + " minutos. " +
+		"La baja se aplicará al terminar el plazo de gracia y podrás cancelarla hasta entonces.<br>" +
+		"Si no fuiste tú, cambia tu contraseña de inmediato y contacta con el soporte."
+	go func(correo, nombre string) {
+		if err := utilidades.EnviarCorreo(correo, "Confirma la baja de tu cuenta - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar la confirmación de la baja:", err)
+		}
+	}(usuario.Correo, usuario.Nombre)
+	return nil
+}
+
+// IniciarTareaEliminaciones revisa periódicamente las cuentas cuyo plazo de gracia
+// terminó y las anonimiza. Se ejecuta en segundo plano desde main.
+func IniciarTareaEliminaciones(intervalo time.Duration) {
+	for {
+		EjecutarEliminacionesPendientes()
+		time.Sleep(intervalo)
+	}
+}
+
+// EjecutarEliminacionesPendientes anonimiza las cuentas con la baja vencida
+func EjecutarEliminacionesPendientes() {
+	pendientes := models.Usuarios{}
+	database.Database.
+		Where("eliminacion_programada IS NOT NULL AND eliminacion_programada <= ? AND estado_id <> ?", time.Now(), models.EstadoEliminado).
+		Find(&pendientes)
+	for _, usuario := range pendientes {
+		if err := anonimizarUsuario(usuario); err != nil {
+			log.Println("Error al eliminar la cuenta", usuario.ID, ":", err)
+			continue
+		}
+		log.Println("Cuenta eliminada y anonimizada:", usuario.ID)
+		auditar(nil, models.EventoAuditoria{Accion: models.AccionCuentaEliminar, ActorID: actorAuditoria(usuario), Objetivo: "usuario:" + strconv.FormatUint(uint64(usuario.ID), 10), Resultado: models.ResultadoExito})
+	}
+}
+
+// anonimizarUsuario borra los datos personales de la cuenta. El registro se conserva
+// anonimizado para que sus recetas no queden con un usuario_id inexistente, salvo que
+// ELIMINACION_REASIGNAR_A indique otro usuario al que traspasarlas.
+func anonimizarUsuario(usuario models.Usuario) error {
+	if err := revocarSesionesUsuario(usuario.ID); err != nil {
+		return err
+	}
+	correo := usuario.Correo
+	aleatorio, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		return err
+	}
+	hash, err := password.Generar(aleatorio)
+	if err != nil {
+		return err
+	}
+	err = database.Database.Transaction(func(tx *gorm.DB) error {
+		// El estado "Eliminado" puede no existir en bases creadas antes de esta función
+		estado := models.Estado{ID: models.EstadoEliminado, Nombre: "Eliminado"}
+		if err := tx.FirstOrCreate(&estado, models.Estado{ID: models.EstadoEliminado}).Error; err != nil {
+			return err
+		}
+		if destino, err := strconv.ParseUint(os.Getenv("ELIMINACION_REASIGNAR_A"), 10, 64); err == nil && uint(destino) != usuario.ID {
+			if err := tx.Model(&models.Receta{}).Where("usuario_id = ?", usuario.ID).Update("usuario_id", destino).Error; err != nil {
+				return err
+			}
+		}
+		for _, modelo := range []interface{}{&models.LlaveApi{}, &models.CodigoRecuperacion{}, &models.IdentidadExterna{}, &models.RecuperacionPassword{}, &models.EnlaceMagico{}, &models.ConfirmacionBaja{}, &models.CredencialWebauthn{}, &models.DesafioWebauthn{}, &models.RefreshToken{}, &models.Sesion{}} {
+			if err := tx.Where("usuario_id = ?", usuario.ID).Delete(modelo).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where(&models.Contacto{Correo: correo}).Delete(&models.Contacto{}).Error; err != nil {
+			return err
+		}
+		// La auditoría es de solo agregado, pero el correo del actor también es un dato personal
+		err := tx.Session(&gorm.Session{SkipHooks: true}).Model(&models.EventoAuditoria{}).
+			Where("actor_correo = ?", correo).Update("actor_correo", "").Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&usuario).Updates(map[string]interface{}{
+			"nombre":                 "Usuario eliminado",
+			"correo":                 fmt.Sprintf("eliminado-%d@eliminado.invalid", usuario.ID),
+			"correo_pendiente":       "",
+			"password":               hash,
+			"token":                  "",
+			"token_expira":           nil,
+			"totp_secreto":           "",
+			"totp_activo":            false,
+			"totp_ultimo_paso":       0,
+			"rol":                    models.RolAutor,
+			"estado_id":              models.EstadoEliminado,
+			"eliminacion_programada": nil,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	AlmacenIntentos.Reiniciar("correo:" + correo)
+	return nil
+}
+
+// duracionConfirmacionBaja es la vigencia del enlace que confirma la baja
+const duracionConfirmacionBaja = time.Hour
+
+// plazoEliminacion devuelve el plazo de gracia de la baja (ELIMINACION_DIAS, 30 por defecto)
+func plazoEliminacion() time.Duration {
+	dias, err := strconv.Atoi(os.Getenv("ELIMINACION_DIAS"))
+	if err != nil || dias < 0 {
+		dias = 30
+	}
+	return time.Duration(dias) * 24 * time.Hour
+}
+
+func agregarArchivoZip(archivo *zip.Writer, origen, destino string) error {
+	f, err := os.Open(origen)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := archivo.Create(destino)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,319 @@
+package rutas
+
+import (
+	"archive/zip"
+	"backend/database"
+	"backend/models"
+	"backend/password"
+	"backend/utilidades"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// modelosCuenta son las tablas con datos de un usuario que exporta o borra la baja
+var modelosCuenta = []interface{}{
+	&models.Categoria{}, &models.Receta{}, &models.Ingrediente{}, &models.Paso{}, &models.Contacto{},
+	&models.Sesion{}, &models.RefreshToken{}, &models.TokenRevocado{}, &models.LlaveApi{},
+	&models.IdentidadExterna{}, &models.CredencialWebauthn{}, &models.DesafioWebauthn{},
+	&models.CodigoRecuperacion{}, &models.RecuperacionPassword{}, &models.EnlaceMagico{}, &models.ConfirmacionBaja{},
+}
+
+// sesionPrueba guarda una sesión abierta en la fecha indicada y devuelve su id
+func sesionPrueba(t *testing.T, usuario models.Usuario, fecha time.Time) uint {
+	t.Helper()
+	sesion := models.Sesion{UsuarioID: usuario.ID, Familia: "familia-" + strconv.FormatInt(fecha.UnixNano(), 10), UltimoUso: fecha, ExpiraEn: fecha.Add(time.Hour), Fecha: fecha}
+	if err := database.Database.Create(&sesion).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sesion.ID
+}
+
+// eliminarPrueba pide la baja desde la sesión indicada
+func eliminarPrueba(t *testing.T, usuario models.Usuario, sid uint, cuerpo interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, Perfil_eliminar, &usuario, cuerpo, func(c *gin.Context) {
+		c.Set("sid", sid)
+	})
+	return grabador.Code, respuestaPrueba(t, grabador)
+}
+
+func TestPerfilEliminarConPassword(t *testing.T) {
+	baseDatosPrueba(t, modelosCuenta...)
+	t.Setenv("REAUTENTICACION_MINUTOS", "0")
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	hash, err := password.Generar("Clave-de-prueba-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.Database.Model(&usuario).Update("password", hash)
+	database.Database.First(&usuario, usuario.ID)
+	sid := sesionPrueba(t, usuario, time.Now())
+
+	if codigo, respuesta := eliminarPrueba(t, usuario, sid, map[string]string{"password": "otra"}); codigo != http.StatusBadRequest {
+		t.Fatalf("contraseña incorrecta: %d %v", codigo, respuesta)
+	}
+	codigo, respuesta := eliminarPrueba(t, usuario, sid, map[string]string{"password": "Clave-de-prueba-1"})
+	if codigo != http.StatusOK || respuesta["eliminacion_programada"] == nil {
+		t.Fatalf("contraseña correcta: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.EliminacionProgramada == nil || time.Until(*usuario.EliminacionProgramada) < 29*24*time.Hour {
+		t.Fatalf("baja programada: %v", usuario.EliminacionProgramada)
+	}
+}
+
+func TestPerfilEliminarSinPassword(t *testing.T) {
+	baseDatosPrueba(t, modelosCuenta...)
+	// Una cuenta creada con OIDC no conoce su contraseña
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	inutilizable, err := passwordInutilizable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.Database.Model(&usuario).Update("password", inutilizable)
+	database.Database.First(&usuario, usuario.ID)
+
+	// Una sesión abierta hace una hora no basta: se confirma por correo
+	antigua := sesionPrueba(t, usuario, time.Now().Add(-time.Hour))
+	codigo, respuesta := eliminarPrueba(t, usuario, antigua, map[string]string{})
+	if codigo != http.StatusAccepted || respuesta["estado"] != "confirmacion_requerida" {
+		t.Fatalf("sesión antigua: %d %v", codigo, respuesta)
+	}
+	confirmaciones := models.ConfirmacionesBaja{}
+	database.Database.Where("usuario_id = ?", usuario.ID).Find(&confirmaciones)
+	if len(confirmaciones) != 1 || confirmaciones[0].UsadoEn != nil {
+		t.Fatalf("confirmaciones: %+v", confirmaciones)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.EliminacionProgramada != nil {
+		t.Fatal("se programó la baja sin confirmar")
+	}
+	// Pedir otra confirmación invalida la anterior
+	eliminarPrueba(t, usuario, antigua, map[string]string{})
+	database.Database.First(&confirmaciones[0], confirmaciones[0].ID)
+	if confirmaciones[0].UsadoEn == nil {
+		t.Fatal("la confirmación anterior sigue vigente")
+	}
+
+	// Recién iniciada la sesión (con cualquier método) se acepta sin contraseña
+	reciente := sesionPrueba(t, usuario, time.Now())
+	if codigo, respuesta := eliminarPrueba(t, usuario, reciente, map[string]string{}); codigo != http.StatusOK {
+		t.Fatalf("sesión reciente: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.EliminacionProgramada == nil {
+		t.Fatal("no se programó la baja")
+	}
+}
+
+func TestPerfilConfirmarEliminacion(t *testing.T) {
+	baseDatosPrueba(t, modelosCuenta...)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	confirmacion := func(token string, expira time.Time) {
+		t.Helper()
+		database.Database.Create(&models.ConfirmacionBaja{UsuarioID: usuario.ID, TokenHash: utilidades.HashToken(token), ExpiraEn: expira, Fecha: time.Now()})
+	}
+	confirmacion("vencido", time.Now().Add(-time.Minute))
+	confirmacion("vigente", time.Now().Add(time.Hour))
+
+	for _, token := range []string{"vencido", "inexistente"} {
+		if codigo, respuesta := peticionPrueba(t, Perfil_confirmar_eliminacion, nil, map[string]string{"token": token}); codigo != http.StatusUnauthorized {
+			t.Fatalf("%s: %d %v", token, codigo, respuesta)
+		}
+	}
+	codigo, respuesta := peticionPrueba(t, Perfil_confirmar_eliminacion, nil, map[string]string{"token": "vigente"})
+	if codigo != http.StatusOK || respuesta["eliminacion_programada"] == nil {
+		t.Fatalf("confirmación: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.EliminacionProgramada == nil {
+		t.Fatal("no se programó la baja")
+	}
+	// La baja queda a nombre del usuario aunque la petición no traiga su sesión
+	evento := models.EventoAuditoria{}
+	database.Database.Where("accion = ?", models.AccionCuentaBaja).Last(&evento)
+	if evento.ActorID == nil || *evento.ActorID != usuario.ID || !strings.HasPrefix(evento.Detalle, "Programada para") {
+		t.Fatalf("auditoría: %+v", evento)
+	}
+	// Un solo uso
+	if codigo, _ := peticionPrueba(t, Perfil_confirmar_eliminacion, nil, map[string]string{"token": "vigente"}); codigo != http.StatusUnauthorized {
+		t.Fatalf("segundo uso: %d", codigo)
+	}
+}
+
+func TestPerfilExportar(t *testing.T) {
+	baseDatosPrueba(t, modelosCuenta...)
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("public/recetas", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("public/recetas/tarta.jpg", []byte("foto de la tarta"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	database.Database.Model(&usuario).Updates(map[string]interface{}{"password": "hash-secreto", "token": "token-secreto", "totp_secreto": "TOTPSECRETO"})
+	database.Database.First(&usuario, usuario.ID)
+	categoria := models.Categoria{Nombre: "Postres", Slug: "postres"}
+	database.Database.Create(&categoria)
+	database.Database.Create(&models.Receta{UsuarioID: usuario.ID, CategoriaID: categoria.ID, Nombre: "Tarta", Slug: "tarta", Tiempo: "1 h", Foto: "public/recetas/tarta.jpg", Fecha: time.Now(),
+		Ingredientes: models.Ingredientes{{Cantidad: "2", Nombre: "huevos"}}, Pasos: models.Pasos{{Numero: 1, Texto: "Batir"}}})
+	database.Database.Create(&models.LlaveApi{UsuarioID: usuario.ID, Nombre: "CI", Prefijo: "rk_abc", LlaveHash: "hash-de-llave", Scopes: "recetas:read", Fecha: time.Now()})
+	database.Database.Create(&models.CredencialWebauthn{UsuarioID: usuario.ID, Nombre: "Portátil", CredencialHash: "hash-credencial", CredencialID: "id", ClavePublica: []byte("clave-cose"), Fecha: time.Now()})
+	database.Database.Create(&models.IdentidadExterna{UsuarioID: usuario.ID, Emisor: "https://accounts.example", Sujeto: "123", Correo: "ana@example.com", Fecha: time.Now()})
+	database.Database.Create(&models.Contacto{Nombre: "Ana", Correo: "ana@example.com", Mensaje: "Hola", Fecha: time.Now()})
+	sesionPrueba(t, usuario, time.Now())
+	// Datos de otro usuario que no deben aparecer
+	otro := crearUsuarioPrueba(t, "beto@example.com")
+	database.Database.Create(&models.LlaveApi{UsuarioID: otro.ID, Nombre: "Ajena", Prefijo: "rk_xyz", LlaveHash: "hash-ajeno", Scopes: "recetas:read", Fecha: time.Now()})
+
+	grabador := solicitudPrueba(t, Perfil_exportar, &usuario, nil, nil)
+	if grabador.Code != http.StatusOK || grabador.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("respuesta: %d %v", grabador.Code, grabador.Header())
+	}
+	archivo, err := zip.NewReader(bytes.NewReader(grabador.Body.Bytes()), int64(grabador.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contenidos := map[string]string{}
+	for _, f := range archivo.File {
+		lector, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		datos, _ := io.ReadAll(lector)
+		lector.Close()
+		contenidos[f.Name] = string(datos)
+	}
+	if contenidos["fotos/tarta.jpg"] != "foto de la tarta" {
+		t.Fatalf("archivos del ZIP: %v", contenidos)
+	}
+
+	datosJSON := contenidos["datos.json"]
+	for _, secreto := range []string{"hash-secreto", "token-secreto", "TOTPSECRETO", "hash-de-llave", "hash-credencial", "clave-cose", "Y2xhdmUtY29zZQ", "familia-", "hash-ajeno", "beto@example.com"} {
+		if strings.Contains(datosJSON, secreto) {
+			t.Errorf("datos.json contiene %q", secreto)
+		}
+	}
+	var datos map[string]interface{}
+	if err := json.Unmarshal([]byte(datosJSON), &datos); err != nil {
+		t.Fatal(err)
+	}
+	recetas := datos["recetas"].([]interface{})
+	if len(recetas) != 1 || recetas[0].(map[string]interface{})["foto"] != "fotos/tarta.jpg" || recetas[0].(map[string]interface{})["categoria"] != "Postres" {
+		t.Fatalf("recetas: %v", recetas)
+	}
+	for _, clave := range []string{"contactos", "sesiones", "llaves_api", "identidades_externas", "passkeys"} {
+		if lista, _ := datos[clave].([]interface{}); len(lista) != 1 {
+			t.Errorf("%s: %v", clave, datos[clave])
+		}
+	}
+}
+
+func TestEjecutarEliminacionesPendientes(t *testing.T) {
+	baseDatosPrueba(t, modelosCuenta...)
+	t.Chdir(t.TempDir())
+	ayer, manana := time.Now().Add(-24*time.Hour), time.Now().Add(24*time.Hour)
+
+	vencida := crearUsuarioPrueba(t, "ana@example.com")
+	database.Database.Model(&vencida).Updates(map[string]interface{}{"eliminacion_programada": ayer, "totp_secreto": "TOTP", "totp_activo": true})
+	enGracia := crearUsuarioPrueba(t, "beto@example.com")
+	database.Database.Model(&enGracia).Update("eliminacion_programada", manana)
+	receptor := crearUsuarioPrueba(t, "editor@example.com")
+	t.Setenv("ELIMINACION_REASIGNAR_A", strconv.FormatUint(uint64(receptor.ID), 10))
+
+	// Quien canceló la baja antes del plazo no se elimina
+	cancelada := crearUsuarioPrueba(t, "carla@example.com")
+	database.Database.Model(&cancelada).Update("eliminacion_programada", ayer)
+	database.Database.First(&cancelada, cancelada.ID)
+	if codigo, respuesta := peticionPrueba(t, Perfil_cancelar_eliminacion, &cancelada, nil); codigo != http.StatusOK {
+		t.Fatalf("cancelar: %d %v", codigo, respuesta)
+	}
+
+	receta := models.Receta{UsuarioID: vencida.ID, Nombre: "Tarta", Slug: "tarta", Tiempo: "1 h", Fecha: time.Now()}
+	database.Database.Create(&receta)
+	dependientes := []interface{}{
+		&models.LlaveApi{UsuarioID: vencida.ID, Nombre: "CI", Prefijo: "rk_abc", LlaveHash: "hash-llave", Scopes: "recetas:read"},
+		&models.CodigoRecuperacion{UsuarioID: vencida.ID, CodigoHash: "hash-codigo"},
+		&models.IdentidadExterna{UsuarioID: vencida.ID, Emisor: "https://accounts.example", Sujeto: "123"},
+		&models.RecuperacionPassword{UsuarioID: vencida.ID, TokenHash: "hash-recuperacion", ExpiraEn: manana},
+		&models.EnlaceMagico{UsuarioID: vencida.ID, TokenHash: "hash-enlace", ExpiraEn: manana},
+		&models.ConfirmacionBaja{UsuarioID: vencida.ID, TokenHash: "hash-baja", ExpiraEn: manana},
+		&models.CredencialWebauthn{UsuarioID: vencida.ID, CredencialHash: "hash-passkey", CredencialID: "id", ClavePublica: []byte{1}},
+		&models.DesafioWebauthn{UsuarioID: vencida.ID, DesafioHash: "hash-desafio", ExpiraEn: manana},
+		&models.RefreshToken{UsuarioID: vencida.ID, Familia: "familia", TokenHash: "hash-refresh", ExpiraEn: manana},
+		&models.Contacto{Nombre: "Ana", Correo: "ana@example.com", Mensaje: "Hola"},
+	}
+	for _, fila := range dependientes {
+		if err := database.Database.Create(fila).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	sesionPrueba(t, vencida, time.Now())
+	sesionPrueba(t, enGracia, time.Now())
+	auditar(nil, models.EventoAuditoria{Accion: models.AccionLogin, ActorID: actorAuditoria(vencida), ActorCorreo: vencida.Correo, Resultado: models.ResultadoExito})
+
+	EjecutarEliminacionesPendientes()
+
+	// Se relee en un valor nuevo: First no pone a nil los punteros ya cargados
+	eliminada := models.Usuario{}
+	database.Database.First(&eliminada, vencida.ID)
+	if eliminada.EstadoID != models.EstadoEliminado || eliminada.Nombre != "Usuario eliminado" || eliminada.Correo != "eliminado-"+strconv.FormatUint(uint64(eliminada.ID), 10)+"@eliminado.invalid" ||
+		eliminada.Password == "-" || eliminada.TotpSecreto != "" || eliminada.TotpActivo || eliminada.EliminacionProgramada != nil {
+		t.Fatalf("cuenta no anonimizada: %+v", eliminada)
+	}
+	for _, modelo := range []interface{}{&models.LlaveApi{}, &models.CodigoRecuperacion{}, &models.IdentidadExterna{}, &models.RecuperacionPassword{}, &models.EnlaceMagico{},
+		&models.ConfirmacionBaja{}, &models.CredencialWebauthn{}, &models.DesafioWebauthn{}, &models.RefreshToken{}} {
+		var total int64
+		database.Database.Model(modelo).Where("usuario_id = ?", vencida.ID).Count(&total)
+		if total != 0 {
+			t.Errorf("quedan %d filas de %T", total, modelo)
+		}
+	}
+	var total int64
+	database.Database.Model(&models.Sesion{}).Where("usuario_id = ?", vencida.ID).Count(&total)
+	if total != 0 {
+		t.Errorf("quedan %d sesiones", total)
+	}
+	database.Database.Model(&models.Contacto{}).Where("correo = ?", "ana@example.com").Count(&total)
+	if total != 0 {
+		t.Errorf("quedan %d mensajes de contacto", total)
+	}
+	// La receta pasa al usuario de ELIMINACION_REASIGNAR_A
+	database.Database.First(&receta, receta.ID)
+	if receta.UsuarioID != receptor.ID {
+		t.Errorf("receta de %d, se esperaba %d", receta.UsuarioID, receptor.ID)
+	}
+	// La auditoría conserva el evento pero sin el correo
+	database.Database.Model(&models.EventoAuditoria{}).Where("actor_correo = ?", "ana@example.com").Count(&total)
+	if total != 0 {
+		t.Errorf("la auditoría conserva el correo en %d eventos", total)
+	}
+	evento := models.EventoAuditoria{}
+	database.Database.Where("accion = ?", models.AccionCuentaEliminar).First(&evento)
+	if evento.Objetivo != "usuario:"+strconv.FormatUint(uint64(vencida.ID), 10) {
+		t.Errorf("evento de eliminación: %+v", evento)
+	}
+
+	// Las cuentas en plazo de gracia o con la baja cancelada siguen intactas
+	for _, usuario := range []models.Usuario{enGracia, cancelada} {
+		guardado := models.Usuario{}
+		database.Database.First(&guardado, usuario.ID)
+		if guardado.EstadoID != models.EstadoActivo || guardado.Correo != usuario.Correo {
+			t.Errorf("%s fue eliminado: %+v", usuario.Correo, guardado)
+		}
+	}
+	database.Database.Model(&models.Sesion{}).Where("usuario_id = ? AND finalizada_en IS NULL", enGracia.ID).Count(&total)
+	if total != 1 {
+		t.Error("se cerró la sesión de una cuenta en plazo de gracia")
+	}
+}
@@ -0,0 +1,285 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/intentos"
+	"backend/jwt"
+	"backend/middleware"
+	"backend/models"
+	"backend/password"
+	"backend/totp"
+	"backend/utilidades"
+	"crypto/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cantidadCodigosRecuperacion es el número de códigos de un solo uso entregados al activar el 2FA
+const cantidadCodigosRecuperacion = 10
+
+func DosFactores_inscribir(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	if usuario.TotpActivo {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": "La verificación en dos pasos ya está activa.",
+		})
+		return
+	}
+	// Generamos un secreto nuevo que queda pendiente hasta confirmarlo
+	secreto, err := totp.GenerarSecreto()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if err := database.Database.Model(&usuario).Update("totp_secreto", secreto).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+
+	emisor := os.Getenv("TOTP_EMISOR")
+	if emisor == "" {
+		emisor = "Recetas"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Escanee el código QR con su aplicación y confirme con un código.",
+		"secreto": secreto,
+		"uri":     totp.URI(emisor, usuario.Correo, secreto),
+	})
+}
+
+func DosFactores_confirmar(c *gin.Context) {
+	var body dto.CodigoDosFactoresDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	if usuario.TotpActivo || usuario.TotpSecreto == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": "No hay una inscripción pendiente de confirmar.",
+		})
+		return
+	}
+	paso, ok := totp.Validar(usuario.TotpSecreto, body.Codigo, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": "El código ingresado no es válido.",
+		})
+		return
+	}
+
+	// Generamos los códigos de recuperación; solo se guarda su hash
+	codigos := make([]string, 0, cantidadCodigosRecuperacion)
+	guardar := make(models.CodigosRecuperacion, 0, cantidadCodigosRecuperacion)
+	for i := 0; i < cantidadCodigosRecuperacion; i++ {
+		codigo, err := generarCodigoRecuperacion()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+				"errorOpcional": err.Error(),
+			})
+			return
+		}
+		codigos = append(codigos, codigo)
+		guardar = append(guardar, models.CodigoRecuperacion{
+			UsuarioID:  usuario.ID,
+			CodigoHash: utilidades.HashToken(normalizarCodigoRecuperacion(codigo)),
+			Fecha:      time.Now(),
+		})
+	}
+	database.Database.Where(&models.CodigoRecuperacion{UsuarioID: usuario.ID}).Delete(&models.CodigoRecuperacion{})
+	if err := database.Database.Create(&guardar).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al activar la verificación en dos pasos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	database.Database.Model(&usuario).Updates(map[string]interface{}{
+		"totp_activo":      true,
+		"totp_ultimo_paso": paso,
+	})
+	auditar(c, models.EventoAuditoria{Accion: models.Accion2FAActivar, Resultado: models.ResultadoExito})
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":               "ok",
+		"mensaje":              "Verificación en dos pasos activada. Guarde los códigos de recuperación, no se volverán a mostrar.",
+		"codigos_recuperacion": codigos,
+	})
+}
+
+func DosFactores_desactivar(c *gin.Context) {
+	var body dto.DesactivarDosFactoresDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	if !usuario.TotpActivo {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al desactivar la verificación en dos pasos.",
+			"errorOpcional": "La verificación en dos pasos no está activa.",
+		})
+		return
+	}
+	// Pedimos la contraseña y un código válido para desactivarlo
+	if ok, _ := password.Verificar(usuario.Password, body.Password); !ok || !verificarSegundoFactor(&usuario, body.Codigo) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al desactivar la verificación en dos pasos.",
+			"errorOpcional": "La contraseña o el código no son válidos.",
+		})
+		return
+	}
+	database.Database.Where(&models.CodigoRecuperacion{UsuarioID: usuario.ID}).Delete(&models.CodigoRecuperacion{})
+	database.Database.Model(&usuario).Updates(map[string]interface{}{
+		"totp_activo":      false,
+		"totp_secreto":     "",
+		"totp_ultimo_paso": 0,
+	})
+	auditar(c, models.EventoAuditoria{Accion: models.Accion2FADesactivar, Resultado: models.ResultadoExito})
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Verificación en dos pasos desactivada",
+	})
+}
+
+func DosFactores_verificar(c *gin.Context) {
+	var body dto.VerificarDosFactoresDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	id, err := jwt.ValidarDesafio2FA(body.Desafio)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El desafío no es válido o expiró, inicie sesión nuevamente.",
+		})
+		return
+	}
+	// Los códigos también tienen límite de intentos para evitar fuerza bruta
+	clave := "2fa:" + strconv.FormatUint(uint64(id), 10)
+	politica := intentos.PoliticaActual()
+	registro, _ := AlmacenIntentos.Obtener(clave)
+	if espera := politica.Espera(registro, time.Now()); espera > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(espera.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"estado":  "error",
+			"mensaje": "Demasiados intentos fallidos. Intente nuevamente más tarde.",
+		})
+		return
+	}
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, id).Error; err != nil || !usuario.TotpActivo {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El usuario no existe o no está activo.",
+		})
+		return
+	}
+	if !verificarSegundoFactor(&usuario, body.Codigo) {
+		if r, err := AlmacenIntentos.RegistrarFallo(clave, politica.Ventana); err == nil && r.Fallos >= politica.MaxFallos {
+			AlmacenIntentos.Bloquear(clave, time.Now().Add(politica.Bloqueo))
+		}
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLogin2FA, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoFallo, Detalle: "Código no válido"})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El código ingresado no es válido.",
+		})
+		return
+	}
+	AlmacenIntentos.Reiniciar(clave)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionLogin2FA, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoExito})
+
+	respuesta, err := emitirSesion(c, usuario, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "Ocurrió un error al intentar generar el token" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, respuesta)
+}
+
+// verificarSegundoFactor acepta un código TOTP (sin permitir reutilizar uno ya usado)
+// o un código de recuperación, que queda consumido.
+func verificarSegundoFactor(usuario *models.Usuario, codigo string) bool {
+	if paso, ok := totp.Validar(usuario.TotpSecreto, codigo, time.Now()); ok {
+		// Actualizamos el último paso solo si es posterior al ya usado
+		result := database.Database.Model(&models.Usuario{}).
+			Where("id = ? AND totp_ultimo_paso < ?", usuario.ID, paso).
+			Update("totp_ultimo_paso", paso)
+		if result.Error == nil && result.RowsAffected == 1 {
+			usuario.TotpUltimoPaso = paso
+			return true
+		}
+		return false
+	}
+	hash := utilidades.HashToken(normalizarCodigoRecuperacion(codigo))
+	result := database.Database.Model(&models.CodigoRecuperacion{}).
+		Where("usuario_id = ? AND codigo_hash = ? AND usado_en IS NULL", usuario.ID, hash).
+		Update("usado_en", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// generarCodigoRecuperacion devuelve un código con formato xxxxx-xxxxx
+func generarCodigoRecuperacion() (string, error) {
+	// 32 símbolos (sin i, l, o ni 0 para evitar confusiones) para que b%32 no tenga sesgo
+	const alfabeto = "abcdefghjkmnpqrstuvwxyz123456789"
+	bytes := make([]byte, 10)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	for i, b := range bytes {
+		bytes[i] = alfabeto[int(b)%len(alfabeto)]
+	}
+	return string(bytes[:5]) + "-" + string(bytes[5:]), nil
+}
+
+func normalizarCodigoRecuperacion(codigo string) string {
+	codigo = strings.ToLower(strings.TrimSpace(codigo))
+	return strings.NewReplacer("-", "", " ", "").Replace(codigo)
+}
@@ -0,0 +1,83 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/totp"
+	"backend/utilidades"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerificarSegundoFactorTotp(t *testing.T) {
+	baseDatosPrueba(t, &models.CodigoRecuperacion{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	secreto, err := totp.GenerarSecreto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.Database.Model(&usuario).Updates(map[string]interface{}{"totp_secreto": secreto, "totp_activo": true})
+	database.Database.First(&usuario, usuario.ID)
+
+	// Evitamos que el paso cambie a mitad de la prueba
+	if time.Now().Unix()%totp.Periodo == totp.Periodo-1 {
+		time.Sleep(time.Second)
+	}
+	actual := totp.Paso(time.Now())
+	anterior, _ := totp.CodigoEnPaso(secreto, actual-1)
+	codigo, _ := totp.CodigoEnPaso(secreto, actual)
+
+	// El código del paso anterior se acepta por la tolerancia de reloj
+	if !verificarSegundoFactor(&usuario, anterior) || usuario.TotpUltimoPaso != actual-1 {
+		t.Fatalf("paso anterior rechazado (último paso %d)", usuario.TotpUltimoPaso)
+	}
+	if !verificarSegundoFactor(&usuario, codigo) {
+		t.Fatal("código actual rechazado")
+	}
+	// Reutilizar un código o volver a uno anterior al último usado no sirve
+	if verificarSegundoFactor(&usuario, codigo) {
+		t.Fatal("se aceptó el mismo código dos veces")
+	}
+	if verificarSegundoFactor(&usuario, anterior) {
+		t.Fatal("se aceptó un código anterior al último usado")
+	}
+	guardado := models.Usuario{}
+	database.Database.First(&guardado, usuario.ID)
+	if guardado.TotpUltimoPaso != actual {
+		t.Fatalf("último paso guardado = %d, se esperaba %d", guardado.TotpUltimoPaso, actual)
+	}
+}
+
+func TestVerificarSegundoFactorRecuperacion(t *testing.T) {
+	baseDatosPrueba(t, &models.CodigoRecuperacion{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	otro := crearUsuarioPrueba(t, "beto@example.com")
+	secreto, _ := totp.GenerarSecreto()
+	database.Database.Model(&usuario).Updates(map[string]interface{}{"totp_secreto": secreto, "totp_activo": true})
+	database.Database.First(&usuario, usuario.ID)
+
+	codigo, err := generarCodigoRecuperacion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Se guarda solo el hash del código normalizado
+	guardado := models.CodigoRecuperacion{UsuarioID: usuario.ID, CodigoHash: utilidades.HashToken(normalizarCodigoRecuperacion(codigo)), Fecha: time.Now()}
+	database.Database.Create(&guardado)
+
+	// El código de un usuario no sirve para otro
+	if verificarSegundoFactor(&otro, codigo) {
+		t.Fatal("se aceptó el código de otro usuario")
+	}
+	// Se acepta con otro formato (mayúsculas, sin guion) y una sola vez
+	if !verificarSegundoFactor(&usuario, " "+strings.ToUpper(codigo[:5]+codigo[6:])+" ") {
+		t.Fatal("código de recuperación rechazado")
+	}
+	database.Database.First(&guardado, guardado.ID)
+	if guardado.UsadoEn == nil {
+		t.Fatal("el código no quedó consumido")
+	}
+	if verificarSegundoFactor(&usuario, codigo) {
+		t.Fatal("se aceptó un código de recuperación ya usado")
+	}
+}
@@ -0,0 +1,210 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/models"
+	"backend/utilidades"
+	"backend/validaciones"
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cookieEnlaceMagico liga el enlace al navegador que lo solicitó
+const cookieEnlaceMagico = "enlace_magico"
+
+// rutaCookieEnlaceMagico limita el envío de la cookie a las rutas del enlace
+const rutaCookieEnlaceMagico = "/api/v1/seguridad/magic-link"
+
+// Límites de solicitudes de enlaces por hora
+const (
+	maxEnlacesPorCorreo = 3
+	maxEnlacesPorIP     = 10
+)
+
+func EnlaceMagico_solicitar(c *gin.Context) {
+	var body dto.OlvidePasswordDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if validaciones.Regex_correo.FindStringSubmatch(body.Correo) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "El correo ingresado no es válido.",
+		})
+		return
+	}
+	// Límite de enlaces por correo y por IP (se cuenta antes de buscar el usuario)
+	claves := map[string]int{
+		"enlace:" + strings.ToLower(body.Correo): maxEnlacesPorCorreo,
+		"enlace-ip:" + c.ClientIP():              maxEnlacesPorIP,
+	}
+	for clave, maximo := range claves {
+		registro, err := AlmacenIntentos.RegistrarFallo(clave, time.Hour)
+		if err == nil && registro.Fallos > maximo {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(registro.UltimoFallo.Add(time.Hour)).Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"estado":  "error",
+				"mensaje": "Se alcanzó el límite de enlaces solicitados. Intente nuevamente más tarde.",
+			})
+			return
+		}
+	}
+
+	// La respuesta es la misma exista o no el correo, para no revelar qué cuentas existen
+	respuestaGenerica := gin.H{
+		"estado":  "ok",
+		"mensaje": "Si el correo está registrado recibirás un enlace para iniciar sesión.",
+	}
+	// La cookie se guarda antes de buscar la cuenta: si solo se enviara cuando existe,
+	// el header Set-Cookie revelaría qué correos están registrados. Un cliente que no
+	// guarde cookies (una app o un script) igual podrá usar el enlace desde la misma IP.
+	navegador, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieEnlaceMagico, navegador, int(duracionEnlaceMagico().Seconds()), rutaCookieEnlaceMagico, "", c.Request.TLS != nil, true)
+
+	usuario := models.Usuarios{}
+	database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: models.EstadoActivo}).Find(&usuario)
+	if len(usuario) == 0 {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	token, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	// Invalidamos los enlaces anteriores que no se hayan usado
+	ahora := time.Now()
+	database.Database.Model(&models.EnlaceMagico{}).
+		Where("usuario_id = ? AND usado_en IS NULL", usuario[0].ID).
+		Update("usado_en", ahora)
+
+	save := models.EnlaceMagico{
+		UsuarioID:     usuario[0].ID,
+		TokenHash:     utilidades.HashToken(token),
+		NavegadorHash: utilidades.HashToken(navegador),
+		IP:            c.ClientIP(),
+		ExpiraEn:      ahora.Add(duracionEnlaceMagico()),
+		Fecha:         ahora,
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	enlace := os.Getenv("RUTA_FRONTEND") + "/magic-link?token=" + url.QueryEscape(token)
+	var mensaje = "<h1>Iniciar sesión</h1>" +
+		"Hola " + usuario[0].Nombre + ",<br><br>" +
+		"Haz click en el siguiente enlace para iniciar sesión sin contraseña:<br>" +
+		"<a href='" + enlace + "'>" + enlace + "</a><br><br>" +
+		"El enlace vence en " + strconv.Itoa(int(duracionEnlaceMagico().Minutes())) + " minutos, solo puede usarse una vez " +
+		"y debe abrirse en el mismo navegador desde el que lo pediste.<br>" +
+		"Si no fuiste tú, ignora este correo."
+	// Enviamos en segundo plano para que el tiempo de respuesta no delate si la cuenta existe
+	go func(correo, nombre string) {
+		if err := utilidades.EnviarCorreo(correo, "Iniciar sesión - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar el enlace de inicio de sesión:", err)
+		}
+	}(usuario[0].Correo, usuario[0].Nombre)
+
+	c.JSON(http.StatusOK, respuestaGenerica)
+}
+
+func EnlaceMagico_canjear(c *gin.Context) {
+	var body dto.EnlaceMagicoDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	respuestaInvalido := gin.H{
+		"estado":        "error",
+		"mensaje":       "No autorizado",
+		"errorOpcional": "El enlace no es válido, ya fue usado o está expirado.",
+	}
+	enlace := models.EnlaceMagico{}
+	result := database.Database.Where(&models.EnlaceMagico{TokenHash: utilidades.HashToken(body.Token)}).First(&enlace)
+	if result.Error != nil || enlace.UsadoEn != nil || time.Now().After(enlace.ExpiraEn) {
+		c.JSON(http.StatusUnauthorized, respuestaInvalido)
+		return
+	}
+	// Si el enlace se pidió desde un navegador que guardó la cookie, solo ese navegador
+	// puede usarlo. La cookie puede faltar si el cliente no la guardó al pedirlo.
+	if cookie, err := c.Cookie(cookieEnlaceMagico); err == nil && len(cookie) > 0 {
+		if subtle.ConstantTimeCompare([]byte(utilidades.HashToken(cookie)), []byte(enlace.NavegadorHash)) != 1 {
+			auditar(c, models.EventoAuditoria{Accion: models.AccionLoginEnlaceMagico, ActorID: &enlace.UsuarioID, Resultado: models.ResultadoDenegado, Detalle: "Enlace abierto en otro navegador"})
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"estado":        "error",
+				"mensaje":       "No autorizado",
+				"errorOpcional": "Abra el enlace en el mismo navegador desde el que lo solicitó.",
+			})
+			return
+		}
+	} else if enlace.IP != c.ClientIP() {
+		// Sin la cookie exigimos al menos la misma IP desde la que se pidió
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLoginEnlaceMagico, ActorID: &enlace.UsuarioID, Resultado: models.ResultadoDenegado, Detalle: "Enlace abierto desde otro dispositivo"})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "Abra el enlace en el mismo navegador desde el que lo solicitó.",
+		})
+		return
+	}
+	// Consumimos el enlace (un solo uso, incluso con peticiones concurrentes)
+	marcado := database.Database.Model(&models.EnlaceMagico{}).
+		Where("id = ? AND usado_en IS NULL", enlace.ID).
+		Update("usado_en", time.Now())
+	if marcado.Error != nil || marcado.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, respuestaInvalido)
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieEnlaceMagico, "", -1, rutaCookieEnlaceMagico, "", c.Request.TLS != nil, true)
+
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, enlace.UsuarioID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El usuario no existe o no está activo.",
+		})
+		return
+	}
+	detalle := ""
+	if usuario.TotpActivo {
+		detalle = "Pendiente del segundo factor"
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionLoginEnlaceMagico, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoExito, Detalle: detalle})
+	// Igual que el login con contraseña: si tiene 2FA se pide el segundo factor
+	completarLogin(c, usuario)
+}
+
+// duracionEnlaceMagico devuelve la vigencia del enlace (ENLACE_MAGICO_MINUTOS, 15 por defecto)
+func duracionEnlaceMagico() time.Duration {
+	minutos, err := strconv.Atoi(os.Getenv("ENLACE_MAGICO_MINUTOS"))
+	if err != nil || minutos <= 0 {
+		minutos = 15
+	}
+	return time.Duration(minutos) * time.Minute
+}
@@ -0,0 +1,154 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/utilidades"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// solicitarEnlacePrueba pide un enlace y devuelve la respuesta completa
+func solicitarEnlacePrueba(t *testing.T, correo string) (int, http.Header, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, EnlaceMagico_solicitar, nil, map[string]string{"correo": correo}, nil)
+	return grabador.Code, grabador.Header(), respuestaPrueba(t, grabador)
+}
+
+// crearEnlacePrueba guarda un enlace con token y cookie conocidos, pedido desde la IP de httptest
+func crearEnlacePrueba(t *testing.T, usuario models.Usuario, token, navegador string, expira time.Time) {
+	t.Helper()
+	enlace := models.EnlaceMagico{
+		UsuarioID:     usuario.ID,
+		TokenHash:     utilidades.HashToken(token),
+		NavegadorHash: utilidades.HashToken(navegador),
+		IP:            "192.0.2.1",
+		ExpiraEn:      expira,
+		Fecha:         time.Now(),
+	}
+	if err := database.Database.Create(&enlace).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// canjearEnlacePrueba canjea el token con la cookie (si no es vacía) desde la IP indicada
+func canjearEnlacePrueba(t *testing.T, token, cookie, ip string) (int, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, EnlaceMagico_canjear, nil, map[string]string{"token": token}, func(c *gin.Context) {
+		c.Request.RemoteAddr = ip + ":1234"
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: cookieEnlaceMagico, Value: cookie})
+		}
+	})
+	return grabador.Code, respuestaPrueba(t, grabador)
+}
+
+func TestEnlaceMagicoSolicitarNoDelataCuentas(t *testing.T) {
+	baseDatosPrueba(t, &models.EnlaceMagico{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	codigoExiste, headersExiste, respuestaExiste := solicitarEnlacePrueba(t, "ana@example.com")
+	codigoNoExiste, headersNoExiste, respuestaNoExiste := solicitarEnlacePrueba(t, "nadie@example.com")
+	if codigoExiste != http.StatusOK || codigoExiste != codigoNoExiste || !reflect.DeepEqual(respuestaExiste, respuestaNoExiste) {
+		t.Fatalf("las respuestas difieren: %d %v y %d %v", codigoExiste, respuestaExiste, codigoNoExiste, respuestaNoExiste)
+	}
+	// Los mismos headers, y la misma cookie salvo su valor aleatorio
+	nombres := func(h http.Header) []string {
+		var lista []string
+		for nombre := range h {
+			lista = append(lista, nombre)
+		}
+		sort.Strings(lista)
+		return lista
+	}
+	if !reflect.DeepEqual(nombres(headersExiste), nombres(headersNoExiste)) {
+		t.Fatalf("los headers difieren: %v y %v", headersExiste, headersNoExiste)
+	}
+	cookieExiste := (&http.Response{Header: headersExiste}).Cookies()
+	cookieNoExiste := (&http.Response{Header: headersNoExiste}).Cookies()
+	if len(cookieExiste) != 1 || len(cookieNoExiste) != 1 {
+		t.Fatalf("cookies: %v y %v", cookieExiste, cookieNoExiste)
+	}
+	navegador := cookieExiste[0].Value
+	cookieExiste[0].Value, cookieExiste[0].Raw = "", ""
+	cookieNoExiste[0].Value, cookieNoExiste[0].Raw = "", ""
+	if len(navegador) == 0 || !reflect.DeepEqual(cookieExiste[0], cookieNoExiste[0]) {
+		t.Fatalf("las cookies difieren: %+v y %+v", cookieExiste[0], cookieNoExiste[0])
+	}
+
+	// Solo la cuenta existente tiene un enlace, ligado a la cookie que recibió
+	enlaces := models.EnlacesMagicos{}
+	database.Database.Find(&enlaces)
+	if len(enlaces) != 1 || enlaces[0].UsuarioID != usuario.ID || enlaces[0].NavegadorHash != utilidades.HashToken(navegador) {
+		t.Fatalf("enlaces guardados: %+v", enlaces)
+	}
+}
+
+func TestEnlaceMagicoCanjear(t *testing.T) {
+	baseDatosPrueba(t, &models.EnlaceMagico{}, &models.RefreshToken{}, &models.Sesion{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	t.Run("un solo uso", func(t *testing.T) {
+		crearEnlacePrueba(t, usuario, "token-uso", "navegador-uso", time.Now().Add(time.Minute))
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-uso", "navegador-uso", "203.0.113.7"); codigo != http.StatusOK || respuesta["token"] == nil {
+			t.Fatalf("primer canje: %d %v", codigo, respuesta)
+		}
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-uso", "navegador-uso", "203.0.113.7"); codigo != http.StatusUnauthorized {
+			t.Fatalf("segundo canje: %d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("otra cookie", func(t *testing.T) {
+		crearEnlacePrueba(t, usuario, "token-cookie", "navegador-cookie", time.Now().Add(time.Minute))
+		// La IP coincide, pero la cookie de otro navegador no sirve
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-cookie", "otro-navegador", "192.0.2.1"); codigo != http.StatusUnauthorized {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("sin cookie desde otra IP", func(t *testing.T) {
+		crearEnlacePrueba(t, usuario, "token-ip", "navegador-ip", time.Now().Add(time.Minute))
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-ip", "", "203.0.113.7"); codigo != http.StatusUnauthorized {
+			t.Fatalf("otra IP: %d %v", codigo, respuesta)
+		}
+		// El rechazo no consume el enlace: desde la misma IP sigue sirviendo
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-ip", "", "192.0.2.1"); codigo != http.StatusOK {
+			t.Fatalf("misma IP: %d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("expirado", func(t *testing.T) {
+		crearEnlacePrueba(t, usuario, "token-expirado", "navegador-expirado", time.Now().Add(-time.Minute))
+		if codigo, respuesta := canjearEnlacePrueba(t, "token-expirado", "navegador-expirado", "192.0.2.1"); codigo != http.StatusUnauthorized {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+}
+
+func TestEnlaceMagicoLimitePorCorreo(t *testing.T) {
+	baseDatosPrueba(t, &models.EnlaceMagico{})
+	crearUsuarioPrueba(t, "ana@example.com")
+
+	for i := 1; i <= maxEnlacesPorCorreo; i++ {
+		if codigo, _, respuesta := solicitarEnlacePrueba(t, "ana@example.com"); codigo != http.StatusOK {
+			t.Fatalf("solicitud %d: %d %v", i, codigo, respuesta)
+		}
+	}
+	codigo, headers, respuesta := solicitarEnlacePrueba(t, "ana@example.com")
+	if codigo != http.StatusTooManyRequests || headers.Get("Retry-After") == "" {
+		t.Fatalf("solicitud sobre el límite: %d %v %v", codigo, headers, respuesta)
+	}
+	// Al superar el límite no se guarda la cookie de un enlace que no se envió
+	if headers.Get("Set-Cookie") != "" {
+		t.Fatalf("se guardó la cookie sobre el límite: %v", headers)
+	}
+	// Otro correo desde la misma IP sigue pudiendo pedir el suyo
+	if codigo, _, respuesta := solicitarEnlacePrueba(t, "beto@example.com"); codigo != http.StatusOK {
+		t.Fatalf("otro correo: %d %v", codigo, respuesta)
+	}
+}
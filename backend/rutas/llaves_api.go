@@ -0,0 +1,176 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/middleware"
+	"backend/models"
+	"backend/utilidades"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prefijoLlaveApi identifica las llaves de esta API (útil para detectarlas si se filtran)
+const prefijoLlaveApi = "rk_"
+
+func LlaveApi_get(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.LlavesApi{}
+	result := database.Database.Where(&models.LlaveApi{UsuarioID: usuario.ID}).Order("id desc").Find(&datos)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": result.Error.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  datos,
+	})
+}
+
+func LlaveApi_post(c *gin.Context) {
+	var body dto.LlaveApiDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   err.Error(),
+		})
+		return
+	}
+	nombre := strings.TrimSpace(body.Nombre)
+	if nombre == "" || len(nombre) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El nombre es obligatorio y no puede superar los 100 caracteres",
+		})
+		return
+	}
+	// Validamos los scopes y quitamos duplicados
+	scopes := []string{}
+	vistos := map[string]bool{}
+	for _, scope := range body.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !models.ScopeValido(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"estado":  "error",
+				"mensaje": "Scope no válido: " + scope,
+			})
+			return
+		}
+		if !vistos[scope] {
+			vistos[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Debe indicar al menos un scope",
+		})
+		return
+	}
+
+	aleatorio, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   err.Error(),
+		})
+		return
+	}
+	llave := prefijoLlaveApi + aleatorio
+	usuario, _ := middleware.UsuarioActual(c)
+	save := models.LlaveApi{
+		UsuarioID: usuario.ID,
+		Nombre:    nombre,
+		Prefijo:   llave[:len(prefijoLlaveApi)+8],
+		LlaveHash: utilidades.HashToken(llave),
+		Scopes:    strings.Join(scopes, ","),
+		Fecha:     time.Now(),
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo crear el registro",
+			"error":   err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionLlaveApiCrear, Objetivo: "llave_api:" + strconv.FormatUint(uint64(save.ID), 10), Resultado: models.ResultadoExito, Detalle: save.Scopes})
+	// La llave completa solo se muestra en esta respuesta
+	c.JSON(http.StatusCreated, gin.H{
+		"estado":  "ok",
+		"mensaje": "Llave creada correctamente. Guárdela ahora, no se volverá a mostrar.",
+		"llave":   llave,
+		"datos":   save,
+	})
+}
+
+func LlaveApi_put(c *gin.Context) {
+	var body dto.NombreLlaveApiDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   err.Error(),
+		})
+		return
+	}
+	nombre := strings.TrimSpace(body.Nombre)
+	if nombre == "" || len(nombre) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El nombre es obligatorio y no puede superar los 100 caracteres",
+		})
+		return
+	}
+	datos, ok := llaveApiPropia(c)
+	if !ok {
+		return
+	}
+	database.Database.Model(&datos).Update("nombre", nombre)
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Registro modificado correctamente",
+	})
+}
+
+func LlaveApi_delete(c *gin.Context) {
+	datos, ok := llaveApiPropia(c)
+	if !ok {
+		return
+	}
+	// Se conserva el registro revocado para que el listado muestre su historial
+	if datos.RevocadaEn == nil {
+		database.Database.Model(&datos).Update("revocada_en", time.Now())
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLlaveApiRevocar, Objetivo: "llave_api:" + c.Param("id"), Resultado: models.ResultadoExito, Detalle: datos.Nombre})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Llave revocada correctamente",
+	})
+}
+
+// llaveApiPropia busca la llave del parámetro :id entre las del usuario autenticado.
+// Si no existe responde 404 y devuelve false.
+func llaveApiPropia(c *gin.Context) (models.LlaveApi, bool) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.LlaveApi{}
+	if err := database.Database.Where(&models.LlaveApi{UsuarioID: usuario.ID}).First(&datos, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return datos, false
+	}
+	return datos, true
+}
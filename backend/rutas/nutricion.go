@@ -0,0 +1,214 @@
+package rutas
+
+import (
+	"backend/cocina"
+	"backend/database"
+	"backend/dto"
+	"backend/models"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func Receta_nutricion(c *gin.Context) {
+	id := c.Param("id")
+	var receta models.Receta
+	result := database.Database.Scopes(preloadReceta).First(&receta, id)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   result.Error.Error(),
+		})
+		return
+	}
+
+	// Usamos el cálculo guardado; las recetas anteriores a esta función se calculan ahora
+	guardadas := models.NutricionesReceta{}
+	database.Database.Where(&models.NutricionReceta{RecetaID: receta.ID}).Limit(1).Find(&guardadas)
+	var nutricion models.NutricionReceta
+	if len(guardadas) > 0 {
+		nutricion = guardadas[0]
+	} else {
+		var err error
+		nutricion, err = recalcularNutricion(database.Database, receta.ID, receta.Ingredientes)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":  "error",
+				"mensaje": "No se pudieron calcular los nutrientes",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  respuestaNutricion(receta, nutricion),
+	})
+}
+
+func Admin_nutrientes_importar(c *gin.Context) {
+	file, err := c.FormFile("archivo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error inesperado",
+			"error":   "No se recibió el archivo CSV",
+		})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo leer el archivo",
+			"error":   err.Error(),
+		})
+		return
+	}
+	defer f.Close()
+	alimentos, err := cocina.LeerTablaNutrientes(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El archivo no es una tabla de nutrientes válida",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := database.Database.Transaction(func(tx *gorm.DB) error {
+		return models.ImportarAlimentos(tx, alimentos)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo importar la tabla de nutrientes",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Los valores cambiaron: recalculamos todas las recetas
+	recalculadas, err := recalcularNutricionTodas()
+	if err != nil {
+		log.Println("Importar nutrientes - error al recalcular las recetas:", err)
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionNutrientesImportar, Resultado: models.ResultadoExito, Detalle: strconv.Itoa(len(alimentos)) + " alimentos"})
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":               "ok",
+		"mensaje":              "Tabla de nutrientes importada correctamente",
+		"alimentos":            len(alimentos),
+		"recetas_recalculadas": recalculadas,
+	})
+}
+
+// recalcularNutricion calcula los nutrientes de los ingredientes de una receta y
+// guarda el resultado. Se llama dentro de la transacción que cambia los ingredientes
+// y la primera vez que se consulta una receta sin cálculo guardado.
+func recalcularNutricion(tx *gorm.DB, recetaID uint, ingredientes models.Ingredientes) (models.NutricionReceta, error) {
+	tabla, err := models.CargarTablaNutrientes(tx)
+	if err != nil {
+		return models.NutricionReceta{}, err
+	}
+	return guardarNutricion(tx, tabla, recetaID, ingredientes)
+}
+
+// recalcularNutricionTodas recalcula los nutrientes de todas las recetas con la tabla actual
+func recalcularNutricionTodas() (int, error) {
+	tabla, err := models.CargarTablaNutrientes(database.Database)
+	if err != nil {
+		return 0, err
+	}
+	recetas := models.Recetas{}
+	err = database.Database.Preload("Ingredientes", func(db *gorm.DB) *gorm.DB { return db.Order("orden, id") }).Find(&recetas).Error
+	if err != nil {
+		return 0, err
+	}
+	for i, receta := range recetas {
+		if _, err := guardarNutricion(database.Database, tabla, receta.ID, receta.Ingredientes); err != nil {
+			return i, err
+		}
+	}
+	return len(recetas), nil
+}
+
+// guardarNutricion suma el aporte de cada ingrediente y lo guarda en la receta
+func guardarNutricion(tx *gorm.DB, tabla cocina.TablaNutrientes, recetaID uint, ingredientes models.Ingredientes) (models.NutricionReceta, error) {
+	var total cocina.Nutrientes
+	detalle := make([]dto.NutricionIngredienteResponse, 0, len(ingredientes))
+	sinCalcular := 0
+	for _, i := range ingredientes {
+		resultado := tabla.CalcularIngrediente(i.Cantidad, i.Unidad, i.Nombre)
+		if resultado.Motivo != "" {
+			sinCalcular++
+		}
+		total = total.Sumar(resultado.Nutrientes)
+		resultado.Nutrientes = resultado.Nutrientes.Redondear()
+		detalle = append(detalle, dto.NutricionIngredienteResponse{
+			Cantidad:             i.Cantidad,
+			Unidad:               i.Unidad,
+			Nombre:               i.Nombre,
+			NutricionIngrediente: resultado,
+		})
+	}
+	contenido, err := json.Marshal(detalle)
+	if err != nil {
+		return models.NutricionReceta{}, err
+	}
+
+	nutricion := models.NutricionReceta{}
+	err = tx.Where(models.NutricionReceta{RecetaID: recetaID}).
+		Assign(map[string]interface{}{
+			"calorias": total.Calorias, "proteinas": total.Proteinas, "grasas": total.Grasas,
+			"carbohidratos": total.Carbohidratos, "fibra": total.Fibra, "sodio": total.Sodio,
+			"sin_calcular": sinCalcular, "detalle": string(contenido), "calculado_en": time.Now(),
+		}).
+		FirstOrCreate(&nutricion).Error
+	return nutricion, err
+}
+
+// respuestaNutricion arma la respuesta con el total, el valor por porción y el detalle
+func respuestaNutricion(receta models.Receta, nutricion models.NutricionReceta) dto.NutricionResponse {
+	total := cocina.Nutrientes{
+		Calorias:      nutricion.Calorias,
+		Proteinas:     nutricion.Proteinas,
+		Grasas:        nutricion.Grasas,
+		Carbohidratos: nutricion.Carbohidratos,
+		Fibra:         nutricion.Fibra,
+		Sodio:         nutricion.Sodio,
+	}
+	detalle := []dto.NutricionIngredienteResponse{}
+	if err := json.Unmarshal([]byte(nutricion.Detalle), &detalle); err != nil {
+		log.Println("Nutrición de la receta", receta.ID, "- detalle inválido:", err)
+	}
+	sinCalcular := []dto.NutricionIngredienteResponse{}
+	for _, ingrediente := range detalle {
+		if ingrediente.Motivo != "" {
+			sinCalcular = append(sinCalcular, ingrediente)
+		}
+	}
+
+	respuesta := dto.NutricionResponse{
+		Id:           receta.ID,
+		Nombre:       receta.Nombre,
+		Slug:         receta.Slug,
+		Porciones:    receta.Porciones,
+		Total:        total.Redondear(),
+		Completo:     len(detalle) > 0 && len(sinCalcular) == 0,
+		Ingredientes: detalle,
+		SinCalcular:  sinCalcular,
+		CalculadoEn:  nutricion.CalculadoEn,
+	}
+	// Las porciones pueden cambiar sin tocar los ingredientes, por eso se dividen aquí
+	if receta.Porciones > 0 {
+		porPorcion := total.Escalar(1 / float64(receta.Porciones)).Redondear()
+		respuesta.PorPorcion = &porPorcion
+	}
+	return respuesta
+}
@@ -0,0 +1,281 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/oidc"
+	"backend/password"
+	"backend/utilidades"
+	"backend/validaciones"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// cookieOidc guarda el state en el navegador que inició el login (protección CSRF)
+const cookieOidc = "oidc_estado"
+
+// cookieOidcModo recuerda si el login se inició con ?modo=cookie
+const cookieOidcModo = "oidc_modo"
+
+// duracionSolicitudOidc es el tiempo máximo para volver del proveedor
+const duracionSolicitudOidc = 10 * time.Minute
+
+var (
+	proveedorMu     sync.Mutex
+	proveedorActual *oidc.Proveedor
+)
+
+func Oidc_login(c *gin.Context) {
+	proveedor, err := proveedorOidc(c.Request.Context())
+	if err != nil {
+		log.Println("OIDC no disponible:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"estado":        "error",
+			"mensaje":       "El inicio de sesión externo no está disponible.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	estado, errEstado := oidc.GenerarValor()
+	nonce, errNonce := oidc.GenerarValor()
+	verificador, desafio, errPKCE := oidc.GenerarPKCE()
+	if err := errors.Join(errEstado, errNonce, errPKCE); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	// Limpiamos solicitudes abandonadas y guardamos la nueva
+	database.Database.Where("expira_en < ?", time.Now()).Delete(&models.SolicitudOidc{})
+	save := models.SolicitudOidc{
+		EstadoHash:  utilidades.HashToken(estado),
+		Nonce:       nonce,
+		Verificador: verificador,
+		ExpiraEn:    time.Now().Add(duracionSolicitudOidc),
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieOidc, estado, int(duracionSolicitudOidc.Seconds()), "/api/v1/seguridad/oidc", "", c.Request.TLS != nil, true)
+	if modoCookie(c) {
+		c.SetCookie(cookieOidcModo, "cookie", int(duracionSolicitudOidc.Seconds()), "/api/v1/seguridad/oidc", "", c.Request.TLS != nil, true)
+	}
+	c.Redirect(http.StatusFound, proveedor.URLAutorizacion(estado, nonce, desafio))
+}
+
+func Oidc_callback(c *gin.Context) {
+	if errorProveedor := c.Query("error"); errorProveedor != "" {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "El proveedor rechazó el inicio de sesión: " + errorProveedor})
+		return
+	}
+	// El state debe coincidir con la cookie del navegador que inició el login
+	estado := c.Query("state")
+	cookie, _ := c.Cookie(cookieOidc)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(cookieOidc, "", -1, "/api/v1/seguridad/oidc", "", c.Request.TLS != nil, true)
+	if modo, _ := c.Cookie(cookieOidcModo); modo == "cookie" {
+		c.SetCookie(cookieOidcModo, "", -1, "/api/v1/seguridad/oidc", "", c.Request.TLS != nil, true)
+		c.Set("modo_cookie", true)
+	}
+	if estado == "" || cookie != estado {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "La solicitud de inicio de sesión no es válida."})
+		return
+	}
+	// La solicitud es de un solo uso
+	solicitud := models.SolicitudOidc{}
+	if err := database.Database.Where(&models.SolicitudOidc{EstadoHash: utilidades.HashToken(estado)}).First(&solicitud).Error; err != nil {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "La solicitud de inicio de sesión no es válida."})
+		return
+	}
+	borrado := database.Database.Delete(&solicitud)
+	if borrado.RowsAffected == 0 || time.Now().After(solicitud.ExpiraEn) {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "La solicitud de inicio de sesión expiró, intente nuevamente."})
+		return
+	}
+
+	proveedor, err := proveedorOidc(c.Request.Context())
+	if err != nil {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "El inicio de sesión externo no está disponible."})
+		return
+	}
+	identidad, err := proveedor.Intercambiar(c.Request.Context(), c.Query("code"), solicitud.Verificador, solicitud.Nonce)
+	if err != nil {
+		log.Println("OIDC - error al canjear el código:", err)
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "No se pudo validar la identidad con el proveedor."})
+		return
+	}
+	usuario, err := usuarioDesdeIdentidad(c, identidad)
+	if err != nil {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLoginOidc, ActorCorreo: identidad.Correo, Resultado: models.ResultadoFallo, Detalle: err.Error()})
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": err.Error()})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionLoginOidc, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoExito, Detalle: identidad.Emisor})
+	respuesta, err := respuestaLogin(c, usuario)
+	if err != nil {
+		redirigirFrontendOidc(c, gin.H{"estado": "error", "mensaje": "Ocurrió un error al intentar generar el token"})
+		return
+	}
+	redirigirFrontendOidc(c, respuesta)
+}
+
+// usuarioDesdeIdentidad busca el usuario vinculado a la identidad externa; si no existe
+// vincula (o crea) la cuenta con el mismo correo, siempre que el proveedor lo haya verificado.
+func usuarioDesdeIdentidad(c *gin.Context, identidad oidc.Identidad) (models.Usuario, error) {
+	usuario := models.Usuario{}
+	vinculo := models.IdentidadExterna{}
+	if err := database.Database.Where(&models.IdentidadExterna{Emisor: identidad.Emisor, Sujeto: identidad.Sujeto}).First(&vinculo).Error; err == nil {
+		if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, vinculo.UsuarioID).Error; err != nil {
+			return usuario, errors.New("La cuenta vinculada no está activa.")
+		}
+		return usuario, nil
+	}
+
+	correo := strings.ToLower(strings.TrimSpace(identidad.Correo))
+	if !identidad.CorreoVerificado || validaciones.Regex_correo.FindStringSubmatch(correo) == nil {
+		return usuario, errors.New("El proveedor no confirmó un correo verificado.")
+	}
+
+	existentes := models.Usuarios{}
+	database.Database.Where(&models.Usuario{Correo: correo}).Find(&existentes)
+	if len(existentes) > 0 {
+		usuario = existentes[0]
+		switch usuario.EstadoID {
+		case models.EstadoActivo:
+		case models.EstadoPendiente:
+			// El proveedor ya verificó el correo: activamos la cuenta pendiente. Quien la
+			// registró nunca probó ser dueño del correo, así que descartamos su contraseña
+			// y cualquier enlace o sesión que haya quedado a su nombre.
+			if err := reclamarCuentaPendiente(&usuario); err != nil {
+				return usuario, err
+			}
+			auditar(c, models.EventoAuditoria{Accion: models.AccionCuentaReclamadaOidc, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Objetivo: "usuario:" + strconv.FormatUint(uint64(usuario.ID), 10), Resultado: models.ResultadoExito, Detalle: identidad.Emisor})
+		default:
+			return usuario, errors.New("La cuenta asociada a este correo no está activa.")
+		}
+	} else {
+		// Cuenta nueva sin contraseña utilizable (puede definir una con olvide-password)
+		hash, err := passwordInutilizable()
+		if err != nil {
+			return usuario, err
+		}
+		nombre := strings.TrimSpace(identidad.Nombre)
+		if nombre == "" {
+			nombre = strings.Split(correo, "@")[0]
+		}
+		usuario = models.Usuario{
+			Nombre:   nombre,
+			Correo:   correo,
+			Password: hash,
+			EstadoID: models.EstadoActivo,
+			Rol:      models.RolAutor,
+			Fecha:    time.Now(),
+		}
+		if err := database.Database.Create(&usuario).Error; err != nil {
+			return usuario, err
+		}
+	}
+
+	vinculo = models.IdentidadExterna{
+		UsuarioID: usuario.ID,
+		Emisor:    identidad.Emisor,
+		Sujeto:    identidad.Sujeto,
+		Correo:    correo,
+		Fecha:     time.Now(),
+	}
+	if err := database.Database.Create(&vinculo).Error; err != nil {
+		return usuario, err
+	}
+	return usuario, nil
+}
+
+// reclamarCuentaPendiente activa una cuenta pendiente cuyo correo verificó el proveedor.
+// La contraseña pasa a ser aleatoria y se invalidan los enlaces de recuperación, los
+// enlaces mágicos y las sesiones, para que quien registró el correo no conserve acceso.
+func reclamarCuentaPendiente(usuario *models.Usuario) error {
+	hash, err := passwordInutilizable()
+	if err != nil {
+		return err
+	}
+	ahora := time.Now()
+	err = database.Database.Transaction(func(tx *gorm.DB) error {
+		usuario.EstadoID = models.EstadoActivo
+		usuario.Password = hash
+		usuario.Token = ""
+		usuario.TokenExpira = nil
+		usuario.CorreoPendiente = ""
+		if err := tx.Save(usuario).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RecuperacionPassword{}).Where("usuario_id = ? AND usado_en IS NULL", usuario.ID).Update("usado_en", ahora).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EnlaceMagico{}).Where("usuario_id = ? AND usado_en IS NULL", usuario.ID).Update("usado_en", ahora).Error
+	})
+	if err != nil {
+		return err
+	}
+	return revocarSesionesUsuario(usuario.ID)
+}
+
+// passwordInutilizable genera el hash de una contraseña aleatoria que nadie conoce
+func passwordInutilizable() (string, error) {
+	aleatorio, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		return "", err
+	}
+	return password.Generar(aleatorio)
+}
+
+// proveedorOidc descubre el proveedor configurado la primera vez que se usa
+func proveedorOidc(ctx context.Context) (*oidc.Proveedor, error) {
+	proveedorMu.Lock()
+	defer proveedorMu.Unlock()
+	if proveedorActual != nil {
+		return proveedorActual, nil
+	}
+	cfg, ok := oidc.ConfiguracionDesdeEntorno()
+	if !ok {
+		return nil, errors.New("faltan OIDC_EMISOR, OIDC_CLIENT_ID u OIDC_REDIRECT_URL")
+	}
+	proveedor, err := oidc.NuevoProveedor(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	proveedorActual = proveedor
+	return proveedorActual, nil
+}
+
+// redirigirFrontendOidc devuelve el resultado al frontend en el fragmento de la URL
+// (#...), que el navegador no envía a ningún servidor ni guarda en los logs
+func redirigirFrontendOidc(c *gin.Context, datos gin.H) {
+	destino := os.Getenv("OIDC_RUTA_FRONTEND")
+	if destino == "" {
+		destino = os.Getenv("RUTA_FRONTEND") + "/oidc/callback"
+	}
+	fragmento := url.Values{}
+	for clave, valor := range datos {
+		fragmento.Set(clave, fmt.Sprint(valor))
+	}
+	c.Redirect(http.StatusFound, destino+"#"+fragmento.Encode())
+}
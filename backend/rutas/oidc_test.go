@@ -0,0 +1,191 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/oidc/oidctest"
+	"backend/utilidades"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// configurarOidcPrueba inicia el proveedor simulado y lo configura como OIDC_EMISOR
+func configurarOidcPrueba(t *testing.T) *oidctest.Proveedor {
+	t.Helper()
+	simulado, err := oidctest.Nuevo("cliente-recetas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(simulado.Cerrar)
+	t.Setenv("OIDC_EMISOR", simulado.Emisor())
+	t.Setenv("OIDC_CLIENT_ID", "cliente-recetas")
+	t.Setenv("OIDC_REDIRECT_URL", "https://recetas.example/api/v1/seguridad/oidc/callback")
+	t.Setenv("OIDC_RUTA_FRONTEND", "https://recetas.example/oidc/callback")
+	// El proveedor se descubre una vez; cada prueba usa el suyo
+	proveedorMu.Lock()
+	proveedorActual = nil
+	proveedorMu.Unlock()
+	t.Cleanup(func() {
+		proveedorMu.Lock()
+		proveedorActual = nil
+		proveedorMu.Unlock()
+	})
+	baseDatosPrueba(t, &models.SolicitudOidc{}, &models.IdentidadExterna{}, &models.RecuperacionPassword{}, &models.EnlaceMagico{},
+		&models.RefreshToken{}, &models.TokenRevocado{}, &models.Sesion{})
+	return simulado
+}
+
+// iniciarOidcPrueba guarda la solicitud que Oidc_login crearía para el state indicado
+func iniciarOidcPrueba(t *testing.T, estado string) {
+	t.Helper()
+	solicitud := models.SolicitudOidc{
+		EstadoHash:  utilidades.HashToken(estado),
+		Nonce:       "nonce-" + estado,
+		Verificador: "verificador-" + estado,
+		ExpiraEn:    time.Now().Add(duracionSolicitudOidc),
+	}
+	if err := database.Database.Create(&solicitud).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// callbackOidcPrueba vuelve del proveedor con el state y el código, enviando la cookie
+// si no es vacía, y devuelve el fragmento de la redirección al frontend
+func callbackOidcPrueba(t *testing.T, estado, cookie, codigo string) url.Values {
+	t.Helper()
+	grabador := solicitudPrueba(t, Oidc_callback, nil, nil, func(c *gin.Context) {
+		c.Request.URL.RawQuery = url.Values{"state": {estado}, "code": {codigo}}.Encode()
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: cookieOidc, Value: cookie})
+		}
+	})
+	// Fuera del router el código 302 no llega al grabador: basta con el Location
+	destino, err := url.Parse(grabador.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(destino.String(), "https://recetas.example/oidc/callback#") {
+		t.Fatalf("redirección: %q", grabador.Header().Get("Location"))
+	}
+	fragmento, err := url.ParseQuery(destino.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fragmento
+}
+
+// autorizarOidcPrueba devuelve un código del proveedor para la identidad indicada
+func autorizarOidcPrueba(t *testing.T, simulado *oidctest.Proveedor, estado, sujeto, correo string, verificado bool) string {
+	t.Helper()
+	claims := simulado.Claims(sujeto, correo, "nonce-"+estado)
+	claims["email_verified"] = verificado
+	claims["name"] = "Ana Externa"
+	codigo, err := simulado.Autorizar(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return codigo
+}
+
+func TestOidcCallbackEstado(t *testing.T) {
+	simulado := configurarOidcPrueba(t)
+	iniciarOidcPrueba(t, "estado-1")
+	codigo := autorizarOidcPrueba(t, simulado, "estado-1", "sujeto-1", "ana@example.com", true)
+
+	casos := []struct {
+		nombre, estado, cookie string
+	}{
+		{"sin cookie", "estado-1", ""},
+		{"cookie de otro login", "estado-1", "estado-2"},
+		{"sin state", "", "estado-1"},
+		{"state sin solicitud", "estado-2", "estado-2"},
+	}
+	for _, caso := range casos {
+		if fragmento := callbackOidcPrueba(t, caso.estado, caso.cookie, codigo); fragmento.Get("estado") != "error" || fragmento.Get("token") != "" {
+			t.Errorf("%s: %v", caso.nombre, fragmento)
+		}
+	}
+	// Los rechazos no consumen la solicitud ni el código
+	var total int64
+	database.Database.Model(&models.SolicitudOidc{}).Count(&total)
+	if total != 1 || simulado.Verificador(codigo) != "" {
+		t.Fatalf("solicitudes %d, código canjeado %q", total, simulado.Verificador(codigo))
+	}
+
+	// Con la cookie correcta el login funciona una sola vez
+	if fragmento := callbackOidcPrueba(t, "estado-1", "estado-1", codigo); fragmento.Get("token") == "" {
+		t.Fatalf("login: %v", fragmento)
+	}
+	if verificador := simulado.Verificador(codigo); verificador != "verificador-estado-1" {
+		t.Errorf("code_verifier enviado: %q", verificador)
+	}
+	if fragmento := callbackOidcPrueba(t, "estado-1", "estado-1", codigo); fragmento.Get("estado") != "error" {
+		t.Fatalf("solicitud reutilizada: %v", fragmento)
+	}
+}
+
+func TestOidcCallbackVinculaCuentaExistente(t *testing.T) {
+	simulado := configurarOidcPrueba(t)
+	ana := crearUsuarioPrueba(t, "ana@example.com")
+
+	iniciarOidcPrueba(t, "estado-1")
+	fragmento := callbackOidcPrueba(t, "estado-1", "estado-1", autorizarOidcPrueba(t, simulado, "estado-1", "sujeto-1", "ANA@example.com", true))
+	if fragmento.Get("token") == "" || fragmento.Get("id") != fmt.Sprint(ana.ID) {
+		t.Fatalf("login: %v", fragmento)
+	}
+	vinculos := models.IdentidadesExternas{}
+	database.Database.Find(&vinculos)
+	if len(vinculos) != 1 || vinculos[0].UsuarioID != ana.ID || vinculos[0].Emisor != simulado.Emisor() || vinculos[0].Sujeto != "sujeto-1" {
+		t.Fatalf("vínculos: %+v", vinculos)
+	}
+	var usuarios int64
+	database.Database.Model(&models.Usuario{}).Count(&usuarios)
+	if usuarios != 1 {
+		t.Fatalf("se creó otra cuenta: %d usuarios", usuarios)
+	}
+
+	// Con el vínculo hecho se entra por el sujeto, aunque el proveedor cambie el correo
+	iniciarOidcPrueba(t, "estado-2")
+	fragmento = callbackOidcPrueba(t, "estado-2", "estado-2", autorizarOidcPrueba(t, simulado, "estado-2", "sujeto-1", "ana.nueva@example.com", false))
+	if fragmento.Get("id") != fmt.Sprint(ana.ID) {
+		t.Fatalf("segundo login: %v", fragmento)
+	}
+}
+
+func TestOidcCallbackCreaCuenta(t *testing.T) {
+	simulado := configurarOidcPrueba(t)
+
+	iniciarOidcPrueba(t, "estado-1")
+	fragmento := callbackOidcPrueba(t, "estado-1", "estado-1", autorizarOidcPrueba(t, simulado, "estado-1", "sujeto-1", "nueva@example.com", true))
+	if fragmento.Get("token") == "" {
+		t.Fatalf("login: %v", fragmento)
+	}
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{Correo: "nueva@example.com"}).First(&usuario).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fragmento.Get("id") != fmt.Sprint(usuario.ID) || usuario.EstadoID != models.EstadoActivo || usuario.Rol != models.RolAutor ||
+		usuario.Nombre != "Ana Externa" || usuario.Password == "" {
+		t.Fatalf("cuenta creada: %+v", usuario)
+	}
+	var vinculos int64
+	database.Database.Model(&models.IdentidadExterna{}).Where("usuario_id = ? AND sujeto = ?", usuario.ID, "sujeto-1").Count(&vinculos)
+	if vinculos != 1 {
+		t.Fatalf("vínculos: %d", vinculos)
+	}
+
+	// Sin correo verificado no se crea ni se vincula ninguna cuenta
+	iniciarOidcPrueba(t, "estado-2")
+	fragmento = callbackOidcPrueba(t, "estado-2", "estado-2", autorizarOidcPrueba(t, simulado, "estado-2", "sujeto-2", "otra@example.com", false))
+	if fragmento.Get("estado") != "error" || fragmento.Get("token") != "" {
+		t.Fatalf("correo sin verificar: %v", fragmento)
+	}
+	var usuarios int64
+	database.Database.Model(&models.Usuario{}).Count(&usuarios)
+	if usuarios != 1 {
+		t.Fatalf("usuarios: %d", usuarios)
+	}
+}
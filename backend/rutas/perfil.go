@@ -0,0 +1,249 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/middleware"
+	"backend/models"
+	"backend/password"
+	"backend/utilidades"
+	"backend/validaciones"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func Perfil_get(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  respuestaPerfil(usuario),
+	})
+}
+
+func Perfil_put(c *gin.Context) {
+	var body dto.PerfilDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Datos de entrada inválidos. Verifique que todos los campos requeridos estén completos y sean correctos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	nombre := strings.TrimSpace(body.Nombre)
+	if len(nombre) == 0 || len(nombre) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al actualizar el perfil.",
+			"errorOpcional": "El campo nombre es obligatorio y no puede superar los 100 caracteres",
+		})
+		return
+	}
+	correo := strings.TrimSpace(body.Correo)
+	if validaciones.Regex_correo.FindStringSubmatch(correo) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al actualizar el perfil.",
+			"errorOpcional": "El correo ingresado no es válido.",
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	cambios := []string{}
+	if nombre != usuario.Nombre {
+		if err := database.Database.Model(&usuario).Update("nombre", nombre).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al actualizar el perfil.",
+				"errorOpcional": err.Error(),
+			})
+			return
+		}
+		cambios = append(cambios, "tu nombre ahora es "+nombre)
+	}
+
+	// El correo nuevo queda pendiente hasta que se confirme con el enlace de verificación
+	if correo != usuario.Correo && correo != usuario.CorreoPendiente {
+		if correoEnUso(correo, usuario.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al actualizar el perfil.",
+				"errorOpcional": "El correo " + correo + " ya está registrado.",
+			})
+			return
+		}
+		token := uuid.New().String()
+		expira := time.Now().Add(duracionVerificacion())
+		if err := database.Database.Model(&usuario).Updates(models.Usuario{CorreoPendiente: correo, Token: token, TokenExpira: &expira}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"estado":        "error",
+				"mensaje":       "Ocurrió un error al actualizar el perfil.",
+				"errorOpcional": err.Error(),
+			})
+			return
+		}
+		enviarCorreoCambioCorreo(c, usuario.Nombre, correo, token)
+		auditar(c, models.EventoAuditoria{Accion: models.AccionCambioCorreo, Resultado: models.ResultadoExito, Detalle: "Pendiente de confirmar: " + correo})
+		cambios = append(cambios, "se solicitó cambiar tu correo a "+correo+" (se aplicará cuando se confirme desde esa dirección)")
+	} else if correo == usuario.Correo && len(usuario.CorreoPendiente) > 0 {
+		// Volver a enviar el correo actual cancela el cambio pendiente
+		database.Database.Model(&usuario).Updates(map[string]interface{}{"correo_pendiente": "", "token": "", "token_expira": nil})
+		cambios = append(cambios, "se canceló el cambio de correo pendiente")
+	}
+
+	if len(cambios) > 0 {
+		notificarCorreoActual(usuario, "Tu perfil fue modificado", "Se realizaron los siguientes cambios en tu cuenta: "+strings.Join(cambios, "; ")+".")
+	}
+	database.Database.First(&usuario, usuario.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Perfil actualizado correctamente",
+		"datos":   respuestaPerfil(usuario),
+	})
+}
+
+func Perfil_password(c *gin.Context) {
+	var body dto.CambiarPasswordDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Datos de entrada inválidos. Verifique que todos los campos requeridos estén completos y sean correctos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	if ok, _ := password.Verificar(usuario.Password, body.PasswordActual); !ok {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionCambioPassword, Resultado: models.ResultadoFallo, Detalle: "Contraseña actual incorrecta"})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al cambiar la contraseña.",
+			"errorOpcional": "La contraseña actual no es válida.",
+		})
+		return
+	}
+	if !passwordCumplePolitica(c, "Ocurrió un error al cambiar la contraseña.", body.Password, usuario.Correo, usuario.Nombre) {
+		return
+	}
+	hash, err := password.Generar(body.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al cambiar la contraseña.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if err := database.Database.Model(&usuario).Update("password", hash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al cambiar la contraseña.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	// Cerramos las demás sesiones; la actual sigue abierta
+	actual := models.Sesion{}
+	database.Database.Where("id = ?", c.GetUint("sid")).Limit(1).Find(&actual)
+	revocarSesionesExcepto(usuario.ID, actual.Familia)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCambioPassword, Resultado: models.ResultadoExito})
+
+	notificarCorreoActual(usuario, "Tu contraseña fue cambiada", "La contraseña de tu cuenta fue cambiada y se cerraron las sesiones en los demás dispositivos.")
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Contraseña actualizada correctamente",
+	})
+}
+
+// confirmarCambioCorreo aplica el correo pendiente cuando se abre el enlace enviado a la
+// nueva dirección (lo llama Seguridad_verificacion para usuarios ya activos)
+func confirmarCambioCorreo(c *gin.Context, usuario models.Usuario) {
+	anterior := usuario
+	if correoEnUso(usuario.CorreoPendiente, usuario.ID) {
+		database.Database.Model(&usuario).Updates(map[string]interface{}{"correo_pendiente": "", "token": "", "token_expira": nil})
+		c.JSON(http.StatusConflict, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al confirmar el correo.",
+			"errorOpcional": "El correo " + usuario.CorreoPendiente + " ya está registrado.",
+		})
+		return
+	}
+	err := database.Database.Model(&usuario).Updates(map[string]interface{}{
+		"correo":           usuario.CorreoPendiente,
+		"correo_pendiente": "",
+		"token":            "",
+		"token_expira":     nil,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al confirmar el correo.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionCambioCorreo, ActorID: actorAuditoria(anterior), ActorCorreo: anterior.Correo, Resultado: models.ResultadoExito, Detalle: "Confirmado: " + anterior.CorreoPendiente})
+	notificarCorreoActual(anterior, "Tu correo fue cambiado", "El correo de tu cuenta ahora es "+anterior.CorreoPendiente+". Esta dirección ya no recibirá avisos.")
+
+	// retornamos
+	c.Redirect(http.StatusMovedPermanently, os.Getenv("RUTA_FRONTEND"))
+}
+
+// correoEnUso indica si otro usuario ya tiene ese correo
+func correoEnUso(correo string, excepto uint) bool {
+	existe := models.Usuarios{}
+	database.Database.Where("correo = ? AND id <> ?", correo, excepto).Limit(1).Find(&existe)
+	return len(existe) > 0
+}
+
+// respuestaPerfil devuelve los datos del usuario que puede ver el propio usuario
+func respuestaPerfil(usuario models.Usuario) gin.H {
+	return gin.H{
+		"id":               usuario.ID,
+		"nombre":           usuario.Nombre,
+		"correo":           usuario.Correo,
+		"correo_pendiente": usuario.CorreoPendiente,
+		"rol":              usuario.Rol,
+		"totp_activo":      usuario.TotpActivo,
+		"fecha":            usuario.Fecha,
+		// Fecha de la baja si el usuario la pidió (se puede cancelar hasta entonces)
+		"eliminacion_programada": usuario.EliminacionProgramada,
+	}
+}
+
+// enviarCorreoCambioCorreo envía a la dirección nueva el enlace que confirma el cambio
+func enviarCorreoCambioCorreo(c *gin.Context, nombre, correo, token string) {
+	url := urlVerificacion(c, token)
+	var mensaje = "<h1>Confirma tu nuevo correo</h1>" +
+		"Hola " + nombre + ",<br><br>" +
+		"Para usar esta dirección en tu cuenta haz click en el siguiente enlace:<br>" +
+		"<a href='" + url + "'>" + url + "</a><br><br>" +
+		"El enlace vence en " + strconv.Itoa(int(duracionVerificacion().Hours())) + " horas.<br>" +
+		"Si no fuiste tú, ignora este correo."
+	// El enlace se arma antes con la petición; el envío no retrasa la respuesta
+	go func() {
+		if err := utilidades.EnviarCorreo(correo, "Confirma tu nuevo correo - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar correo de cambio de correo:", err)
+		}
+	}()
+}
+
+// notificarCorreoActual avisa al correo registrado de un cambio en la cuenta
+func notificarCorreoActual(usuario models.Usuario, asunto, detalle string) {
+	var mensaje = "<h1>" + asunto + "</h1>" +
+		"Hola " + usuario.Nombre + ",<br><br>" +
+		detalle + "<br><br>" +
+		"Si no fuiste tú, cambia tu contraseña de inmediato y contacta con el soporte."
+	go func(correo, nombre string) {
+		if err := utilidades.EnviarCorreo(correo, asunto+" - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar aviso de cambio en la cuenta:", err)
+		}
+	}(usuario.Correo, usuario.Nombre)
+}
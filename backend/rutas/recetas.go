@@ -1,9 +1,12 @@
 package rutas
 
 import (
+	"backend/cocina"
 	"backend/database"
 	"backend/dto"
+	"backend/middleware"
 	"backend/models"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,11 +18,12 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gosimple/slug"
+	"gorm.io/gorm"
 )
 
 func Receta_get(c *gin.Context) {
 	var recetas []models.Receta
-	result := database.Database.Preload("Categoria").Preload("Usuario").Find(&recetas)
+	result := database.Database.Scopes(preloadReceta).Find(&recetas)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":  "error",
@@ -37,35 +41,7 @@ func Receta_get(c *gin.Context) {
 	baseURL := schema + "://" + c.Request.Host
 
 	for _, r := range recetas {
-		fecha := ""
-		if !r.Fecha.IsZero() {
-			fecha = r.Fecha.Format("02/01/2006")
-		}
-
-		// Validación segura de relaciones que pueden ser nil
-		categoriaNombre := ""
-		if r.Categoria != nil {
-			categoriaNombre = r.Categoria.Nombre
-		}
-
-		usuarioNombre := ""
-		if r.Usuario != nil {
-			usuarioNombre = r.Usuario.Nombre
-		}
-
-		respuestas = append(respuestas, dto.RecetaResponse{
-			Id:          r.ID,
-			Nombre:      r.Nombre,
-			Slug:        r.Slug,
-			CategoriaId: r.CategoriaID,
-			Categoria:   categoriaNombre,
-			UsuarioId:   r.UsuarioID,
-			Usuario:     usuarioNombre,
-			Tiempo:      r.Tiempo,
-			Foto:        baseURL + "/public/recetas/" + r.Foto,
-			Descripcion: r.Descripcion,
-			Fecha:       fecha,
-		})
+		respuestas = append(respuestas, respuestaReceta(r, baseURL))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -76,8 +52,12 @@ func Receta_get(c *gin.Context) {
 
 func Receta_getId(c *gin.Context) {
 	id := c.Param("id")
+	sistema, ok := sistemaUnidades(c)
+	if !ok {
+		return
+	}
 	var receta models.Receta
-	result := database.Database.Preload("Categoria").Preload("Usuario").First(&receta, id)
+	result := database.Database.Scopes(preloadReceta).First(&receta, id)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"estado":  "error",
@@ -93,35 +73,8 @@ func Receta_getId(c *gin.Context) {
 	}
 	baseURL := schema + "://" + c.Request.Host
 
-	fecha := ""
-	if !receta.Fecha.IsZero() {
-		fecha = receta.Fecha.Format("02/01/2006")
-	}
-
-	// Validación segura de relaciones que pueden ser nil
-	categoriaNombre := ""
-	if receta.Categoria != nil {
-		categoriaNombre = receta.Categoria.Nombre
-	}
-
-	usuarioNombre := ""
-	if receta.Usuario != nil {
-		usuarioNombre = receta.Usuario.Nombre
-	}
-
-	respuesta := dto.RecetaResponse{
-		Id:          receta.ID,
-		Nombre:      receta.Nombre,
-		Slug:        receta.Slug,
-		CategoriaId: receta.CategoriaID,
-		Categoria:   categoriaNombre,
-		UsuarioId:   receta.UsuarioID,
-		Usuario:     usuarioNombre,
-		Tiempo:      receta.Tiempo,
-		Foto:        baseURL + "/public/recetas/" + receta.Foto,
-		Descripcion: receta.Descripcion,
-		Fecha:       fecha,
-	}
+	respuesta := respuestaReceta(receta, baseURL)
+	convertirReceta(&respuesta, sistema)
 
 	c.JSON(http.StatusOK, gin.H{
 		"estado": "ok",
@@ -130,7 +83,8 @@ func Receta_getId(c *gin.Context) {
 }
 
 // validateRecetaForm valida los campos del formulario y devuelve el mapa de errores
-// y un objeto models.Receta con los campos ya parseados (sin Foto, Slug ni Fecha).
+// y un objeto models.Receta con los campos ya parseados, incluidos ingredientes y pasos
+// (sin Foto, Slug, Fecha ni UsuarioID: el autor siempre es el usuario autenticado).
 func validateRecetaForm(c *gin.Context) (map[string][]string, models.Receta) {
 	errorValidacion := map[string][]string{}
 	const (
@@ -141,7 +95,6 @@ func validateRecetaForm(c *gin.Context) (map[string][]string, models.Receta) {
 
 	nombre := strings.TrimSpace(c.PostForm("nombre"))
 	categoriaStr := strings.TrimSpace(c.PostForm("categoria_id"))
-	usuarioStr := strings.TrimSpace(c.PostForm("usuario_id"))
 	tiempo := strings.TrimSpace(c.PostForm("tiempo"))
 	descripcion := strings.TrimSpace(c.PostForm("descripcion"))
 
@@ -164,24 +117,22 @@ func validateRecetaForm(c *gin.Context) (map[string][]string, models.Receta) {
 		}
 	}
 
-	// usuario_id: obligatorio y numérico (>0)
-	var usuarioID uint64
-	if usuarioStr == "" {
-		errorValidacion["usuario_id"] = append(errorValidacion["usuario_id"], "El campo usuario_id es obligatorio")
-	} else {
-		if val, err := strconv.ParseUint(usuarioStr, 10, 64); err != nil || val == 0 {
-			errorValidacion["usuario_id"] = append(errorValidacion["usuario_id"], "usuario_id debe ser un número entero positivo válido")
-		} else {
-			usuarioID = val
-		}
-	}
-
-	// tiempo: obligatorio y límite de caracteres
-	if tiempo == "" {
-		errorValidacion["tiempo"] = append(errorValidacion["tiempo"], "El campo tiempo es obligatorio")
-	} else if utf8.RuneCountInString(tiempo) > maxTiempo {
+	// tiempo: límite de caracteres; los minutos se validan junto con tiempo_* más abajo
+	if utf8.RuneCountInString(tiempo) > maxTiempo {
 		errorValidacion["tiempo"] = append(errorValidacion["tiempo"], fmt.Sprintf("El campo tiempo no debe exceder %d caracteres", maxTiempo))
 	}
+	// tiempo_preparacion, tiempo_coccion y tiempo_reposo: opcionales, en minutos
+	minutos := map[string]*int{}
+	for _, campo := range []string{"tiempo_preparacion", "tiempo_coccion", "tiempo_reposo"} {
+		if valor := strings.TrimSpace(c.PostForm(campo)); valor != "" {
+			val, err := strconv.Atoi(valor)
+			if err != nil {
+				errorValidacion[campo] = append(errorValidacion[campo], campo+" debe ser un número entero de minutos")
+				continue
+			}
+			minutos[campo] = &val
+		}
+	}
 
 	// descripcion: obligatorio y límite de caracteres
 	if descripcion == "" {
@@ -190,13 +141,40 @@ func validateRecetaForm(c *gin.Context) (map[string][]string, models.Receta) {
 		errorValidacion["descripcion"] = append(errorValidacion["descripcion"], fmt.Sprintf("El campo descripcion no debe exceder %d caracteres", maxDescripcion))
 	}
 
+	// porciones: opcional, entero entre 1 y maxPorciones
+	var porciones int
+	if valor := strings.TrimSpace(c.PostForm("porciones")); valor != "" {
+		if val, err := strconv.Atoi(valor); err != nil || val < 1 || val > maxPorciones {
+			errorValidacion["porciones"] = append(errorValidacion["porciones"], fmt.Sprintf("porciones debe ser un número entero entre 1 y %d", maxPorciones))
+		} else {
+			porciones = val
+		}
+	}
+
+	// ingredientes y pasos: opcionales, cada uno como una lista JSON en su campo
+	var ingredientes []dto.IngredienteDto
+	if valor := strings.TrimSpace(c.PostForm("ingredientes")); valor != "" {
+		if err := json.Unmarshal([]byte(valor), &ingredientes); err != nil {
+			errorValidacion["ingredientes"] = append(errorValidacion["ingredientes"], "El campo ingredientes debe ser una lista JSON válida")
+		}
+	}
+	var pasos []dto.PasoDto
+	if valor := strings.TrimSpace(c.PostForm("pasos")); valor != "" {
+		if err := json.Unmarshal([]byte(valor), &pasos); err != nil {
+			errorValidacion["pasos"] = append(errorValidacion["pasos"], "El campo pasos debe ser una lista JSON válida")
+		}
+	}
+	filasIngredientes, filasPasos := validarIngredientesPasos(errorValidacion, ingredientes, pasos)
+
 	receta := models.Receta{
-		CategoriaID: uint(categoriaID),
-		UsuarioID:   uint(usuarioID),
-		Nombre:      nombre,
-		Tiempo:      tiempo,
-		Descripcion: descripcion,
+		CategoriaID:  uint(categoriaID),
+		Nombre:       nombre,
+		Descripcion:  descripcion,
+		Porciones:    porciones,
+		Ingredientes: filasIngredientes,
+		Pasos:        filasPasos,
 	}
+	aplicarTiempos(errorValidacion, &receta, tiempo, minutos["tiempo_preparacion"], minutos["tiempo_coccion"], minutos["tiempo_reposo"])
 
 	return errorValidacion, receta
 }
@@ -243,13 +221,12 @@ func Receta_post(c *gin.Context) {
 		return
 	}
 
-	// Validamos que exista el usuario por id
-	usuarioExiste := models.Usuario{}
-	if err := database.Database.First(&usuarioExiste, recetaVal.UsuarioID); err.Error != nil {
-		c.JSON(http.StatusNotFound, gin.H{
+	// El autor de la receta es el usuario autenticado, nunca un campo del formulario
+	usuario, ok := middleware.UsuarioActual(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
 			"estado":  "error",
-			"mensaje": "Recurso no disponible",
-			"error":   "El usuario especificado no existe",
+			"mensaje": "No autorizado",
 		})
 		return
 	}
@@ -283,16 +260,35 @@ func Receta_post(c *gin.Context) {
 
 	// Creamos el registro con los valores ya validados y parseados
 	receta := models.Receta{
-		CategoriaID: recetaVal.CategoriaID,
-		UsuarioID:   recetaVal.UsuarioID,
-		Nombre:      recetaVal.Nombre,
-		Slug:        slug.Make(recetaVal.Nombre),
-		Tiempo:      recetaVal.Tiempo,
-		Foto:        foto,
-		Descripcion: recetaVal.Descripcion,
-		Fecha:       time.Now(),
+		CategoriaID:       recetaVal.CategoriaID,
+		UsuarioID:         usuario.ID,
+		Nombre:            recetaVal.Nombre,
+		Slug:              slug.Make(recetaVal.Nombre),
+		Tiempo:            recetaVal.Tiempo,
+		TiempoPreparacion: recetaVal.TiempoPreparacion,
+		TiempoCoccion:     recetaVal.TiempoCoccion,
+		TiempoReposo:      recetaVal.TiempoReposo,
+		TiempoTotal:       recetaVal.TiempoTotal,
+		Foto:              foto,
+		Descripcion:       recetaVal.Descripcion,
+		Porciones:         recetaVal.Porciones,
+		Ingredientes:      recetaVal.Ingredientes,
+		Pasos:             recetaVal.Pasos,
+		Fecha:             time.Now(),
+	}
+	// Save crea también los ingredientes y pasos asociados
+	if err := database.Database.Save(&receta).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "No se pudo crear el registro",
+			"error":   err.Error(),
+		})
+		return
+	}
+	// Si el cálculo falla la receta queda creada; se calculará al consultar sus nutrientes
+	if _, err := recalcularNutricion(database.Database, receta.ID, receta.Ingredientes); err != nil {
+		log.Println("Crear receta - no se pudieron calcular los nutrientes:", err)
 	}
-	database.Database.Save(&receta)
 
 	// retornamos
 	c.JSON(http.StatusCreated, gin.H{
@@ -328,17 +324,74 @@ func Receta_put(c *gin.Context) {
 		})
 		return
 	}
+	if !puedeGestionarReceta(c, receta) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"estado":  "error",
+			"mensaje": "No tiene permisos para gestionar esta receta",
+		})
+		return
+	}
+
+	// Validamos las listas que vengan (las omitidas se conservan)
+	errorValidacion := map[string][]string{}
+	var ingredientes []dto.IngredienteDto
+	if body.Ingredientes != nil {
+		ingredientes = *body.Ingredientes
+	}
+	var pasos []dto.PasoDto
+	if body.Pasos != nil {
+		pasos = *body.Pasos
+	}
+	filasIngredientes, filasPasos := validarIngredientesPasos(errorValidacion, ingredientes, pasos)
+	// porciones: 0 indica que la receta no dice cuántas porciones rinde
+	if body.Porciones != nil && (*body.Porciones < 0 || *body.Porciones > maxPorciones) {
+		errorValidacion["porciones"] = append(errorValidacion["porciones"], fmt.Sprintf("porciones debe ser un número entero entre 0 y %d", maxPorciones))
+	}
+	aplicarTiempos(errorValidacion, &receta, strings.TrimSpace(body.Tiempo), body.TiempoPreparacion, body.TiempoCoccion, body.TiempoReposo)
+	if len(errorValidacion) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": errorValidacion,
+		})
+		return
+	}
 
 	// Actualizamos solo los campos necesarios con Updates (no toca created_at)
 	updates := map[string]interface{}{
-		"nombre":       body.Nombre,
-		"slug":         slug.Make(body.Nombre),
-		"tiempo":       body.Tiempo,
-		"descripcion":  body.Descripcion,
-		"categoria_id": body.CategoriaId,
+		"nombre":             body.Nombre,
+		"slug":               slug.Make(body.Nombre),
+		"tiempo":             receta.Tiempo,
+		"tiempo_preparacion": receta.TiempoPreparacion,
+		"tiempo_coccion":     receta.TiempoCoccion,
+		"tiempo_reposo":      receta.TiempoReposo,
+		"tiempo_total":       receta.TiempoTotal,
+		"descripcion":        body.Descripcion,
+		"categoria_id":       body.CategoriaId,
+	}
+	if body.Porciones != nil {
+		updates["porciones"] = *body.Porciones
 	}
 
-	if err := database.Database.Model(&receta).Updates(updates).Error; err != nil {
+	err := database.Database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&receta).Updates(updates).Error; err != nil {
+			return err
+		}
+		if body.Ingredientes != nil {
+			if err := reemplazarIngredientes(tx, receta.ID, filasIngredientes); err != nil {
+				return err
+			}
+			if _, err := recalcularNutricion(tx, receta.ID, filasIngredientes); err != nil {
+				return err
+			}
+		}
+		if body.Pasos != nil {
+			if err := reemplazarPasos(tx, receta.ID, filasPasos); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":  "error",
 			"mensaje": "No se pudo actualizar el registro",
@@ -369,6 +422,14 @@ func Receta_delete(c *gin.Context) {
 		})
 		return
 	}
+	if !puedeGestionarReceta(c, dato) {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionRecetaEliminar, Objetivo: "receta:" + id, Resultado: models.ResultadoDenegado, Detalle: "No es el autor de la receta"})
+		c.JSON(http.StatusForbidden, gin.H{
+			"estado":  "error",
+			"mensaje": "No tiene permisos para gestionar esta receta",
+		})
+		return
+	}
 	// Borramos la foto
 	borrar := "public/recetas/" + dato.Foto
 	e := os.Remove(borrar)
@@ -377,9 +438,356 @@ func Receta_delete(c *gin.Context) {
 	}
 	// Eliminamos registro
 	database.Database.Delete(&dato)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionRecetaEliminar, Objetivo: "receta:" + id, Resultado: models.ResultadoExito, Detalle: dato.Nombre})
 	// retornamos
 	c.JSON(http.StatusOK, gin.H{
 		"estado":  "Ok",
 		"mensaje": "Registro eliminado correctamente",
 	})
 }
+
+// puedeGestionarReceta indica si el usuario autenticado puede modificar la receta:
+// admin y editor gestionan todas, author solo las propias.
+func puedeGestionarReceta(c *gin.Context, receta models.Receta) bool {
+	usuario, ok := middleware.UsuarioActual(c)
+	if !ok {
+		return false
+	}
+	rol := c.GetString("rol")
+	if rol == models.RolAdmin || rol == models.RolEditor {
+		return true
+	}
+	return receta.UsuarioID == usuario.ID
+}
+
+// maxPorciones es el máximo de porciones de una receta y al escalarla
+const maxPorciones = 100
+
+func Receta_escalar(c *gin.Context) {
+	id := c.Param("id")
+	sistema, ok := sistemaUnidades(c)
+	if !ok {
+		return
+	}
+	porciones, err := strconv.Atoi(c.Query("porciones"))
+	if err != nil || porciones < 1 || porciones > maxPorciones {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": fmt.Sprintf("El parámetro porciones debe ser un número entero entre 1 y %d", maxPorciones),
+		})
+		return
+	}
+	var receta models.Receta
+	result := database.Database.Scopes(preloadReceta).First(&receta, id)
+	if result.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   result.Error.Error(),
+		})
+		return
+	}
+	if receta.Porciones <= 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"estado":  "error",
+			"mensaje": "La receta no indica cuántas porciones rinde, no se puede escalar",
+		})
+		return
+	}
+
+	factor := float64(porciones) / float64(receta.Porciones)
+	ingredientes := make([]dto.IngredienteEscaladoResponse, 0, len(receta.Ingredientes))
+	for _, i := range receta.Ingredientes {
+		escalado := dto.IngredienteEscaladoResponse{
+			IngredienteResponse: dto.IngredienteResponse{
+				Cantidad:         i.Cantidad,
+				Unidad:           i.Unidad,
+				Nombre:           i.Nombre,
+				Nota:             i.Nota,
+				Grupo:            i.Grupo,
+				CantidadOriginal: i.Cantidad,
+			},
+		}
+		// "sal al gusto", "una pizca" y similares se dejan como están
+		if cocina.EsEscalable(i.Cantidad, i.Unidad, i.Nombre, i.Nota) {
+			escalado.Cantidad, escalado.Escalado = cocina.EscalarTexto(i.Cantidad, factor)
+		}
+		// La conversión se hace sobre la cantidad ya escalada
+		if sistema != "" {
+			convertirIngrediente(&escalado.IngredienteResponse, sistema)
+		}
+		ingredientes = append(ingredientes, escalado)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos": gin.H{
+			"id":                   receta.ID,
+			"nombre":               receta.Nombre,
+			"slug":                 receta.Slug,
+			"porciones_originales": receta.Porciones,
+			"porciones":            porciones,
+			"factor":               factor,
+			"ingredientes":         ingredientes,
+		},
+	})
+}
+
+// preloadReceta carga las relaciones que se devuelven con cada receta, con los
+// ingredientes y pasos en su orden
+func preloadReceta(db *gorm.DB) *gorm.DB {
+	return db.Preload("Categoria").Preload("Usuario").
+		Preload("Ingredientes", func(db *gorm.DB) *gorm.DB { return db.Order("orden, id") }).
+		Preload("Pasos", func(db *gorm.DB) *gorm.DB { return db.Order("numero, id") })
+}
+
+// respuestaReceta arma el dto.RecetaResponse de una receta cargada con preloadReceta
+func respuestaReceta(r models.Receta, baseURL string) dto.RecetaResponse {
+	fecha := ""
+	if !r.Fecha.IsZero() {
+		fecha = r.Fecha.Format("02/01/2006")
+	}
+
+	// Validación segura de relaciones que pueden ser nil
+	categoriaNombre := ""
+	if r.Categoria != nil {
+		categoriaNombre = r.Categoria.Nombre
+	}
+
+	usuarioNombre := ""
+	if r.Usuario != nil {
+		usuarioNombre = r.Usuario.Nombre
+	}
+
+	ingredientes := make([]dto.IngredienteResponse, 0, len(r.Ingredientes))
+	for _, i := range r.Ingredientes {
+		ingredientes = append(ingredientes, dto.IngredienteResponse{
+			Cantidad: i.Cantidad,
+			Unidad:   i.Unidad,
+			Nombre:   i.Nombre,
+			Nota:     i.Nota,
+			Grupo:    i.Grupo,
+		})
+	}
+	pasos := make([]dto.PasoResponse, 0, len(r.Pasos))
+	for _, p := range r.Pasos {
+		pasos = append(pasos, dto.PasoResponse{Numero: p.Numero, Texto: p.Texto})
+	}
+
+	return dto.RecetaResponse{
+		Id:                r.ID,
+		Nombre:            r.Nombre,
+		Slug:              r.Slug,
+		CategoriaId:       r.CategoriaID,
+		Categoria:         categoriaNombre,
+		UsuarioId:         r.UsuarioID,
+		Usuario:           usuarioNombre,
+		Tiempo:            r.Tiempo,
+		TiempoPreparacion: r.TiempoPreparacion,
+		TiempoCoccion:     r.TiempoCoccion,
+		TiempoReposo:      r.TiempoReposo,
+		TiempoTotal:       r.TiempoTotal,
+		Foto:              baseURL + "/public/recetas/" + r.Foto,
+		Descripcion:       r.Descripcion,
+		Porciones:         r.Porciones,
+		Ingredientes:      ingredientes,
+		Pasos:             pasos,
+		Fecha:             fecha,
+	}
+}
+
+// maxMinutos es el máximo de cada tiempo de la receta (una semana)
+const maxMinutos = 7 * 24 * 60
+
+// aplicarTiempos deja en la receta los tiempos en minutos que vengan (los nil
+// conservan el valor de la receta). Si no viene ninguno y el texto tiempo cambió, lo
+// interpreta como tiempo de preparación. El total se recalcula y el texto tiempo
+// pasa a ser ese total escrito ("1 h 30 min"); los problemas se agregan a errorValidacion.
+func aplicarTiempos(errorValidacion map[string][]string, receta *models.Receta, tiempo string, preparacion, coccion, reposo *int) {
+	campos := []struct {
+		nombre  string
+		valor   *int
+		destino *int
+	}{
+		{"tiempo_preparacion", preparacion, &receta.TiempoPreparacion},
+		{"tiempo_coccion", coccion, &receta.TiempoCoccion},
+		{"tiempo_reposo", reposo, &receta.TiempoReposo},
+	}
+	recibidos := 0
+	for _, campo := range campos {
+		if campo.valor == nil {
+			continue
+		}
+		recibidos++
+		if *campo.valor < 0 || *campo.valor > maxMinutos {
+			errorValidacion[campo.nombre] = append(errorValidacion[campo.nombre], fmt.Sprintf("%s debe estar entre 0 y %d minutos", campo.nombre, maxMinutos))
+			continue
+		}
+		*campo.destino = *campo.valor
+	}
+
+	switch {
+	case recibidos > 0:
+	case tiempo != "" && tiempo != receta.Tiempo:
+		minutos, ok := cocina.ParsearDuracion(tiempo)
+		if !ok {
+			errorValidacion["tiempo"] = append(errorValidacion["tiempo"], "El campo tiempo debe indicar una duración, por ejemplo \"45 min\" o \"1 h 30 min\"")
+			return
+		}
+		receta.TiempoPreparacion, receta.TiempoCoccion, receta.TiempoReposo = minutos, 0, 0
+	case receta.Tiempo == "":
+		errorValidacion["tiempo"] = append(errorValidacion["tiempo"], "Indique el tiempo o los minutos de preparación, cocción y reposo")
+		return
+	}
+
+	receta.TiempoTotal = receta.TiempoPreparacion + receta.TiempoCoccion + receta.TiempoReposo
+	if receta.TiempoTotal > 0 {
+		receta.Tiempo = cocina.FormatearDuracion(receta.TiempoTotal)
+	} else if recibidos > 0 {
+		errorValidacion["tiempo"] = append(errorValidacion["tiempo"], "La suma de los tiempos debe ser mayor que 0")
+	}
+}
+
+// sistemaUnidades lee el parámetro opcional ?unidades=metric|imperial. Si el valor
+// no es válido responde 400 y devuelve false; sin parámetro devuelve "".
+func sistemaUnidades(c *gin.Context) (cocina.Sistema, bool) {
+	valor := c.Query("unidades")
+	if valor == "" {
+		return "", true
+	}
+	sistema, ok := cocina.ParsearSistema(valor)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El parámetro unidades debe ser metric o imperial",
+		})
+		return "", false
+	}
+	return sistema, true
+}
+
+// convertirReceta pasa los ingredientes y las temperaturas de los pasos al sistema
+// de unidades pedido. Solo cambia la respuesta: lo guardado queda como lo escribió el autor.
+func convertirReceta(respuesta *dto.RecetaResponse, sistema cocina.Sistema) {
+	if sistema == "" {
+		return
+	}
+	for i := range respuesta.Ingredientes {
+		convertirIngrediente(&respuesta.Ingredientes[i], sistema)
+	}
+	for i := range respuesta.Pasos {
+		respuesta.Pasos[i].Texto = cocina.ConvertirTemperaturasTexto(respuesta.Pasos[i].Texto, sistema)
+	}
+}
+
+// convertirIngrediente convierte la cantidad y la unidad de un ingrediente y guarda
+// las originales; si no se puede convertir lo deja igual
+func convertirIngrediente(ingrediente *dto.IngredienteResponse, sistema cocina.Sistema) {
+	cantidad, unidad, ok := cocina.ConvertirCantidad(ingrediente.Cantidad, ingrediente.Unidad, ingrediente.Nombre, sistema)
+	if !ok {
+		return
+	}
+	if ingrediente.CantidadOriginal == "" {
+		ingrediente.CantidadOriginal = ingrediente.Cantidad
+	}
+	ingrediente.UnidadOriginal = ingrediente.Unidad
+	ingrediente.Cantidad = cantidad
+	ingrediente.Unidad = unidad
+	ingrediente.Convertido = true
+}
+
+// validarIngredientesPasos valida las listas recibidas, agrega los problemas a
+// errorValidacion y devuelve las filas listas para guardar (orden y número según
+// la posición en la lista)
+func validarIngredientesPasos(errorValidacion map[string][]string, ingredientes []dto.IngredienteDto, pasos []dto.PasoDto) (models.Ingredientes, models.Pasos) {
+	const (
+		maxIngredientes = 100
+		maxPasos        = 50
+		maxCantidad     = 30
+		maxUnidad       = 30
+		maxNombre       = 100
+		maxNota         = 255
+		maxGrupo        = 100
+		maxTexto        = 1000
+	)
+	if len(ingredientes) > maxIngredientes {
+		errorValidacion["ingredientes"] = append(errorValidacion["ingredientes"], fmt.Sprintf("La receta no puede tener más de %d ingredientes", maxIngredientes))
+	}
+	if len(pasos) > maxPasos {
+		errorValidacion["pasos"] = append(errorValidacion["pasos"], fmt.Sprintf("La receta no puede tener más de %d pasos", maxPasos))
+	}
+
+	filasIngredientes := make(models.Ingredientes, 0, len(ingredientes))
+	for i, ingrediente := range ingredientes {
+		campo := fmt.Sprintf("ingredientes[%d]", i)
+		fila := models.Ingrediente{
+			Orden:    i + 1,
+			Cantidad: strings.TrimSpace(ingrediente.Cantidad),
+			Unidad:   strings.TrimSpace(ingrediente.Unidad),
+			Nombre:   strings.TrimSpace(ingrediente.Nombre),
+			Nota:     strings.TrimSpace(ingrediente.Nota),
+			Grupo:    strings.TrimSpace(ingrediente.Grupo),
+		}
+		if fila.Nombre == "" {
+			errorValidacion[campo] = append(errorValidacion[campo], "El nombre del ingrediente es obligatorio")
+		} else if utf8.RuneCountInString(fila.Nombre) > maxNombre {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("El nombre no debe exceder %d caracteres", maxNombre))
+		}
+		if utf8.RuneCountInString(fila.Cantidad) > maxCantidad {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("La cantidad no debe exceder %d caracteres", maxCantidad))
+		}
+		if utf8.RuneCountInString(fila.Unidad) > maxUnidad {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("La unidad no debe exceder %d caracteres", maxUnidad))
+		}
+		if utf8.RuneCountInString(fila.Nota) > maxNota {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("La nota no debe exceder %d caracteres", maxNota))
+		}
+		if utf8.RuneCountInString(fila.Grupo) > maxGrupo {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("El grupo no debe exceder %d caracteres", maxGrupo))
+		}
+		filasIngredientes = append(filasIngredientes, fila)
+	}
+
+	filasPasos := make(models.Pasos, 0, len(pasos))
+	for i, paso := range pasos {
+		campo := fmt.Sprintf("pasos[%d]", i)
+		fila := models.Paso{Numero: i + 1, Texto: strings.TrimSpace(paso.Texto)}
+		if fila.Texto == "" {
+			errorValidacion[campo] = append(errorValidacion[campo], "El texto del paso es obligatorio")
+		} else if utf8.RuneCountInString(fila.Texto) > maxTexto {
+			errorValidacion[campo] = append(errorValidacion[campo], fmt.Sprintf("El texto del paso no debe exceder %d caracteres", maxTexto))
+		}
+		filasPasos = append(filasPasos, fila)
+	}
+	return filasIngredientes, filasPasos
+}
+
+// reemplazarIngredientes borra los ingredientes de la receta y guarda los nuevos
+func reemplazarIngredientes(tx *gorm.DB, recetaID uint, ingredientes models.Ingredientes) error {
+	if err := tx.Where("receta_id = ?", recetaID).Delete(&models.Ingrediente{}).Error; err != nil {
+		return err
+	}
+	for i := range ingredientes {
+		ingredientes[i].ID = 0
+		ingredientes[i].RecetaID = recetaID
+	}
+	if len(ingredientes) == 0 {
+		return nil
+	}
+	return tx.Create(&ingredientes).Error
+}
+
+// reemplazarPasos borra los pasos de la receta y guarda los nuevos
+func reemplazarPasos(tx *gorm.DB, recetaID uint, pasos models.Pasos) error {
+	if err := tx.Where("receta_id = ?", recetaID).Delete(&models.Paso{}).Error; err != nil {
+		return err
+	}
+	for i := range pasos {
+		pasos[i].ID = 0
+		pasos[i].RecetaID = recetaID
+	}
+	if len(pasos) == 0 {
+		return nil
+	}
+	return tx.Create(&pasos).Error
+}
@@ -16,7 +16,7 @@ import (
 func Receta_Helper_Home(c *gin.Context) {
 	// Hacemos la consulta a la base de datos
 	var recetas []models.Receta
-	result := database.Database.Preload("Categoria").Preload("Usuario").Limit(3).Find(&recetas)
+	result := database.Database.Scopes(preloadReceta).Limit(3).Find(&recetas)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":  "error",
@@ -34,35 +34,7 @@ func Receta_Helper_Home(c *gin.Context) {
 	baseURL := schema + "://" + c.Request.Host
 
 	for _, r := range recetas {
-		fecha := ""
-		if !r.Fecha.IsZero() {
-			fecha = r.Fecha.Format("02/01/2006")
-		}
-
-		// Validación segura de relaciones que pueden ser nil
-		categoriaNombre := ""
-		if r.Categoria != nil {
-			categoriaNombre = r.Categoria.Nombre
-		}
-
-		usuarioNombre := ""
-		if r.Usuario != nil {
-			usuarioNombre = r.Usuario.Nombre
-		}
-
-		respuestas = append(respuestas, dto.RecetaResponse{
-			Id:          r.ID,
-			Nombre:      r.Nombre,
-			Slug:        r.Slug,
-			CategoriaId: r.CategoriaID,
-			Categoria:   categoriaNombre,
-			UsuarioId:   r.UsuarioID,
-			Usuario:     usuarioNombre,
-			Tiempo:      r.Tiempo,
-			Foto:        baseURL + "/public/recetas/" + r.Foto,
-			Descripcion: r.Descripcion,
-			Fecha:       fecha,
-		})
+		respuestas = append(respuestas, respuestaReceta(r, baseURL))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -96,7 +68,7 @@ func Receta_Helper_Usuario(c *gin.Context) {
 
 	// Hacemos la consulta a la base de datos
 	var recetas []models.Receta
-	result = database.Database.Where(&models.Receta{UsuarioID: uint(usuario_id)}).Preload("Categoria").Preload("Usuario").Find(&recetas)
+	result = database.Database.Where(&models.Receta{UsuarioID: uint(usuario_id)}).Scopes(preloadReceta).Find(&recetas)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":  "error",
@@ -114,35 +86,7 @@ func Receta_Helper_Usuario(c *gin.Context) {
 	baseURL := schema + "://" + c.Request.Host
 
 	for _, r := range recetas {
-		fecha := ""
-		if !r.Fecha.IsZero() {
-			fecha = r.Fecha.Format("02/01/2006")
-		}
-
-		// Validación segura de relaciones que pueden ser nil
-		categoriaNombre := ""
-		if r.Categoria != nil {
-			categoriaNombre = r.Categoria.Nombre
-		}
-
-		usuarioNombre := ""
-		if r.Usuario != nil {
-			usuarioNombre = r.Usuario.Nombre
-		}
-
-		respuestas = append(respuestas, dto.RecetaResponse{
-			Id:          r.ID,
-			Nombre:      r.Nombre,
-			Slug:        r.Slug,
-			CategoriaId: r.CategoriaID,
-			Categoria:   categoriaNombre,
-			UsuarioId:   r.UsuarioID,
-			Usuario:     usuarioNombre,
-			Tiempo:      r.Tiempo,
-			Foto:        baseURL + "/public/recetas/" + r.Foto,
-			Descripcion: r.Descripcion,
-			Fecha:       fecha,
-		})
+		respuestas = append(respuestas, respuestaReceta(r, baseURL))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -162,10 +106,14 @@ func Receta_Helper_Slug(c *gin.Context) {
 		})
 		return
 	}
+	sistema, ok := sistemaUnidades(c)
+	if !ok {
+		return
+	}
 
 	// Buscamos la receta por slug
 	var receta models.Receta
-	result := database.Database.Where("slug = ?", slug).Preload("Categoria").Preload("Usuario").First(&receta)
+	result := database.Database.Where("slug = ?", slug).Scopes(preloadReceta).First(&receta)
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"estado":  "error",
@@ -182,37 +130,8 @@ func Receta_Helper_Slug(c *gin.Context) {
 	}
 	baseURL := schema + "://" + c.Request.Host
 
-	// Formateamos la fecha
-	fecha := ""
-	if !receta.Fecha.IsZero() {
-		fecha = receta.Fecha.Format("02/01/2006")
-	}
-
-	// Validación segura de relaciones que pueden ser nil
-	categoriaNombre := ""
-	if receta.Categoria != nil {
-		categoriaNombre = receta.Categoria.Nombre
-	}
-
-	usuarioNombre := ""
-	if receta.Usuario != nil {
-		usuarioNombre = receta.Usuario.Nombre
-	}
-
-	// Construimos la respuesta
-	respuesta := dto.RecetaResponse{
-		Id:          receta.ID,
-		Nombre:      receta.Nombre,
-		Slug:        receta.Slug,
-		CategoriaId: receta.CategoriaID,
-		Categoria:   categoriaNombre,
-		UsuarioId:   receta.UsuarioID,
-		Usuario:     usuarioNombre,
-		Tiempo:      receta.Tiempo,
-		Foto:        baseURL + "/public/recetas/" + receta.Foto,
-		Descripcion: receta.Descripcion,
-		Fecha:       fecha,
-	}
+	respuesta := respuestaReceta(receta, baseURL)
+	convertirReceta(&respuesta, sistema)
 
 	c.JSON(http.StatusOK, gin.H{
 		"estado": "ok",
@@ -249,9 +168,37 @@ func Receta_Helper_Buscador(c *gin.Context) {
 		query = query.Where("categoria_id = ?", categoria_id)
 	}
 
+	// Filtro por tiempo total máximo (las recetas sin tiempo conocido no entran)
+	if valor := c.Query("tiempo_max"); valor != "" {
+		tiempoMax, err := strconv.Atoi(valor)
+		if err != nil || tiempoMax < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"estado":  "error",
+				"mensaje": "El parámetro tiempo_max debe ser un número entero de minutos mayor que 0",
+			})
+			return
+		}
+		query = query.Where("tiempo_total > 0 AND tiempo_total <= ?", tiempoMax)
+	}
+
+	// Orden opcional por tiempo total; las recetas sin tiempo conocido van al final
+	switch c.Query("orden") {
+	case "":
+	case "tiempo":
+		query = query.Order("tiempo_total = 0, tiempo_total, id")
+	case "tiempo_desc":
+		query = query.Order("tiempo_total desc, id")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":  "error",
+			"mensaje": "El parámetro orden debe ser tiempo o tiempo_desc",
+		})
+		return
+	}
+
 	// Ejecutamos la consulta con los Preloads
 	var recetas []models.Receta
-	result := query.Preload("Categoria").Preload("Usuario").Find(&recetas)
+	result := query.Scopes(preloadReceta).Find(&recetas)
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":  "error",
@@ -269,35 +216,7 @@ func Receta_Helper_Buscador(c *gin.Context) {
 	baseURL := schema + "://" + c.Request.Host
 
 	for _, r := range recetas {
-		fecha := ""
-		if !r.Fecha.IsZero() {
-			fecha = r.Fecha.Format("02/01/2006")
-		}
-
-		// Validación segura de relaciones que pueden ser nil
-		categoriaNombre := ""
-		if r.Categoria != nil {
-			categoriaNombre = r.Categoria.Nombre
-		}
-
-		usuarioNombre := ""
-		if r.Usuario != nil {
-			usuarioNombre = r.Usuario.Nombre
-		}
-
-		respuestas = append(respuestas, dto.RecetaResponse{
-			Id:          r.ID,
-			Nombre:      r.Nombre,
-			Slug:        r.Slug,
-			CategoriaId: r.CategoriaID,
-			Categoria:   categoriaNombre,
-			UsuarioId:   r.UsuarioID,
-			Usuario:     usuarioNombre,
-			Tiempo:      r.Tiempo,
-			Foto:        baseURL + "/public/recetas/" + r.Foto,
-			Descripcion: r.Descripcion,
-			Fecha:       fecha,
-		})
+		respuestas = append(respuestas, respuestaReceta(r, baseURL))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -359,6 +278,14 @@ func Receta_Helper_Editar_Foto(c *gin.Context) {
 		})
 		return
 	}
+	// Solo el autor (o un admin/editor) puede cambiar la foto
+	if !puedeGestionarReceta(c, receta) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"estado":  "error",
+			"mensaje": "No tiene permisos para gestionar esta receta",
+		})
+		return
+	}
 
 	// Obtenemos la extensión del archivo
 	nombrePartes := strings.Split(file.Filename, ".")
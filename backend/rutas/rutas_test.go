@@ -0,0 +1,119 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/intentos"
+	"backend/models"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// Las claves del JWT se cargan una sola vez por proceso
+	os.Setenv("SECRET_JWT", "secreto-de-prueba")
+	// Sin SMTP los envíos en segundo plano fallan y lo registran en el log
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// baseDatosPrueba reemplaza la base de datos por una SQLite en memoria con las tablas
+// de los modelos indicados (y las de usuarios). Se restaura al terminar la prueba.
+func baseDatosPrueba(t *testing.T, modelos ...interface{}) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modelos = append([]interface{}{&models.Estado{}, &models.Usuario{}, &models.EventoAuditoria{}}, modelos...)
+	if err := db.AutoMigrate(modelos...); err != nil {
+		t.Fatal(err)
+	}
+	for id, nombre := range models.NombresEstado {
+		if err := db.Create(&models.Estado{ID: id, Nombre: nombre}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	anterior, almacen := database.Database, AlmacenIntentos
+	database.Database = db
+	// Los límites de intentos tampoco se comparten entre pruebas
+	AlmacenIntentos = intentos.NuevoAlmacenMemoria()
+	t.Cleanup(func() {
+		database.Database, AlmacenIntentos = anterior, almacen
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// crearUsuarioPrueba guarda un usuario activo
+func crearUsuarioPrueba(t *testing.T, correo string) models.Usuario {
+	t.Helper()
+	usuario := models.Usuario{
+		Nombre:   "Prueba",
+		Correo:   correo,
+		Password: "-",
+		EstadoID: models.EstadoActivo,
+		Rol:      models.RolAutor,
+		Fecha:    time.Now(),
+	}
+	if err := database.Database.Create(&usuario).Error; err != nil {
+		t.Fatal(err)
+	}
+	return usuario
+}
+
+// peticionPrueba ejecuta el handler con el cuerpo en JSON. Si usuario no es nil se
+// pone en el contexto como lo hace ValidarJWTMiddleware.
+func peticionPrueba(t *testing.T, handler gin.HandlerFunc, usuario *models.Usuario, cuerpo interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	grabador := solicitudPrueba(t, handler, usuario, cuerpo, nil)
+	return grabador.Code, respuestaPrueba(t, grabador)
+}
+
+// solicitudPrueba es como peticionPrueba pero permite ajustar el contexto antes de
+// ejecutar el handler (cookies, IP, la sesión del token) y devuelve la respuesta
+// completa. La IP por defecto de httptest es 192.0.2.1.
+func solicitudPrueba(t *testing.T, handler gin.HandlerFunc, usuario *models.Usuario, cuerpo interface{}, preparar func(*gin.Context)) *httptest.ResponseRecorder {
+	t.Helper()
+	contenido, err := json.Marshal(cuerpo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	grabador := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(grabador)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(contenido))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if usuario != nil {
+		c.Set("usuario", *usuario)
+	}
+	if preparar != nil {
+		preparar(c)
+	}
+	handler(c)
+	return grabador
+}
+
+// respuestaPrueba decodifica el cuerpo JSON de la respuesta
+func respuestaPrueba(t *testing.T, grabador *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	respuesta := map[string]interface{}{}
+	if err := json.Unmarshal(grabador.Body.Bytes(), &respuesta); err != nil {
+		t.Fatalf("respuesta no es JSON: %s", grabador.Body.String())
+	}
+	return respuesta
+}
@@ -3,19 +3,28 @@ package rutas
 import (
 	"backend/database"
 	"backend/dto"
+	"backend/intentos"
 	"backend/jwt"
+	"backend/middleware"
 	"backend/models"
+	"backend/password"
 	"backend/utilidades"
 	"backend/validaciones"
+	"log"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// AlmacenIntentos guarda los fallos de login por correo y por IP (main.go lo reemplaza por el de base de datos)
+var AlmacenIntentos intentos.Almacen = intentos.NuevoAlmacenMemoria()
+
 func Seguridad_registro(c *gin.Context) {
 	var body dto.UsuarioDto
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -58,6 +67,9 @@ func Seguridad_registro(c *gin.Context) {
 		})
 		return
 	}
+	if !passwordCumplePolitica(c, "Ocurrió un error al registrar el usuario.", body.Password, body.Correo, body.Nombre) {
+		return
+	}
 
 	// Validamos que el correo no exista en la tabla usuario
 	existe := models.Usuarios{}
@@ -70,36 +82,35 @@ func Seguridad_registro(c *gin.Context) {
 		})
 		return
 	}
-	// Generamos el hash con bcrypt
-	costo := 10
-	bytes, _ := bcrypt.GenerateFromPassword([]byte(body.Password), costo)
+	// Generamos el hash con el algoritmo configurado (Argon2id por defecto)
+	hash, err := password.Generar(body.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar el usuario.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
 	// Generamos un token
 	token := uuid.New()
 
+	expira := time.Now().Add(duracionVerificacion())
+
 	// TODO: Implementar registro de usuario
 	save := models.Usuario{
-		Nombre:   body.Nombre,
-		Correo:   body.Correo,
-		Token:    token.String(),
-		Password: string(bytes),
-		EstadoID: 2,
-		Fecha:    time.Now(),
+		Nombre:      body.Nombre,
+		Correo:      body.Correo,
+		Token:       token.String(),
+		TokenExpira: &expira,
+		Password:    hash,
+		EstadoID:    models.EstadoPendiente,
+		Rol:         models.RolAutor,
+		Fecha:       time.Now(),
 	}
 	database.Database.Save(&save)
 	// Enviar mail de verificacion
-	scheme := "http"
-	if c.Request.TLS != nil {
-		scheme = "https"
-	}
-	url := scheme + "://" + c.Request.Host + "/api/v1/seguridad/verificacion/" + token.String()
-	var mensaje = "<h1>Verificación de cuenta</h1>" +
-		"Hola " + body.Nombre + ",<br><br>" +
-		"Para verificar su cuenta haga click en el siguiente enlace:<br>" +
-		"<a href='" + url + "'>" + url + "</a><br><br>" +
-		"O copia y pega el siguiente enlace en tu navegador:<br>" +
-		url + "<br><br>" +
-		"Gracias por registrarse."
-	utilidades.EnviarCorreo(body.Correo, "Verificación de cuenta - "+body.Nombre, mensaje)
+	enviarCorreoVerificacion(c, body.Nombre, body.Correo, token.String())
 
 	// retornamos
 	c.JSON(http.StatusCreated, gin.H{
@@ -122,11 +133,12 @@ func Seguridad_verificacion(c *gin.Context) {
 		return
 	}
 
-	// Buscar el usuario con el token (estado 2 = pendiente)
+	// Buscar el usuario con el token (estado pendiente, o activo con un cambio de correo pendiente)
 	user := models.Usuario{}
-	res := database.Database.Where(&models.Usuario{Token: token, EstadoID: 2}).First(&user)
-	if res.Error != nil || res.RowsAffected == 0 {
+	res := database.Database.Where(&models.Usuario{Token: token}).First(&user)
+	if res.Error != nil || res.RowsAffected == 0 || (user.EstadoID != models.EstadoPendiente && len(user.CorreoPendiente) == 0) {
 		// No encontramos usuario con ese token
+		auditar(c, models.EventoAuditoria{Accion: models.AccionVerificacion, Resultado: models.ResultadoFallo, Detalle: "Token inexistente"})
 		c.JSON(http.StatusNotFound, gin.H{
 			"estado":        "error",
 			"mensaje":       "Token de verificación inválido o expirado.",
@@ -134,10 +146,27 @@ func Seguridad_verificacion(c *gin.Context) {
 		})
 		return
 	}
+	// Los tokens anteriores a la expiración (TokenExpira nulo) se siguen aceptando
+	if user.TokenExpira != nil && time.Now().After(*user.TokenExpira) {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionVerificacion, ActorID: actorAuditoria(user), ActorCorreo: user.Correo, Resultado: models.ResultadoFallo, Detalle: "Token expirado"})
+		c.JSON(http.StatusGone, gin.H{
+			"estado":        "error",
+			"mensaje":       "Token de verificación inválido o expirado.",
+			"errorOpcional": "El enlace de verificación expiró, solicite uno nuevo en /seguridad/reenviar-verificacion.",
+		})
+		return
+	}
+
+	// Si la cuenta ya estaba activa el enlace confirma el cambio de correo
+	if user.EstadoID != models.EstadoPendiente {
+		confirmarCambioCorreo(c, user)
+		return
+	}
 
 	// Modificamos el registro
 	user.Token = ""
-	user.EstadoID = 1
+	user.TokenExpira = nil
+	user.EstadoID = models.EstadoActivo
 	if err := database.Database.Save(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"estado":        "error",
@@ -146,12 +175,71 @@ func Seguridad_verificacion(c *gin.Context) {
 		})
 		return
 	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionVerificacion, ActorID: actorAuditoria(user), ActorCorreo: user.Correo, Resultado: models.ResultadoExito})
 
 	// retornamos
 	c.Redirect(http.StatusMovedPermanently, os.Getenv("RUTA_FRONTEND"))
 
 }
 
+func Seguridad_reenviar_verificacion(c *gin.Context) {
+	var body dto.OlvidePasswordDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if validaciones.Regex_correo.FindStringSubmatch(body.Correo) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "El correo ingresado no es válido.",
+		})
+		return
+	}
+	// Límite de reenvíos por correo y por IP (se cuenta antes de buscar el usuario)
+	claves := map[string]int{
+		"reenvio:" + strings.ToLower(body.Correo): maxReenviosPorCorreo,
+		"reenvio-ip:" + c.ClientIP():              maxReenviosPorIP,
+	}
+	for clave, maximo := range claves {
+		registro, err := AlmacenIntentos.RegistrarFallo(clave, time.Hour)
+		if err == nil && registro.Fallos > maximo {
+			c.Header("Retry-After", strconv.Itoa(int(time.Until(registro.UltimoFallo.Add(time.Hour)).Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"estado":  "error",
+				"mensaje": "Se alcanzó el límite de reenvíos. Intente nuevamente más tarde.",
+			})
+			return
+		}
+	}
+
+	// La respuesta es la misma exista o no una cuenta pendiente con ese correo
+	respuestaGenerica := gin.H{
+		"estado":  "ok",
+		"mensaje": "Si hay una cuenta pendiente de verificación con ese correo recibirás un nuevo enlace.",
+	}
+	usuario := models.Usuarios{}
+	database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: models.EstadoPendiente}).Find(&usuario)
+	if len(usuario) == 0 {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	// Generamos un token nuevo, el anterior deja de servir
+	token := uuid.New().String()
+	expira := time.Now().Add(duracionVerificacion())
+	if err := database.Database.Model(&usuario[0]).Updates(models.Usuario{Token: token, TokenExpira: &expira}).Error; err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	enviarCorreoVerificacion(c, usuario[0].Nombre, usuario[0].Correo, token)
+
+	c.JSON(http.StatusOK, respuestaGenerica)
+}
+
 func Seguridad_login(c *gin.Context) {
 	var body dto.LoginDto
 	if err := c.ShouldBindJSON(&body); err != nil {
@@ -186,10 +274,26 @@ func Seguridad_login(c *gin.Context) {
 		})
 		return
 	}
+	// Validamos que ni el correo ni la IP estén bloqueados o en periodo de espera
+	claveCorreo := "correo:" + strings.ToLower(body.Correo)
+	claveIP := "ip:" + c.ClientIP()
+	if espera := esperaLogin(claveCorreo, claveIP); espera > 0 {
+		segundos := int(math.Ceil(espera.Seconds()))
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLogin, ActorCorreo: body.Correo, Resultado: models.ResultadoDenegado, Detalle: "Bloqueado por intentos fallidos"})
+		c.Header("Retry-After", strconv.Itoa(segundos))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"estado":        "error",
+			"mensaje":       "Demasiados intentos fallidos. Intente nuevamente más tarde.",
+			"errorOpcional": "Debe esperar " + strconv.Itoa(segundos) + " segundos antes de volver a intentar.",
+		})
+		return
+	}
 	// Validamos que el correo no exista en la tabla usuario
 	usuario := models.Usuarios{}
-	database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: 1}).Find(&usuario)
+	database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: models.EstadoActivo}).Find(&usuario)
 	if len(usuario) == 0 {
+		registrarFalloLogin(claveCorreo, claveIP, nil)
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLogin, ActorCorreo: body.Correo, Resultado: models.ResultadoFallo, Detalle: "Usuario inexistente o no activo"})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"estado":        "error",
 			"mensaje":       "Ocurrió un error inesperado.",
@@ -197,11 +301,11 @@ func Seguridad_login(c *gin.Context) {
 		})
 		return
 	}
-	// Usamos bcrypt para comparar los password
-	passwordByte := []byte(body.Password)
-	passwordBD := []byte(usuario[0].Password)
-	errorPassword := bcrypt.CompareHashAndPassword(passwordBD, passwordByte)
-	if errorPassword != nil {
+	// Comparamos el password con el hash guardado (Argon2id o bcrypt anterior)
+	passwordValido, rehash := password.Verificar(usuario[0].Password, body.Password)
+	if !passwordValido {
+		registrarFalloLogin(claveCorreo, claveIP, &usuario[0])
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLogin, ActorID: actorAuditoria(usuario[0]), ActorCorreo: usuario[0].Correo, Resultado: models.ResultadoFallo, Detalle: "Contraseña incorrecta"})
 		c.JSON(http.StatusBadRequest, gin.H{
 			"estado":        "error",
 			"mensaje":       "Ocurrió un error al registrar el usuario.",
@@ -210,19 +314,602 @@ func Seguridad_login(c *gin.Context) {
 		return
 
 	} else {
-		jwtKey, errJWT := jwt.GenerarJWT(usuario[0].Correo, usuario[0].Nombre, usuario[0].ID)
-		if errJWT != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
+		AlmacenIntentos.Reiniciar(claveCorreo)
+		if rehash {
+			actualizarHashPassword(&usuario[0], body.Password)
+		}
+		detalle := ""
+		if usuario[0].TotpActivo {
+			detalle = "Pendiente del segundo factor"
+		}
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLogin, ActorID: actorAuditoria(usuario[0]), ActorCorreo: usuario[0].Correo, Resultado: models.ResultadoExito, Detalle: detalle})
+		completarLogin(c, usuario[0])
+	}
+}
+
+func Seguridad_refresh(c *gin.Context) {
+	refreshToken, desdeCookie := refreshTokenPeticion(c)
+	if len(refreshToken) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "El campo refresh_token es obligatorio",
+		})
+		return
+	}
+	if desdeCookie {
+		if !middleware.CsrfValido(c) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"estado":        "error",
+				"mensaje":       "No autorizado",
+				"errorOpcional": "Falta el header " + middleware.HeaderCsrf + " o no coincide con la cookie " + middleware.CookieCsrf,
+			})
+			return
+		}
+		// La sesión renovada sigue en modo cookie
+		c.Set("modo_cookie", true)
+	}
+	// Buscamos el refresh token por su hash
+	actual := models.RefreshToken{}
+	result := database.Database.Where(&models.RefreshToken{TokenHash: utilidades.HashToken(refreshToken)}).First(&actual)
+	if result.Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El refresh token no es válido.",
+		})
+		return
+	}
+	if actual.RevocadoEn != nil || time.Now().After(actual.ExpiraEn) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El refresh token fue revocado o está expirado.",
+		})
+		return
+	}
+	// Marcamos el token como usado; si ya lo estaba alguien lo está reutilizando
+	ahora := time.Now()
+	marcado := database.Database.Model(&models.RefreshToken{}).
+		Where("id = ? AND usado_en IS NULL", actual.ID).
+		Update("usado_en", ahora)
+	if marcado.Error != nil || marcado.RowsAffected == 0 {
+		revocarFamilia(actual.Familia)
+		auditar(c, models.EventoAuditoria{Accion: models.AccionRefreshReutilizado, ActorID: &actual.UsuarioID, Resultado: models.ResultadoDenegado, Detalle: "Se revocó la sesión por reutilizar un refresh token"})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El refresh token ya fue utilizado, se cerraron todas las sesiones asociadas.",
+		})
+		return
+	}
+	// El usuario debe seguir existiendo y estar activo
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, actual.UsuarioID).Error; err != nil {
+		revocarFamilia(actual.Familia)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El usuario no existe o no está activo.",
+		})
+		return
+	}
+	respuesta, err := emitirSesion(c, usuario, actual.Familia)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "Ocurrió un error al intentar generar el token" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, respuesta)
+}
+
+func Seguridad_logout(c *gin.Context) {
+	refreshToken, desdeCookie := refreshTokenPeticion(c)
+	if len(refreshToken) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "El campo refresh_token es obligatorio",
+		})
+		return
+	}
+	if desdeCookie && !middleware.CsrfValido(c) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "Falta el header " + middleware.HeaderCsrf + " o no coincide con la cookie " + middleware.CookieCsrf,
+		})
+		return
+	}
+	middleware.BorrarCookiesSesion(c)
+	// Revocamos toda la familia del refresh token (si existe)
+	actual := models.RefreshToken{}
+	result := database.Database.Where(&models.RefreshToken{TokenHash: utilidades.HashToken(refreshToken)}).First(&actual)
+	if result.Error == nil {
+		if err := revocarFamilia(actual.Familia); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
 				"estado":        "error",
-				"mensaje":       "Ocurrió un error inesperado.",
-				"errorOpcional": "Ocurrió un error al intentar generar el token" + errJWT.Error(),
+				"mensaje":       "Ocurrió un error al cerrar la sesión.",
+				"errorOpcional": err.Error(),
 			})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{
-			"id":     usuario[0].ID,
-			"nombre": usuario[0].Nombre,
-			"token":  jwtKey,
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Sesión cerrada correctamente",
+	})
+}
+
+func Seguridad_politica_password(c *gin.Context) {
+	// Requisitos de las contraseñas, para que el frontend los muestre antes de enviar
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  validaciones.PoliticaPasswordActual(),
+	})
+}
+
+func Seguridad_jwks(c *gin.Context) {
+	// Claves públicas para que otros servicios verifiquen nuestros JWT sin compartir secretos
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwt.JWKS())
+}
+
+// completarLogin responde a un login con credenciales válidas: si el usuario tiene
+// 2FA activo devuelve un desafío intermedio, si no emite la sesión completa.
+func completarLogin(c *gin.Context, usuario models.Usuario) {
+	respuesta, err := respuestaLogin(c, usuario)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "Ocurrió un error al intentar generar el token" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, respuesta)
+}
+
+// respuestaLogin arma la respuesta de completarLogin sin escribirla, para los flujos
+// que no responden JSON (por ejemplo el callback de OIDC, que redirige al frontend)
+func respuestaLogin(c *gin.Context, usuario models.Usuario) (gin.H, error) {
+	if usuario.TotpActivo {
+		desafio, err := jwt.GenerarDesafio2FA(usuario.ID)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"estado":  "2fa_requerido",
+			"mensaje": "Ingrese el código de su aplicación de autenticación o un código de recuperación.",
+			"desafio": desafio,
+		}, nil
+	}
+	return emitirSesion(c, usuario, "")
+}
+
+// emitirSesion genera un token de acceso y un refresh token nuevo para el usuario.
+// Si familia viene vacía se inicia una familia (y una sesión) nueva (login); en un
+// refresh se reutiliza.
+func emitirSesion(c *gin.Context, usuario models.Usuario, familia string) (gin.H, error) {
+	sesion, err := obtenerSesion(c, usuario.ID, familia)
+	if err != nil {
+		return nil, err
+	}
+	jwtKey, jti, err := jwt.GenerarJWT(usuario.Correo, usuario.Nombre, usuario.ID, usuario.Rol, sesion.ID)
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		return nil, err
+	}
+	save := models.RefreshToken{
+		UsuarioID: usuario.ID,
+		Familia:   sesion.Familia,
+		TokenHash: utilidades.HashToken(refresh),
+		AccesoJti: jti,
+		ExpiraEn:  time.Now().Add(jwt.DuracionRefresh()),
+		Fecha:     time.Now(),
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		return nil, err
+	}
+	database.Database.Model(&sesion).Updates(map[string]interface{}{
+		"ultimo_uso": save.Fecha,
+		"expira_en":  save.ExpiraEn,
+		"ip":         c.ClientIP(),
+	})
+	// En modo cookie los tokens no van en el cuerpo, solo el token CSRF
+	if modoCookie(c) {
+		csrf, err := middleware.EstablecerCookiesSesion(c, jwtKey, refresh, jwt.DuracionAcceso(), jwt.DuracionRefresh())
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{
+			"id":         usuario.ID,
+			"nombre":     usuario.Nombre,
+			"rol":        usuario.Rol,
+			"modo":       "cookie",
+			"csrf_token": csrf,
+			"expira_en":  int(jwt.DuracionAcceso().Seconds()),
+		}, nil
+	}
+	return gin.H{
+		"id":            usuario.ID,
+		"nombre":        usuario.Nombre,
+		"rol":           usuario.Rol,
+		"token":         jwtKey,
+		"refresh_token": refresh,
+		"expira_en":     int(jwt.DuracionAcceso().Seconds()),
+	}, nil
+}
+
+// modoCookie indica si la sesión se entrega en cookies: el cliente lo pide con
+// ?modo=cookie al iniciar sesión, y un refresh hecho con la cookie lo mantiene
+func modoCookie(c *gin.Context) bool {
+	return c.Query("modo") == "cookie" || c.GetBool("modo_cookie")
+}
+
+// refreshTokenPeticion obtiene el refresh token del cuerpo (refresh_token) o, en modo
+// cookie, de la cookie refresh. desdeCookie indica que se debe validar el token CSRF.
+func refreshTokenPeticion(c *gin.Context) (refreshToken string, desdeCookie bool) {
+	var body dto.RefreshDto
+	if err := c.ShouldBindJSON(&body); err == nil && len(body.RefreshToken) > 0 {
+		return body.RefreshToken, false
+	}
+	if cookie, err := c.Cookie(middleware.CookieRefresh); err == nil && len(cookie) > 0 {
+		return cookie, true
+	}
+	return "", false
+}
+
+// revocarFamilia invalida todos los refresh tokens de una familia y los tokens de
+// acceso emitidos junto a ellos que todavía no hayan expirado.
+func revocarFamilia(familia string) error {
+	ahora := time.Now()
+	tokens := models.RefreshTokens{}
+	if err := database.Database.Where(&models.RefreshToken{Familia: familia}).Find(&tokens).Error; err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		limiteAcceso := t.Fecha.Add(jwt.DuracionAcceso())
+		if len(t.AccesoJti) > 0 && ahora.Before(limiteAcceso) {
+			revocado := models.TokenRevocado{Jti: t.AccesoJti, ExpiraEn: limiteAcceso, Fecha: ahora}
+			database.Database.Where(&models.TokenRevocado{Jti: t.AccesoJti}).FirstOrCreate(&revocado)
+		}
+	}
+	// Aprovechamos para limpiar los jti que ya expiraron por sí solos
+	database.Database.Where("expira_en < ?", ahora).Delete(&models.TokenRevocado{})
+	// Finalizamos la sesión para que sus tokens de acceso dejen de aceptarse
+	database.Database.Model(&models.Sesion{}).
+		Where("familia = ? AND finalizada_en IS NULL", familia).
+		Update("finalizada_en", ahora)
+	return database.Database.Model(&models.RefreshToken{}).
+		Where("familia = ? AND revocado_en IS NULL", familia).
+		Update("revocado_en", ahora).Error
+}
+
+func Seguridad_olvide_password(c *gin.Context) {
+	var body dto.OlvidePasswordDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if validaciones.Regex_correo.FindStringSubmatch(body.Correo) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "El correo ingresado no es válido.",
+		})
+		return
+	}
+	// La respuesta es la misma exista o no el correo, para no revelar qué cuentas existen
+	respuestaGenerica := gin.H{
+		"estado":  "ok",
+		"mensaje": "Si el correo está registrado recibirás un enlace para restablecer tu contraseña.",
+	}
+
+	usuario := models.Usuarios{}
+	database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: models.EstadoActivo}).Find(&usuario)
+	if len(usuario) == 0 {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+
+	token, err := utilidades.GenerarTokenAleatorio(32)
+	if err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+	// Invalidamos los enlaces anteriores que no se hayan usado
+	ahora := time.Now()
+	database.Database.Model(&models.RecuperacionPassword{}).
+		Where("usuario_id = ? AND usado_en IS NULL", usuario[0].ID).
+		Update("usado_en", ahora)
+
+	save := models.RecuperacionPassword{
+		UsuarioID: usuario[0].ID,
+		TokenHash: utilidades.HashToken(token),
+		ExpiraEn:  ahora.Add(duracionRecuperacion()),
+		Fecha:     ahora,
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		c.JSON(http.StatusOK, respuestaGenerica)
+		return
+	}
+
+	url := os.Getenv("RUTA_FRONTEND") + "/reset-password?token=" + token
+	var mensaje = "<h1>Restablecer contraseña</h1>" +
+		"Hola " + usuario[0].Nombre + ",<br><br>" +
+		"Recibimos una solicitud para restablecer tu contraseña. Haz click en el siguiente enlace:<br>" +
+		"<a href='" + url + "'>" + url + "</a><br><br>" +
+		"El enlace vence en " + strconv.Itoa(int(duracionRecuperacion().Minutes())) + " minutos y solo puede usarse una vez.<br>" +
+		"Si no fuiste tú, ignora este correo."
+	// Enviamos en segundo plano para que el tiempo de respuesta no delate si la cuenta existe
+	go func(correo, nombre string) {
+		if err := utilidades.EnviarCorreo(correo, "Restablecer contraseña - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar correo de recuperación:", err)
+		}
+	}(usuario[0].Correo, usuario[0].Nombre)
+
+	c.JSON(http.StatusOK, respuestaGenerica)
+}
+
+func Seguridad_reset_password(c *gin.Context) {
+	var body dto.ResetPasswordDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if len(body.Token) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al restablecer la contraseña.",
+			"errorOpcional": "El campo token es obligatorio",
+		})
+		return
+	}
+
+	// Buscamos el token por su hash
+	recuperacion := models.RecuperacionPassword{}
+	result := database.Database.Where(&models.RecuperacionPassword{TokenHash: utilidades.HashToken(body.Token)}).First(&recuperacion)
+	if result.Error != nil || recuperacion.UsadoEn != nil || time.Now().After(recuperacion.ExpiraEn) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al restablecer la contraseña.",
+			"errorOpcional": "El enlace no es válido, ya fue usado o está expirado.",
+		})
+		return
+	}
+	// Validamos la contraseña nueva antes de consumir el token, para que se pueda reintentar
+	titular := models.Usuario{}
+	database.Database.Where("id = ?", recuperacion.UsuarioID).Limit(1).Find(&titular)
+	if !passwordCumplePolitica(c, "Ocurrió un error al restablecer la contraseña.", body.Password, titular.Correo, titular.Nombre) {
+		return
+	}
+	// Consumimos el token (un solo uso, incluso con peticiones concurrentes)
+	marcado := database.Database.Model(&models.RecuperacionPassword{}).
+		Where("id = ? AND usado_en IS NULL", recuperacion.ID).
+		Update("usado_en", time.Now())
+	if marcado.Error != nil || marcado.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al restablecer la contraseña.",
+			"errorOpcional": "El enlace no es válido, ya fue usado o está expirado.",
 		})
+		return
+	}
+
+	hash, err := password.Generar(body.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al restablecer la contraseña.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	if err := database.Database.Model(&models.Usuario{}).Where("id = ?", recuperacion.UsuarioID).Update("password", hash).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al restablecer la contraseña.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	// Cerramos todas las sesiones abiertas con la contraseña anterior
+	revocarSesionesUsuario(recuperacion.UsuarioID)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionResetPassword, ActorID: &recuperacion.UsuarioID, Resultado: models.ResultadoExito})
+
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Contraseña actualizada correctamente",
+	})
+}
+
+// Límites de reenvío del correo de verificación por hora
+const (
+	maxReenviosPorCorreo = 3
+	maxReenviosPorIP     = 10
+)
+
+// enviarCorreoVerificacion envía el enlace de activación de la cuenta en segundo
+// plano, para que el tiempo de respuesta no delate qué correos tienen una cuenta pendiente
+func enviarCorreoVerificacion(c *gin.Context, nombre, correo, token string) {
+	url := urlVerificacion(c, token)
+	var mensaje = "<h1>Verificación de cuenta</h1>" +
+		"Hola " + nombre + ",<br><br>" +
+		"Para verificar su cuenta haga click en el siguiente enlace:<br>" +
+		"<a href='" + url + "'>" + url + "</a><br><br>" +
+		"O copia y pega el siguiente enlace en tu navegador:<br>" +
+		url + "<br><br>" +
+		"El enlace vence en " + strconv.Itoa(int(duracionVerificacion().Hours())) + " horas.<br><br>" +
+		"Gracias por registrarse."
+	go func() {
+		if err := utilidades.EnviarCorreo(correo, "Verificación de cuenta - "+nombre, mensaje); err != nil {
+			log.Println("Error al enviar correo de verificación:", err)
+		}
+	}()
+}
+
+// urlVerificacion arma el enlace público de /seguridad/verificacion para el token
+func urlVerificacion(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + "/api/v1/seguridad/verificacion/" + token
+}
+
+// passwordCumplePolitica valida la contraseña con la política configurada. Si no la
+// cumple responde 400 con la lista de reglas incumplidas en "errores" y devuelve false.
+func passwordCumplePolitica(c *gin.Context, mensaje, password string, datosPersonales ...string) bool {
+	fallos := validaciones.PoliticaPasswordActual().Validar(password, datosPersonales...)
+	if len(fallos) == 0 {
+		return true
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"estado":        "error",
+		"mensaje":       mensaje,
+		"errorOpcional": validaciones.MensajesFallos(fallos),
+		"errores":       fallos,
+	})
+	return false
+}
+
+// duracionVerificacion devuelve la vigencia del enlace de verificación (VERIFICACION_HORAS, 24 por defecto)
+func duracionVerificacion() time.Duration {
+	horas, err := strconv.Atoi(os.Getenv("VERIFICACION_HORAS"))
+	if err != nil || horas <= 0 {
+		horas = 24
+	}
+	return time.Duration(horas) * time.Hour
+}
+
+// duracionRecuperacion devuelve la vigencia del enlace de recuperación (RESET_PASSWORD_MINUTOS, 60 por defecto)
+func duracionRecuperacion() time.Duration {
+	minutos, err := strconv.Atoi(os.Getenv("RESET_PASSWORD_MINUTOS"))
+	if err != nil || minutos <= 0 {
+		minutos = 60
+	}
+	return time.Duration(minutos) * time.Minute
+}
+
+// revocarSesionesUsuario revoca todas las familias de refresh tokens activas del usuario
+// y finaliza sus sesiones
+func revocarSesionesUsuario(usuarioID uint) error {
+	return revocarSesionesExcepto(usuarioID, "")
+}
+
+// revocarSesionesExcepto es revocarSesionesUsuario conservando la familia indicada
+// (la sesión desde la que se hace el cambio)
+func revocarSesionesExcepto(usuarioID uint, exceptoFamilia string) error {
+	var familias []string
+	err := database.Database.Model(&models.RefreshToken{}).
+		Where("usuario_id = ? AND revocado_en IS NULL", usuarioID).
+		Distinct().Pluck("familia", &familias).Error
+	if err != nil {
+		return err
+	}
+	var sesiones []string
+	err = database.Database.Model(&models.Sesion{}).
+		Where("usuario_id = ? AND finalizada_en IS NULL", usuarioID).
+		Pluck("familia", &sesiones).Error
+	if err != nil {
+		return err
+	}
+	familias = append(familias, sesiones...)
+	for _, familia := range familias {
+		if familia == exceptoFamilia {
+			continue
+		}
+		if err := revocarFamilia(familia); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// esperaLogin devuelve cuánto debe esperar el cliente antes de volver a intentar el login
+func esperaLogin(claveCorreo, claveIP string) time.Duration {
+	ahora := time.Now()
+	politica := intentos.PoliticaActual()
+	var espera time.Duration
+	for _, clave := range []string{claveCorreo, claveIP} {
+		registro, err := AlmacenIntentos.Obtener(clave)
+		if err != nil {
+			log.Println("Error al consultar intentos de login:", err)
+			continue
+		}
+		if e := politica.Espera(registro, ahora); e > espera {
+			espera = e
+		}
+	}
+	return espera
+}
+
+// registrarFalloLogin suma el fallo al correo y a la IP y aplica el bloqueo temporal
+// al superar el máximo. Si la cuenta existe se avisa al titular por correo.
+func registrarFalloLogin(claveCorreo, claveIP string, usuario *models.Usuario) {
+	politica := intentos.PoliticaActual()
+	hasta := time.Now().Add(politica.Bloqueo)
+
+	registro, err := AlmacenIntentos.RegistrarFallo(claveCorreo, politica.Ventana)
+	if err != nil {
+		log.Println("Error al registrar intento de login:", err)
+	} else if registro.Fallos >= politica.MaxFallos {
+		AlmacenIntentos.Bloquear(claveCorreo, hasta)
+		// Avisamos solo al alcanzar el máximo, no en cada intento posterior
+		if usuario != nil && registro.Fallos == politica.MaxFallos {
+			var mensaje = "<h1>Cuenta bloqueada temporalmente</h1>" +
+				"Hola " + usuario.Nombre + ",<br><br>" +
+				"Detectamos " + strconv.Itoa(registro.Fallos) + " intentos fallidos de inicio de sesión en tu cuenta. " +
+				"Por seguridad, el acceso quedó bloqueado hasta las " + hasta.Format("15:04 02/01/2006") + ".<br><br>" +
+				"Si no fuiste tú, te recomendamos restablecer tu contraseña."
+			go func(correo, nombre string) {
+				if err := utilidades.EnviarCorreo(correo, "Cuenta bloqueada temporalmente - "+nombre, mensaje); err != nil {
+					log.Println("Error al enviar correo de bloqueo:", err)
+				}
+			}(usuario.Correo, usuario.Nombre)
+		}
+	}
+
+	registro, err = AlmacenIntentos.RegistrarFallo(claveIP, politica.Ventana)
+	if err != nil {
+		log.Println("Error al registrar intento de login:", err)
+	} else if registro.Fallos >= politica.MaxFallosIP {
+		AlmacenIntentos.Bloquear(claveIP, hasta)
+	}
+}
+
+// actualizarHashPassword regenera el hash tras un login correcto si fue creado con
+// bcrypt o con parámetros más débiles que los actuales. Solo se reemplaza si el hash
+// no cambió mientras tanto; un error no impide el login.
+func actualizarHashPassword(usuario *models.Usuario, passwordPlano string) {
+	hash, err := password.Generar(passwordPlano)
+	if err != nil {
+		log.Println("Error al regenerar el hash de la contraseña:", err)
+		return
+	}
+	resultado := database.Database.Model(&models.Usuario{}).
+		Where("id = ? AND password = ?", usuario.ID, usuario.Password).
+		Update("password", hash)
+	if resultado.Error != nil {
+		log.Println("Error al actualizar el hash de la contraseña:", resultado.Error)
+		return
+	}
+	if resultado.RowsAffected > 0 {
+		usuario.Password = hash
 	}
 }
@@ -0,0 +1,80 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/password"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestReenviarVerificacionNoDelataCuentas(t *testing.T) {
+	baseDatosPrueba(t)
+	pendiente := crearUsuarioPrueba(t, "pendiente@example.com")
+	database.Database.Model(&pendiente).Updates(map[string]interface{}{"estado_id": models.EstadoPendiente, "token": "token-anterior"})
+	crearUsuarioPrueba(t, "activa@example.com")
+
+	var respuestas []map[string]interface{}
+	for _, correo := range []string{"pendiente@example.com", "activa@example.com", "nadie@example.com"} {
+		codigo, respuesta := peticionPrueba(t, Seguridad_reenviar_verificacion, nil, map[string]string{"correo": correo})
+		if codigo != http.StatusOK {
+			t.Fatalf("%s: %d %v", correo, codigo, respuesta)
+		}
+		respuestas = append(respuestas, respuesta)
+	}
+	for _, respuesta := range respuestas[1:] {
+		if !reflect.DeepEqual(respuesta, respuestas[0]) {
+			t.Fatalf("las respuestas difieren: %v y %v", respuestas[0], respuesta)
+		}
+	}
+
+	// Solo la cuenta pendiente recibe un token nuevo
+	database.Database.First(&pendiente, pendiente.ID)
+	if pendiente.Token == "token-anterior" || pendiente.TokenExpira == nil {
+		t.Fatalf("no se generó un token nuevo: %+v", pendiente)
+	}
+}
+
+func TestLoginRegeneraHashBcrypt(t *testing.T) {
+	baseDatosPrueba(t, &models.RefreshToken{}, &models.Sesion{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	hashBcrypt, err := bcrypt.GenerateFromPassword([]byte("Clave-de-prueba-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.Database.Model(&usuario).Update("password", string(hashBcrypt))
+
+	// Con la contraseña incorrecta el hash no se toca
+	if codigo, respuesta := peticionPrueba(t, Seguridad_login, nil, map[string]string{"correo": "ana@example.com", "password": "otra"}); codigo != http.StatusBadRequest {
+		t.Fatalf("login incorrecto: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.Password != string(hashBcrypt) {
+		t.Fatalf("el hash cambió con un login fallido: %s", usuario.Password)
+	}
+
+	if codigo, respuesta := peticionPrueba(t, Seguridad_login, nil, map[string]string{"correo": "ana@example.com", "password": "Clave-de-prueba-1"}); codigo != http.StatusOK || respuesta["token"] == nil {
+		t.Fatalf("login: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if !strings.HasPrefix(usuario.Password, "$argon2id$") {
+		t.Fatalf("el hash bcrypt no se reemplazó: %s", usuario.Password)
+	}
+	if ok, rehash := password.Verificar(usuario.Password, "Clave-de-prueba-1"); !ok || rehash {
+		t.Fatalf("hash nuevo: Verificar = %v, %v", ok, rehash)
+	}
+
+	// El hash nuevo ya está vigente: el siguiente login no lo regenera
+	anterior := usuario.Password
+	if codigo, respuesta := peticionPrueba(t, Seguridad_login, nil, map[string]string{"correo": "ana@example.com", "password": "Clave-de-prueba-1"}); codigo != http.StatusOK {
+		t.Fatalf("segundo login: %d %v", codigo, respuesta)
+	}
+	database.Database.First(&usuario, usuario.ID)
+	if usuario.Password != anterior {
+		t.Fatal("se regeneró un hash vigente")
+	}
+}
@@ -0,0 +1,116 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/jwt"
+	"backend/middleware"
+	"backend/models"
+	"backend/utilidades"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func Sesion_get(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.Sesiones{}
+	result := database.Database.
+		Where("usuario_id = ? AND finalizada_en IS NULL AND expira_en > ?", usuario.ID, time.Now()).
+		Order("ultimo_uso desc").Find(&datos)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": result.Error.Error(),
+		})
+		return
+	}
+	// Marcamos la sesión desde la que se hace la consulta
+	actual := c.GetUint("sid")
+	sesiones := make([]gin.H, 0, len(datos))
+	for _, sesion := range datos {
+		sesiones = append(sesiones, gin.H{
+			"id":          sesion.ID,
+			"dispositivo": sesion.Dispositivo,
+			"ip":          sesion.IP,
+			"ultimo_uso":  sesion.UltimoUso,
+			"expira_en":   sesion.ExpiraEn,
+			"fecha":       sesion.Fecha,
+			"actual":      sesion.ID == actual,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  sesiones,
+	})
+}
+
+func Sesion_delete(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.Sesion{}
+	if err := database.Database.Where("usuario_id = ? AND finalizada_en IS NULL", usuario.ID).First(&datos, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := revocarFamilia(datos.Familia); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error al cerrar la sesión.",
+			"error":   err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionSesionCerrar, Objetivo: "sesion:" + c.Param("id"), Resultado: models.ResultadoExito})
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Sesión cerrada correctamente",
+	})
+}
+
+func Sesion_delete_todas(c *gin.Context) {
+	// Cierra la sesión en todos los dispositivos, incluida la actual
+	usuario, _ := middleware.UsuarioActual(c)
+	if err := revocarSesionesUsuario(usuario.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": "Ocurrió un error al cerrar las sesiones.",
+			"error":   err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionSesionCerrar, Objetivo: "sesion:todas", Resultado: models.ResultadoExito})
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Se cerraron todas las sesiones",
+	})
+}
+
+// obtenerSesion devuelve la sesión de la familia indicada. En un login (familia vacía),
+// o si la familia es anterior a las sesiones, crea una nueva con el dispositivo y la IP
+// de la petición.
+func obtenerSesion(c *gin.Context, usuarioID uint, familia string) (models.Sesion, error) {
+	sesion := models.Sesion{}
+	if len(familia) > 0 {
+		if err := database.Database.Where(&models.Sesion{Familia: familia}).First(&sesion).Error; err == nil {
+			return sesion, nil
+		}
+	} else {
+		familia = uuid.New().String()
+	}
+	sesion = models.Sesion{
+		UsuarioID:   usuarioID,
+		Familia:     familia,
+		Dispositivo: utilidades.Truncar(c.Request.UserAgent(), 255),
+		IP:          c.ClientIP(),
+		UltimoUso:   time.Now(),
+		ExpiraEn:    time.Now().Add(jwt.DuracionRefresh()),
+		Fecha:       time.Now(),
+	}
+	err := database.Database.Create(&sesion).Error
+	return sesion, err
+}
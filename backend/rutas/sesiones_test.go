@@ -0,0 +1,37 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestObtenerSesionDispositivo(t *testing.T) {
+	baseDatosPrueba(t, &models.Sesion{})
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	// Un User-Agent largo con caracteres de varios bytes se recorta sin partir ninguno
+	c.Request.Header.Set("User-Agent", strings.Repeat("é", 300))
+	sesion, err := obtenerSesion(c, usuario.ID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	guardada := models.Sesion{}
+	database.Database.First(&guardada, sesion.ID)
+	if !utf8.ValidString(guardada.Dispositivo) || guardada.Dispositivo != strings.Repeat("é", 255) {
+		t.Fatalf("dispositivo de %d caracteres, UTF-8 válido %v", utf8.RuneCountInString(guardada.Dispositivo), utf8.ValidString(guardada.Dispositivo))
+	}
+
+	// Con la familia de una sesión existente se reutiliza esa sesión
+	if otra, err := obtenerSesion(c, usuario.ID, guardada.Familia); err != nil || otra.ID != guardada.ID {
+		t.Fatalf("sesión reutilizada: %+v, %v", otra, err)
+	}
+}
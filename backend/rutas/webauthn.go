@@ -0,0 +1,365 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/dto"
+	"backend/middleware"
+	"backend/models"
+	"backend/utilidades"
+	"backend/webauthn"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tipos de ceremonia de DesafioWebauthn
+const (
+	ceremoniaRegistro = "registro"
+	ceremoniaLogin    = "login"
+)
+
+func Webauthn_registro_opciones(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	desafio, err := nuevoDesafioWebauthn(usuario.ID, ceremoniaRegistro)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	// Excluimos las passkeys ya registradas para no duplicarlas en el mismo autenticador
+	existentes := models.CredencialesWebauthn{}
+	database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).Find(&existentes)
+	c.JSON(http.StatusOK, gin.H{
+		"estado":   "ok",
+		"opciones": webauthn.ConfiguracionDesdeEntorno().OpcionesRegistro(desafio, identificadorWebauthn(usuario.ID), usuario.Correo, usuario.Nombre, idsCredenciales(existentes)),
+	})
+}
+
+func Webauthn_registro(c *gin.Context) {
+	var body dto.WebauthnRegistroDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Datos de entrada inválidos. Verifique que todos los campos requeridos estén completos y sean correctos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	usuario, _ := middleware.UsuarioActual(c)
+	clientData, errCliente := webauthn.Decodificar(body.Response.ClientDataJSON)
+	atestacion, errAtestacion := webauthn.Decodificar(body.Response.AttestationObject)
+	if errCliente != nil || errAtestacion != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": "La respuesta del autenticador no está en base64url.",
+		})
+		return
+	}
+	desafio, ok := consumirDesafioWebauthn(clientData, ceremoniaRegistro)
+	if !ok || desafio.UsuarioID != usuario.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": "El desafío no es válido o expiró, intente nuevamente.",
+		})
+		return
+	}
+	credencial, err := webauthn.ConfiguracionDesdeEntorno().VerificarRegistro(desafio.valor, clientData, atestacion)
+	if err != nil {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionWebauthnRegistrar, Resultado: models.ResultadoFallo, Detalle: err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	id := webauthn.Codificar(credencial.ID)
+	if rawID, err := webauthn.Decodificar(body.ID); err != nil || webauthn.Codificar(rawID) != id {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": "El id no coincide con la credencial creada.",
+		})
+		return
+	}
+	existe := models.CredencialesWebauthn{}
+	database.Database.Where(&models.CredencialWebauthn{CredencialHash: utilidades.HashToken(id)}).Limit(1).Find(&existe)
+	if len(existe) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": "La passkey ya está registrada.",
+		})
+		return
+	}
+	if len(body.Nombre) == 0 {
+		body.Nombre = "Passkey"
+	}
+	body.Nombre = utilidades.Truncar(body.Nombre, 100)
+	save := models.CredencialWebauthn{
+		UsuarioID:      usuario.ID,
+		Nombre:         body.Nombre,
+		CredencialHash: utilidades.HashToken(id),
+		CredencialID:   id,
+		ClavePublica:   credencial.ClaveCose,
+		Algoritmo:      credencial.Algoritmo,
+		Contador:       credencial.Contador,
+		Respaldada:     credencial.Respaldada,
+		Fecha:          time.Now(),
+	}
+	if err := database.Database.Create(&save).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error al registrar la passkey.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionWebauthnRegistrar, Objetivo: "passkey:" + strconv.FormatUint(uint64(save.ID), 10), Resultado: models.ResultadoExito, Detalle: save.Nombre})
+	notificarCorreoActual(usuario, "Nueva passkey registrada", "Se registró la passkey \""+save.Nombre+"\" para iniciar sesión en tu cuenta. "+
+		"Si no fuiste tú, elimínala desde tu perfil y cambia tu contraseña.")
+	c.JSON(http.StatusCreated, gin.H{
+		"estado":  "ok",
+		"mensaje": "Passkey registrada correctamente",
+		"datos":   save,
+	})
+}
+
+func Webauthn_get(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.CredencialesWebauthn{}
+	result := database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).Order("fecha desc").Find(&datos)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":  "error",
+			"mensaje": result.Error.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado": "ok",
+		"datos":  datos,
+	})
+}
+
+func Webauthn_delete(c *gin.Context) {
+	usuario, _ := middleware.UsuarioActual(c)
+	datos := models.CredencialWebauthn{}
+	if err := database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).First(&datos, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"estado":  "error",
+			"mensaje": "Recurso no disponible",
+			"error":   err.Error(),
+		})
+		return
+	}
+	database.Database.Delete(&datos)
+	auditar(c, models.EventoAuditoria{Accion: models.AccionWebauthnEliminar, Objetivo: "passkey:" + c.Param("id"), Resultado: models.ResultadoExito, Detalle: datos.Nombre})
+	c.JSON(http.StatusOK, gin.H{
+		"estado":  "ok",
+		"mensaje": "Passkey eliminada correctamente",
+	})
+}
+
+func Webauthn_login_opciones(c *gin.Context) {
+	// El correo es opcional: sin él el navegador ofrece las passkeys detectables del sitio
+	var body dto.WebauthnOpcionesLoginDto
+	c.ShouldBindJSON(&body)
+	cfg := webauthn.ConfiguracionDesdeEntorno()
+	usuarioID := uint(0)
+	permitidas := [][]byte{}
+	if len(body.Correo) > 0 {
+		usuario := models.Usuarios{}
+		database.Database.Where(&models.Usuario{Correo: body.Correo, EstadoID: models.EstadoActivo}).Find(&usuario)
+		if len(usuario) > 0 {
+			credenciales := models.CredencialesWebauthn{}
+			database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario[0].ID}).Find(&credenciales)
+			permitidas = idsCredenciales(credenciales)
+		}
+		// Sin cuenta activa o sin passkeys se responden credenciales ficticias y estables
+		// para no revelar qué correos existen; ninguna firma servirá con ellas
+		if len(permitidas) > 0 {
+			usuarioID = usuario[0].ID
+		} else {
+			permitidas = cfg.CredencialesFicticias(body.Correo)
+		}
+	}
+	desafio, err := nuevoDesafioWebauthn(usuarioID, ceremoniaLogin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"estado":   "ok",
+		"opciones": cfg.OpcionesAsercion(desafio, permitidas),
+	})
+}
+
+func Webauthn_login(c *gin.Context) {
+	var body dto.WebauthnLoginDto
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Datos de entrada inválidos. Verifique que todos los campos requeridos estén completos y sean correctos.",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	respuestaInvalida := gin.H{
+		"estado":        "error",
+		"mensaje":       "No autorizado",
+		"errorOpcional": "La passkey no es válida para esta cuenta.",
+	}
+	clientData, errCliente := webauthn.Decodificar(body.Response.ClientDataJSON)
+	authData, errAuth := webauthn.Decodificar(body.Response.AuthenticatorData)
+	firma, errFirma := webauthn.Decodificar(body.Response.Signature)
+	if errCliente != nil || errAuth != nil || errFirma != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "La respuesta del autenticador no está en base64url.",
+		})
+		return
+	}
+	desafio, ok := consumirDesafioWebauthn(clientData, ceremoniaLogin)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El desafío no es válido o expiró, intente nuevamente.",
+		})
+		return
+	}
+	// Normalizamos el id (con o sin relleno) antes de buscar su hash
+	rawID, err := webauthn.Decodificar(body.ID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, respuestaInvalida)
+		return
+	}
+	credencial := models.CredencialWebauthn{}
+	if err := database.Database.Where(&models.CredencialWebauthn{CredencialHash: utilidades.HashToken(webauthn.Codificar(rawID))}).First(&credencial).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, respuestaInvalida)
+		return
+	}
+	// Si se pidió para un correo, la passkey debe ser de ese usuario; el user handle
+	// que devuelve el autenticador también debe coincidir
+	if desafio.UsuarioID != 0 && desafio.UsuarioID != credencial.UsuarioID {
+		c.JSON(http.StatusUnauthorized, respuestaInvalida)
+		return
+	}
+	if len(body.Response.UserHandle) > 0 && body.Response.UserHandle != webauthn.Codificar(identificadorWebauthn(credencial.UsuarioID)) {
+		c.JSON(http.StatusUnauthorized, respuestaInvalida)
+		return
+	}
+	asercion, err := webauthn.ConfiguracionDesdeEntorno().VerificarAsercion(desafio.valor, credencial.ClavePublica, credencial.Contador, clientData, authData, firma)
+	if err != nil {
+		auditar(c, models.EventoAuditoria{Accion: models.AccionLoginWebauthn, ActorID: &credencial.UsuarioID, Resultado: models.ResultadoFallo, Detalle: err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": err.Error(),
+		})
+		return
+	}
+	ahora := time.Now()
+	database.Database.Model(&credencial).Updates(map[string]interface{}{
+		"contador":   asercion.Contador,
+		"respaldada": asercion.Respaldada,
+		"ultimo_uso": ahora,
+	})
+
+	usuario := models.Usuario{}
+	if err := database.Database.Where(&models.Usuario{EstadoID: models.EstadoActivo}).First(&usuario, credencial.UsuarioID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"estado":        "error",
+			"mensaje":       "No autorizado",
+			"errorOpcional": "El usuario no existe o no está activo.",
+		})
+		return
+	}
+	auditar(c, models.EventoAuditoria{Accion: models.AccionLoginWebauthn, ActorID: actorAuditoria(usuario), ActorCorreo: usuario.Correo, Resultado: models.ResultadoExito, Detalle: credencial.Nombre})
+	// Con verificación del usuario (PIN o biometría) la passkey ya cuenta como dos
+	// factores; si el autenticador no verificó al usuario se aplica el 2FA si está activo
+	if !asercion.VerificacionUsuario {
+		completarLogin(c, usuario)
+		return
+	}
+	respuesta, err := emitirSesion(c, usuario, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"estado":        "error",
+			"mensaje":       "Ocurrió un error inesperado.",
+			"errorOpcional": "Ocurrió un error al intentar generar el token" + err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, respuesta)
+}
+
+// desafioPendiente es una ceremonia consumida junto al desafío en claro
+type desafioPendiente struct {
+	models.DesafioWebauthn
+	valor string
+}
+
+// nuevoDesafioWebauthn genera y guarda (hasheado) el desafío de una ceremonia
+func nuevoDesafioWebauthn(usuarioID uint, tipo string) (string, error) {
+	desafio, err := webauthn.GenerarDesafio()
+	if err != nil {
+		return "", err
+	}
+	// Limpiamos las ceremonias abandonadas
+	database.Database.Where("expira_en < ?", time.Now()).Delete(&models.DesafioWebauthn{})
+	save := models.DesafioWebauthn{
+		UsuarioID:   usuarioID,
+		DesafioHash: utilidades.HashToken(desafio),
+		Tipo:        tipo,
+		ExpiraEn:    time.Now().Add(webauthn.DuracionDesafio),
+	}
+	return desafio, database.Database.Create(&save).Error
+}
+
+// consumirDesafioWebauthn busca la ceremonia por el desafío del clientDataJSON y la
+// borra, de modo que cada desafío sirve una sola vez
+func consumirDesafioWebauthn(clientData []byte, tipo string) (desafioPendiente, bool) {
+	datos, err := webauthn.ParsearDatosCliente(clientData)
+	if err != nil || len(datos.Desafio) == 0 {
+		return desafioPendiente{}, false
+	}
+	desafio := models.DesafioWebauthn{}
+	if err := database.Database.Where(&models.DesafioWebauthn{DesafioHash: utilidades.HashToken(datos.Desafio), Tipo: tipo}).First(&desafio).Error; err != nil {
+		return desafioPendiente{}, false
+	}
+	borrado := database.Database.Delete(&desafio)
+	if borrado.RowsAffected == 0 || time.Now().After(desafio.ExpiraEn) {
+		return desafioPendiente{}, false
+	}
+	return desafioPendiente{DesafioWebauthn: desafio, valor: datos.Desafio}, true
+}
+
+// identificadorWebauthn es el user handle de las passkeys: el id del usuario en 8 bytes
+func identificadorWebauthn(usuarioID uint) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(usuarioID))
+}
+
+func idsCredenciales(credenciales models.CredencialesWebauthn) [][]byte {
+	ids := make([][]byte, 0, len(credenciales))
+	for _, credencial := range credenciales {
+		if id, err := webauthn.Decodificar(credencial.CredencialID); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
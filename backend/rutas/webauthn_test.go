@@ -0,0 +1,258 @@
+package rutas
+
+import (
+	"backend/database"
+	"backend/models"
+	"backend/webauthn"
+	"backend/webauthn/webauthntest"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	rpIDPrueba   = "recetas.example"
+	origenPrueba = "https://recetas.example"
+)
+
+func configurarWebauthnPrueba(t *testing.T) {
+	t.Setenv("WEBAUTHN_RP_ID", rpIDPrueba)
+	t.Setenv("WEBAUTHN_ORIGENES", origenPrueba)
+	t.Setenv("WEBAUTHN_REQUIERE_VERIFICACION", "false")
+	baseDatosPrueba(t, &models.CredencialWebauthn{}, &models.DesafioWebauthn{}, &models.RefreshToken{}, &models.Sesion{})
+}
+
+// opcionesPrueba devuelve el desafío de la respuesta de opciones
+func opcionesPrueba(t *testing.T, respuesta map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	opciones, ok := respuesta["opciones"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("la respuesta no trae opciones: %v", respuesta)
+	}
+	return opciones
+}
+
+// registrarPasskeyPrueba completa la ceremonia de registro con el autenticador virtual
+func registrarPasskeyPrueba(t *testing.T, usuario models.Usuario, autenticador *webauthntest.Autenticador) webauthntest.RespuestaRegistro {
+	t.Helper()
+	return registrarPasskeyNombrePrueba(t, usuario, autenticador, "Llave de prueba")
+}
+
+// registrarPasskeyNombrePrueba es registrarPasskeyPrueba con el nombre indicado
+func registrarPasskeyNombrePrueba(t *testing.T, usuario models.Usuario, autenticador *webauthntest.Autenticador, nombre string) webauthntest.RespuestaRegistro {
+	t.Helper()
+	codigo, respuesta := peticionPrueba(t, Webauthn_registro_opciones, &usuario, nil)
+	if codigo != http.StatusOK {
+		t.Fatalf("opciones de registro: %d %v", codigo, respuesta)
+	}
+	opciones := opcionesPrueba(t, respuesta)
+	usuarioID, err := webauthn.Decodificar(opciones["user"].(map[string]interface{})["id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	credencial, err := autenticador.Registrar(opciones["challenge"].(string), usuarioID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codigo, respuesta = peticionPrueba(t, Webauthn_registro, &usuario, map[string]interface{}{
+		"nombre":   nombre,
+		"id":       credencial.ID,
+		"response": credencial.Response,
+	})
+	if codigo != http.StatusCreated {
+		t.Fatalf("registro: %d %v", codigo, respuesta)
+	}
+	return credencial
+}
+
+// loginPasskeyPrueba pide las opciones de login y firma el desafío con el autenticador
+func loginPasskeyPrueba(t *testing.T, autenticador *webauthntest.Autenticador) (int, map[string]interface{}) {
+	t.Helper()
+	codigo, respuesta := peticionPrueba(t, Webauthn_login_opciones, nil, map[string]string{})
+	if codigo != http.StatusOK {
+		t.Fatalf("opciones de login: %d %v", codigo, respuesta)
+	}
+	asercion, err := autenticador.Firmar(opcionesPrueba(t, respuesta)["challenge"].(string), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peticionPrueba(t, Webauthn_login, nil, asercion)
+}
+
+func TestWebauthnRegistroYLogin(t *testing.T) {
+	configurarWebauthnPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	autenticador := webauthntest.NuevoAutenticador(rpIDPrueba, origenPrueba)
+	registrarPasskeyPrueba(t, usuario, autenticador)
+
+	guardadas := models.CredencialesWebauthn{}
+	database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).Find(&guardadas)
+	if len(guardadas) != 1 || guardadas[0].Nombre != "Llave de prueba" {
+		t.Fatalf("credenciales guardadas: %+v", guardadas)
+	}
+
+	for i := 1; i <= 2; i++ {
+		codigo, respuesta := loginPasskeyPrueba(t, autenticador)
+		if codigo != http.StatusOK || respuesta["token"] == nil || respuesta["refresh_token"] == nil {
+			t.Fatalf("login %d: %d %v", i, codigo, respuesta)
+		}
+		database.Database.First(&guardadas[0], guardadas[0].ID)
+		if guardadas[0].Contador != uint32(i) || guardadas[0].UltimoUso == nil {
+			t.Fatalf("login %d: la credencial no se actualizó: %+v", i, guardadas[0])
+		}
+	}
+}
+
+func TestWebauthnRegistroNombre(t *testing.T) {
+	configurarWebauthnPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	autenticador := webauthntest.NuevoAutenticador(rpIDPrueba, origenPrueba)
+	// Un nombre largo con acentos se recorta por caracteres, sin partir ninguno
+	registrarPasskeyNombrePrueba(t, usuario, autenticador, strings.Repeat("ñ", 150))
+	registrarPasskeyNombrePrueba(t, usuario, autenticador, "")
+
+	guardadas := models.CredencialesWebauthn{}
+	database.Database.Where(&models.CredencialWebauthn{UsuarioID: usuario.ID}).Order("id").Find(&guardadas)
+	if len(guardadas) != 2 || guardadas[0].Nombre != strings.Repeat("ñ", 100) || guardadas[1].Nombre != "Passkey" {
+		t.Fatalf("credenciales guardadas: %+v", guardadas)
+	}
+}
+
+func TestWebauthnRegistroRechazado(t *testing.T) {
+	configurarWebauthnPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+
+	// Un origen que no está permitido
+	autenticador := webauthntest.NuevoAutenticador(rpIDPrueba, "https://phishing.example")
+	_, respuesta := peticionPrueba(t, Webauthn_registro_opciones, &usuario, nil)
+	opciones := opcionesPrueba(t, respuesta)
+	credencial, err := autenticador.Registrar(opciones["challenge"].(string), []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cuerpo := map[string]interface{}{"id": credencial.ID, "response": credencial.Response}
+	if codigo, respuesta := peticionPrueba(t, Webauthn_registro, &usuario, cuerpo); codigo != http.StatusBadRequest || respuesta["errorOpcional"] != webauthn.ErrOrigen.Error() {
+		t.Fatalf("origen distinto: %d %v", codigo, respuesta)
+	}
+	// El desafío ya se consumió: reenviar la misma respuesta tampoco sirve
+	if codigo, _ := peticionPrueba(t, Webauthn_registro, &usuario, cuerpo); codigo != http.StatusBadRequest {
+		t.Fatalf("desafío reutilizado: %d", codigo)
+	}
+
+	// El desafío de otro usuario
+	otro := crearUsuarioPrueba(t, "beto@example.com")
+	_, respuesta = peticionPrueba(t, Webauthn_registro_opciones, &otro, nil)
+	autenticador = webauthntest.NuevoAutenticador(rpIDPrueba, origenPrueba)
+	credencial, err = autenticador.Registrar(opcionesPrueba(t, respuesta)["challenge"].(string), []byte{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cuerpo = map[string]interface{}{"id": credencial.ID, "response": credencial.Response}
+	if codigo, respuesta := peticionPrueba(t, Webauthn_registro, &usuario, cuerpo); codigo != http.StatusBadRequest {
+		t.Fatalf("desafío de otro usuario: %d %v", codigo, respuesta)
+	}
+
+	var total int64
+	database.Database.Model(&models.CredencialWebauthn{}).Count(&total)
+	if total != 0 {
+		t.Fatalf("se guardaron %d credenciales rechazadas", total)
+	}
+}
+
+func TestWebauthnLoginRechazado(t *testing.T) {
+	configurarWebauthnPrueba(t)
+	usuario := crearUsuarioPrueba(t, "ana@example.com")
+	autenticador := webauthntest.NuevoAutenticador(rpIDPrueba, origenPrueba)
+	registrarPasskeyPrueba(t, usuario, autenticador)
+
+	t.Run("firma alterada", func(t *testing.T) {
+		_, respuesta := peticionPrueba(t, Webauthn_login_opciones, nil, map[string]string{})
+		asercion, err := autenticador.Firmar(opcionesPrueba(t, respuesta)["challenge"].(string), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		firma, _ := webauthn.Decodificar(asercion.Response.Signature)
+		firma[len(firma)-1] ^= 0xff
+		asercion.Response.Signature = webauthn.Codificar(firma)
+		if codigo, respuesta := peticionPrueba(t, Webauthn_login, nil, asercion); codigo != http.StatusUnauthorized || respuesta["errorOpcional"] != webauthn.ErrFirmaInvalida.Error() {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("contador que retrocede", func(t *testing.T) {
+		// Un clon del autenticador firma con un contador que el servidor ya vio
+		if codigo, respuesta := loginPasskeyPrueba(t, autenticador); codigo != http.StatusOK {
+			t.Fatalf("login: %d %v", codigo, respuesta)
+		}
+		database.Database.Model(&models.CredencialWebauthn{}).Where("usuario_id = ?", usuario.ID).Update("contador", 100)
+		if codigo, respuesta := loginPasskeyPrueba(t, autenticador); codigo != http.StatusUnauthorized || respuesta["errorOpcional"] != webauthn.ErrContador.Error() {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("usuario inactivo", func(t *testing.T) {
+		database.Database.Model(&usuario).Update("estado_id", models.EstadoSuspendido)
+		defer database.Database.Model(&usuario).Update("estado_id", models.EstadoActivo)
+		database.Database.Model(&models.CredencialWebauthn{}).Where("usuario_id = ?", usuario.ID).Update("contador", 0)
+		if codigo, respuesta := loginPasskeyPrueba(t, autenticador); codigo != http.StatusUnauthorized || respuesta["errorOpcional"] != "El usuario no existe o no está activo." {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+
+	t.Run("desafío inexistente", func(t *testing.T) {
+		asercion, err := autenticador.Firmar("desafio-que-no-emitio-el-servidor", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codigo, respuesta := peticionPrueba(t, Webauthn_login, nil, asercion); codigo != http.StatusUnauthorized {
+			t.Fatalf("%d %v", codigo, respuesta)
+		}
+	})
+}
+
+func TestWebauthnLoginOpcionesNoDelataCuentas(t *testing.T) {
+	configurarWebauthnPrueba(t)
+	conPasskey := crearUsuarioPrueba(t, "ana@example.com")
+	crearUsuarioPrueba(t, "beto@example.com")
+	autenticador := webauthntest.NuevoAutenticador(rpIDPrueba, origenPrueba)
+	credencial := registrarPasskeyPrueba(t, conPasskey, autenticador)
+
+	permitidas := func(correo string) []string {
+		t.Helper()
+		codigo, respuesta := peticionPrueba(t, Webauthn_login_opciones, nil, map[string]string{"correo": correo})
+		if codigo != http.StatusOK {
+			t.Fatalf("%s: %d %v", correo, codigo, respuesta)
+		}
+		var ids []string
+		for _, descriptor := range opcionesPrueba(t, respuesta)["allowCredentials"].([]interface{}) {
+			ids = append(ids, descriptor.(map[string]interface{})["id"].(string))
+		}
+		return ids
+	}
+
+	if ids := permitidas("ana@example.com"); len(ids) != 1 || ids[0] != credencial.ID {
+		t.Fatalf("cuenta con passkey: %v", ids)
+	}
+	// Una cuenta sin passkeys y un correo sin cuenta reciben credenciales con la misma
+	// forma, que no cambian entre peticiones
+	for _, correo := range []string{"beto@example.com", "nadie@example.com"} {
+		ids := permitidas(correo)
+		if len(ids) == 0 || len(ids) > 2 || len(ids[0]) != len(credencial.ID) {
+			t.Fatalf("%s: credenciales %v", correo, ids)
+		}
+		if repetidas := permitidas(correo); !reflect.DeepEqual(ids, repetidas) {
+			t.Fatalf("%s: las credenciales cambiaron: %v y %v", correo, ids, repetidas)
+		}
+	}
+	// Con el desafío de un correo sin cuenta una passkey real sigue funcionando como
+	// detectable, igual que sin correo
+	_, respuesta := peticionPrueba(t, Webauthn_login_opciones, nil, map[string]string{"correo": "nadie@example.com"})
+	asercion, err := autenticador.Firmar(opcionesPrueba(t, respuesta)["challenge"].(string), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codigo, respuesta := peticionPrueba(t, Webauthn_login, nil, asercion); codigo != http.StatusOK {
+		t.Fatalf("login: %d %v", codigo, respuesta)
+	}
+}
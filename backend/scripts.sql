@@ -14,9 +14,9 @@ USE go_fullstack;
 
 -- ==================== INSERTAR DATOS INICIALES ====================
 
--- Estados (Activo/Inactivo) - IMPORTANTE: Ejecutar después de la primera migración
-INSERT INTO estados (nombre)
-VALUES ('Activo'), ('Inactivo')
+-- Estados de usuario: las migraciones ya los crean; solo hace falta en bases creadas a mano
+INSERT INTO estados (id, nombre)
+VALUES (1, 'Activo'), (2, 'Pendiente'), (3, 'Eliminado'), (4, 'Suspendido'), (5, 'Baneado')
 ON DUPLICATE KEY UPDATE nombre = VALUES(nombre);
 
 -- ==================== DATOS DE PRUEBA - CATEGORÍAS ====================
@@ -34,15 +34,19 @@ ON DUPLICATE KEY UPDATE nombre = VALUES(nombre);
 -- ==================== DATOS DE PRUEBA - RECETAS ====================
 -- NOTA: Ajusta los IDs de categoria_id y usuario_id según tus datos
 
-INSERT INTO receta (categoria_id, usuario_id, nombre, slug, tiempo, foto, descripcion, fecha, created_at, updated_at)
+INSERT INTO receta (categoria_id, usuario_id, nombre, slug, tiempo, tiempo_preparacion, tiempo_coccion, tiempo_reposo, tiempo_total, foto, descripcion, fecha, created_at, updated_at)
 VALUES
-    (1, 1, 'Limonada fresca', 'limonada-fresca', '10 min', 'limonada.jpg', 'Bebida refrescante de limón con hielo y menta.', NOW(), NOW(), NOW()),
-    (2, 1, 'Sopa de tomate', 'sopa-de-tomate', '30 min', 'sopa_tomate.jpg', 'Sopa cremosa de tomate con albahaca.', NOW(), NOW(), NOW()),
-    (3, 1, 'Cóctel Margarita', 'coctel-margarita', '7 min', 'margarita.jpg', 'Trago clásico con tequila, triple sec y limón.', NOW(), NOW(), NOW()),
-    (4, 1, 'Brownie de chocolate', 'brownie-de-chocolate', '45 min', 'brownie.jpg', 'Postre de chocolate intenso con nueces.', NOW(), NOW(), NOW()),
-    (5, 1, 'Pasta a la carbonara', 'pasta-a-la-carbonara', '25 min', 'carbonara.jpg', 'Pasta italiana con salsa de huevo, queso y panceta.', NOW(), NOW(), NOW())
+    (1, 1, 'Limonada fresca', 'limonada-fresca', '10 min', 10, 0, 0, 10, 'limonada.jpg', 'Bebida refrescante de limón con hielo y menta.', NOW(), NOW(), NOW()),
+    (2, 1, 'Sopa de tomate', 'sopa-de-tomate', '30 min', 10, 20, 0, 30, 'sopa_tomate.jpg', 'Sopa cremosa de tomate con albahaca.', NOW(), NOW(), NOW()),
+    (3, 1, 'Cóctel Margarita', 'coctel-margarita', '7 min', 7, 0, 0, 7, 'margarita.jpg', 'Trago clásico con tequila, triple sec y limón.', NOW(), NOW(), NOW()),
+    (4, 1, 'Brownie de chocolate', 'brownie-de-chocolate', '45 min', 15, 25, 5, 45, 'brownie.jpg', 'Postre de chocolate intenso con nueces.', NOW(), NOW(), NOW()),
+    (5, 1, 'Pasta a la carbonara', 'pasta-a-la-carbonara', '25 min', 10, 15, 0, 25, 'carbonara.jpg', 'Pasta italiana con salsa de huevo, queso y panceta.', NOW(), NOW(), NOW())
 ON DUPLICATE KEY UPDATE nombre = VALUES(nombre);
 
+-- ==================== ROLES ====================
+-- Promover al primer administrador (los nuevos registros quedan como 'author')
+UPDATE usuarios SET rol = 'admin' WHERE correo = 'admin@example.com';
+
 -- ==================== CONSULTAS ÚTILES ====================
 
 -- Ver todas las categorías (incluyendo las eliminadas)
@@ -58,6 +62,7 @@ SELECT
     c.nombre AS categoria,
     u.nombre AS usuario,
     r.tiempo,
+    r.tiempo_total,
     r.fecha
 FROM receta r
 INNER JOIN categoria c ON r.categoria_id = c.id
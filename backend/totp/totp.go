@@ -0,0 +1,93 @@
+package totp
+
+// Implementación de TOTP (RFC 6238) sobre HOTP (RFC 4226) con HMAC-SHA1,
+// 6 dígitos y pasos de 30 segundos, compatible con Google Authenticator, Authy, etc.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digitos = 6
+	Periodo = 30 // segundos
+	// Tolerancia es la cantidad de pasos aceptados antes y después del actual (desfase de reloj)
+	Tolerancia = 1
+)
+
+var codificacion = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerarSecreto devuelve un secreto aleatorio de 160 bits codificado en base32
+func GenerarSecreto() (string, error) {
+	bytes := make([]byte, 20)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return codificacion.EncodeToString(bytes), nil
+}
+
+// URI construye el enlace otpauth:// que las apps leen desde un código QR
+func URI(emisor, cuenta, secreto string) string {
+	etiqueta := url.PathEscape(emisor + ":" + cuenta)
+	parametros := url.Values{}
+	parametros.Set("secret", secreto)
+	parametros.Set("issuer", emisor)
+	parametros.Set("algorithm", "SHA1")
+	parametros.Set("digits", fmt.Sprint(Digitos))
+	parametros.Set("period", fmt.Sprint(Periodo))
+	return "otpauth://totp/" + etiqueta + "?" + parametros.Encode()
+}
+
+// Paso devuelve el número de intervalo de 30 segundos correspondiente al instante t
+func Paso(t time.Time) int64 {
+	return t.Unix() / Periodo
+}
+
+// CodigoEnPaso calcula el código HOTP del secreto para un paso concreto
+func CodigoEnPaso(secreto string, paso int64) (string, error) {
+	clave, err := codificacion.DecodeString(strings.ToUpper(strings.TrimSpace(secreto)))
+	if err != nil {
+		return "", err
+	}
+	mensaje := make([]byte, 8)
+	binary.BigEndian.PutUint64(mensaje, uint64(paso))
+	mac := hmac.New(sha1.New, clave)
+	mac.Write(mensaje)
+	suma := mac.Sum(nil)
+	// Truncado dinámico (RFC 4226, sección 5.3)
+	desplazamiento := suma[len(suma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(suma[desplazamiento:desplazamiento+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < Digitos; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digitos, valor%modulo), nil
+}
+
+// Validar comprueba el código contra los pasos cercanos a t. Devuelve el paso que
+// coincidió para que quien llama pueda impedir que el mismo código se reutilice.
+func Validar(secreto, codigo string, t time.Time) (int64, bool) {
+	codigo = strings.ReplaceAll(strings.TrimSpace(codigo), " ", "")
+	if len(codigo) != Digitos {
+		return 0, false
+	}
+	actual := Paso(t)
+	for desfase := int64(-Tolerancia); desfase <= Tolerancia; desfase++ {
+		esperado, err := CodigoEnPaso(secreto, actual+desfase)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			return actual + desfase, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretoRFC es "12345678901234567890", el secreto SHA-1 de los vectores del RFC 6238
+const secretoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodigoVectoresRFC6238(t *testing.T) {
+	// Apéndice B del RFC 6238 (SHA-1). El RFC usa 8 dígitos; con 6 son los últimos 6.
+	vectores := []struct {
+		segundos int64
+		codigo   string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectores {
+		codigo, err := CodigoEnPaso(secretoRFC, Paso(time.Unix(v.segundos, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codigo != v.codigo {
+			t.Errorf("T=%d: código = %s, se esperaba %s", v.segundos, codigo, v.codigo)
+		}
+	}
+	// El secreto se acepta en minúsculas y con espacios alrededor
+	if codigo, _ := CodigoEnPaso(" "+strings.ToLower(secretoRFC)+" ", 1); codigo != "287082" {
+		t.Errorf("secreto en minúsculas: %s", codigo)
+	}
+	if _, err := CodigoEnPaso("no-es-base32!", 1); err == nil {
+		t.Error("se aceptó un secreto inválido")
+	}
+}
+
+func TestValidarTolerancia(t *testing.T) {
+	ahora := time.Unix(1111111111, 0)
+	actual := Paso(ahora)
+	for desfase := int64(-2); desfase <= 2; desfase++ {
+		codigo, err := CodigoEnPaso(secretoRFC, actual+desfase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paso, ok := Validar(secretoRFC, codigo, ahora)
+		if aceptado := desfase >= -Tolerancia && desfase <= Tolerancia; ok != aceptado {
+			t.Errorf("desfase %d: ok = %v, se esperaba %v", desfase, ok, aceptado)
+		}
+		// Devuelve el paso que coincidió para poder impedir su reutilización
+		if ok && paso != actual+desfase {
+			t.Errorf("desfase %d: paso = %d, se esperaba %d", desfase, paso, actual+desfase)
+		}
+	}
+}
+
+func TestValidarFormato(t *testing.T) {
+	ahora := time.Unix(1111111111, 0)
+	casos := map[string]bool{
+		"050471":    true,
+		" 050 471 ": true,
+		"50471":     false,
+		"0504710":   false,
+		"":          false,
+		"123456":    false,
+	}
+	for codigo, esperado := range casos {
+		if _, ok := Validar(secretoRFC, codigo, ahora); ok != esperado {
+			t.Errorf("Validar(%q) = %v, se esperaba %v", codigo, ok, esperado)
+		}
+	}
+}
+
+func TestGenerarSecretoYURI(t *testing.T) {
+	secreto, err := GenerarSecreto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clave, err := codificacion.DecodeString(secreto); err != nil || len(clave) != 20 {
+		t.Fatalf("secreto %q: %d bytes, %v", secreto, len(clave), err)
+	}
+	uri, err := url.Parse(URI("Recetas", "ana@example.com", secreto))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parametros := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Recetas:ana@example.com" ||
+		parametros.Get("secret") != secreto || parametros.Get("issuer") != "Recetas" ||
+		parametros.Get("digits") != "6" || parametros.Get("period") != "30" {
+		t.Fatalf("URI = %s", uri)
+	}
+}
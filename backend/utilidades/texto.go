@@ -0,0 +1,19 @@
+package utilidades
+
+import "unicode/utf8"
+
+// Truncar recorta texto a como mucho max caracteres sin partir un carácter UTF-8,
+// para ajustarlo a columnas varchar(max) que cuentan caracteres y no bytes.
+func Truncar(texto string, max int) string {
+	if utf8.RuneCountInString(texto) <= max {
+		return texto
+	}
+	indice := 0
+	for i := range texto {
+		if indice == max {
+			return texto[:i]
+		}
+		indice++
+	}
+	return texto
+}
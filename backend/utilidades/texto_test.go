@@ -0,0 +1,34 @@
+package utilidades
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncar(t *testing.T) {
+	casos := []struct {
+		texto    string
+		max      int
+		esperado string
+	}{
+		{"", 5, ""},
+		{"hola", 5, "hola"},
+		{"hola", 4, "hola"},
+		{"hola", 2, "ho"},
+		{"hola", 0, ""},
+		{"añoñería", 3, "año"},
+		{"日本語テキスト", 2, "日本"},
+		{"🙂🙂🙂", 2, "🙂🙂"},
+	}
+	for _, caso := range casos {
+		if obtenido := Truncar(caso.texto, caso.max); obtenido != caso.esperado {
+			t.Errorf("Truncar(%q, %d) = %q; se esperaba %q", caso.texto, caso.max, obtenido, caso.esperado)
+		}
+	}
+	// Un texto con caracteres de varios bytes nunca queda como UTF-8 inválido
+	largo := strings.Repeat("ñ", 300)
+	if recortado := Truncar(largo, 255); !utf8.ValidString(recortado) || utf8.RuneCountInString(recortado) != 255 {
+		t.Fatalf("recorte de %d bytes inválido", len(recortado))
+	}
+}
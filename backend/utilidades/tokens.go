@@ -0,0 +1,25 @@
+package utilidades
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerarTokenAleatorio devuelve un token opaco y seguro de n bytes aleatorios
+// codificado en base64 URL (apto para enlaces y cabeceras).
+func GenerarTokenAleatorio(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken calcula el SHA-256 (hex) de un token para guardarlo en la base de datos
+// sin almacenar nunca el valor original.
+func HashToken(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
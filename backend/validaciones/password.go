@@ -0,0 +1,207 @@
+package validaciones
+
+import (
+	"backend/password"
+	"bufio"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reglas de la política de contraseñas (campo "regla" de cada fallo)
+const (
+	ReglaLongitudMinima  = "longitud_minima"
+	ReglaLongitudMaxima  = "longitud_maxima"
+	ReglaMayuscula       = "mayuscula"
+	ReglaMinuscula       = "minuscula"
+	ReglaNumero          = "numero"
+	ReglaSimbolo         = "simbolo"
+	ReglaDatosPersonales = "datos_personales"
+	ReglaComun           = "comun"
+)
+
+// maxBytesBcrypt es el largo máximo que bcrypt admite: ignora los bytes de más
+const maxBytesBcrypt = 72
+
+// FalloPassword es una regla de la política que la contraseña no cumple
+type FalloPassword struct {
+	Regla   string `json:"regla"`
+	Mensaje string `json:"mensaje"`
+}
+
+// PoliticaPassword define los requisitos de las contraseñas nuevas
+type PoliticaPassword struct {
+	MinLongitud             int  `json:"min_longitud"`
+	MaxLongitud             int  `json:"max_longitud"`
+	RequiereMayuscula       bool `json:"requiere_mayuscula"`
+	RequiereMinuscula       bool `json:"requiere_minuscula"`
+	RequiereNumero          bool `json:"requiere_numero"`
+	RequiereSimbolo         bool `json:"requiere_simbolo"`
+	ProhibirDatosPersonales bool `json:"prohibir_datos_personales"`
+	// MaxBytes limita el largo en bytes (0 sin límite); solo se usa con bcrypt
+	MaxBytes int `json:"max_bytes,omitempty"`
+	// ListaBloqueo son las contraseñas comunes o filtradas (en minúsculas)
+	ListaBloqueo map[string]struct{} `json:"-"`
+}
+
+var (
+	cargaPolitica  sync.Once
+	politicaActual PoliticaPassword
+)
+
+// PoliticaPasswordActual devuelve la política configurada en el entorno (se lee una vez)
+func PoliticaPasswordActual() PoliticaPassword {
+	cargaPolitica.Do(func() {
+		politicaActual = PoliticaPasswordDesdeEntorno()
+	})
+	return politicaActual
+}
+
+// PoliticaPasswordDesdeEntorno arma la política con PASSWORD_MIN_LONGITUD (8),
+// PASSWORD_MAX_LONGITUD (64), PASSWORD_REQUIERE_MAYUSCULA/MINUSCULA/NUMERO (true),
+// PASSWORD_REQUIERE_SIMBOLO (false), PASSWORD_PROHIBIR_DATOS_PERSONALES (true) y la
+// lista de bloqueo de PASSWORD_LISTA_BLOQUEO (datos/passwords_comunes.txt). Si el
+// hash configurado es bcrypt se limita además a 72 bytes.
+func PoliticaPasswordDesdeEntorno() PoliticaPassword {
+	politica := PoliticaPassword{
+		MinLongitud:             enteroEntorno("PASSWORD_MIN_LONGITUD", 8),
+		MaxLongitud:             enteroEntorno("PASSWORD_MAX_LONGITUD", 64),
+		RequiereMayuscula:       booleanoEntorno("PASSWORD_REQUIERE_MAYUSCULA", true),
+		RequiereMinuscula:       booleanoEntorno("PASSWORD_REQUIERE_MINUSCULA", true),
+		RequiereNumero:          booleanoEntorno("PASSWORD_REQUIERE_NUMERO", true),
+		RequiereSimbolo:         booleanoEntorno("PASSWORD_REQUIERE_SIMBOLO", false),
+		ProhibirDatosPersonales: booleanoEntorno("PASSWORD_PROHIBIR_DATOS_PERSONALES", true),
+	}
+	if password.ConfiguracionActual().Algoritmo == password.AlgoritmoBcrypt {
+		politica.MaxBytes = maxBytesBcrypt
+	}
+	archivo := os.Getenv("PASSWORD_LISTA_BLOQUEO")
+	if archivo == "" {
+		archivo = "datos/passwords_comunes.txt"
+	}
+	lista, err := CargarListaBloqueo(archivo)
+	if err != nil {
+		log.Println("No se pudo leer la lista de contraseñas bloqueadas:", err)
+	}
+	politica.ListaBloqueo = lista
+	return politica
+}
+
+// CargarListaBloqueo lee un archivo con una contraseña por línea. Las líneas vacías y
+// las que empiezan con # se ignoran.
+func CargarListaBloqueo(archivo string) (map[string]struct{}, error) {
+	lista := map[string]struct{}{}
+	f, err := os.Open(archivo)
+	if err != nil {
+		return lista, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		linea := strings.TrimSpace(scanner.Text())
+		if linea == "" || strings.HasPrefix(linea, "#") {
+			continue
+		}
+		lista[strings.ToLower(linea)] = struct{}{}
+	}
+	return lista, scanner.Err()
+}
+
+// Validar devuelve las reglas que la contraseña no cumple (vacío si es válida).
+// datosPersonales son el correo, el nombre, etc. que no pueden aparecer en ella.
+func (p PoliticaPassword) Validar(clave string, datosPersonales ...string) []FalloPassword {
+	fallos := []FalloPassword{}
+	longitud := utf8.RuneCountInString(clave)
+	if longitud < p.MinLongitud {
+		fallos = append(fallos, FalloPassword{ReglaLongitudMinima, "Debe tener al menos " + strconv.Itoa(p.MinLongitud) + " caracteres."})
+	}
+	if p.MaxLongitud > 0 && longitud > p.MaxLongitud {
+		fallos = append(fallos, FalloPassword{ReglaLongitudMaxima, "No puede superar los " + strconv.Itoa(p.MaxLongitud) + " caracteres."})
+	} else if p.MaxBytes > 0 && len(clave) > p.MaxBytes {
+		// Los acentos y emojis ocupan varios bytes, así que el límite puede llegar antes
+		fallos = append(fallos, FalloPassword{ReglaLongitudMaxima, "No puede superar los " + strconv.Itoa(p.MaxBytes) + " bytes; los acentos y emojis cuentan como varios."})
+	}
+
+	var mayuscula, minuscula, numero, simbolo bool
+	for _, char := range clave {
+		switch {
+		case unicode.IsUpper(char):
+			mayuscula = true
+		case unicode.IsLower(char):
+			minuscula = true
+		case unicode.IsNumber(char):
+			numero = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			simbolo = true
+		}
+	}
+	if p.RequiereMayuscula && !mayuscula {
+		fallos = append(fallos, FalloPassword{ReglaMayuscula, "Debe incluir al menos una letra mayúscula."})
+	}
+	if p.RequiereMinuscula && !minuscula {
+		fallos = append(fallos, FalloPassword{ReglaMinuscula, "Debe incluir al menos una letra minúscula."})
+	}
+	if p.RequiereNumero && !numero {
+		fallos = append(fallos, FalloPassword{ReglaNumero, "Debe incluir al menos un número."})
+	}
+	if p.RequiereSimbolo && !simbolo {
+		fallos = append(fallos, FalloPassword{ReglaSimbolo, "Debe incluir al menos un símbolo."})
+	}
+
+	minusculas := strings.ToLower(clave)
+	if p.ProhibirDatosPersonales && contieneDatoPersonal(minusculas, datosPersonales) {
+		fallos = append(fallos, FalloPassword{ReglaDatosPersonales, "No puede contener su nombre ni su correo."})
+	}
+	if _, existe := p.ListaBloqueo[minusculas]; existe {
+		fallos = append(fallos, FalloPassword{ReglaComun, "Es una contraseña demasiado común o apareció en filtraciones."})
+	}
+	return fallos
+}
+
+// contieneDatoPersonal revisa el correo (la parte antes de la @) y cada palabra del
+// nombre; se ignoran fragmentos de menos de 3 caracteres
+func contieneDatoPersonal(password string, datos []string) bool {
+	for _, dato := range datos {
+		dato = strings.ToLower(strings.TrimSpace(dato))
+		if i := strings.Index(dato, "@"); i >= 0 {
+			dato = dato[:i]
+		}
+		for _, parte := range strings.FieldsFunc(dato, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}) {
+			if utf8.RuneCountInString(parte) >= 3 && strings.Contains(password, parte) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MensajesFallos une los mensajes de los fallos en un solo texto
+func MensajesFallos(fallos []FalloPassword) string {
+	mensajes := make([]string, 0, len(fallos))
+	for _, f := range fallos {
+		mensajes = append(mensajes, f.Mensaje)
+	}
+	return strings.Join(mensajes, " ")
+}
+
+func enteroEntorno(variable string, defecto int) int {
+	valor, err := strconv.Atoi(os.Getenv(variable))
+	if err != nil || valor <= 0 {
+		return defecto
+	}
+	return valor
+}
+
+func booleanoEntorno(variable string, defecto bool) bool {
+	valor, err := strconv.ParseBool(os.Getenv(variable))
+	if err != nil {
+		return defecto
+	}
+	return valor
+}
@@ -0,0 +1,183 @@
+package validaciones
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// politicaPrueba exige todas las reglas, con una lista de bloqueo fija
+func politicaPrueba() PoliticaPassword {
+	return PoliticaPassword{
+		MinLongitud:             8,
+		MaxLongitud:             20,
+		RequiereMayuscula:       true,
+		RequiereMinuscula:       true,
+		RequiereNumero:          true,
+		RequiereSimbolo:         true,
+		ProhibirDatosPersonales: true,
+		ListaBloqueo:            map[string]struct{}{"password1!": {}, "qwerty123!": {}},
+	}
+}
+
+// reglas devuelve solo las reglas de los fallos, en orden
+func reglas(fallos []FalloPassword) []string {
+	lista := []string{}
+	for _, fallo := range fallos {
+		lista = append(lista, fallo.Regla)
+	}
+	return lista
+}
+
+func TestValidarReglas(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		password string
+		reglas   []string
+	}{
+		{"válida", "Tortilla-2024", []string{}},
+		{"corta", "To-2024", []string{ReglaLongitudMinima}},
+		{"larga", "Tortilla-2024-de-patatas", []string{ReglaLongitudMaxima}},
+		{"sin mayúscula", "tortilla-2024", []string{ReglaMayuscula}},
+		{"sin minúscula", "TORTILLA-2024", []string{ReglaMinuscula}},
+		{"sin número", "Tortilla-dos", []string{ReglaNumero}},
+		{"sin símbolo", "Tortilla2024", []string{ReglaSimbolo}},
+		{"el espacio cuenta como símbolo", "Tortilla 2024", []string{}},
+		{"mayúscula acentuada", "Ñandú-2024", []string{}},
+		{"varias reglas", "tortilla", []string{ReglaMayuscula, ReglaNumero, ReglaSimbolo}},
+		{"común", "Password1!", []string{ReglaComun}},
+		{"común sin distinguir mayúsculas", "QWERTY123!", []string{ReglaMinuscula, ReglaComun}},
+	}
+	for _, caso := range casos {
+		if obtenidas := reglas(politicaPrueba().Validar(caso.password)); !reflect.DeepEqual(obtenidas, caso.reglas) {
+			t.Errorf("%s: reglas %v; se esperaban %v", caso.nombre, obtenidas, caso.reglas)
+		}
+	}
+}
+
+func TestValidarLongitudEnCaracteres(t *testing.T) {
+	politica := PoliticaPassword{MinLongitud: 4, MaxLongitud: 6}
+	// Seis caracteres de dos bytes: cumple aunque ocupe doce bytes
+	if fallos := politica.Validar("ñandús"); len(fallos) != 0 {
+		t.Errorf("ñandús: %v", fallos)
+	}
+	if fallos := politica.Validar("ñandúes"); !reflect.DeepEqual(reglas(fallos), []string{ReglaLongitudMaxima}) {
+		t.Errorf("ñandúes: %v", fallos)
+	}
+	// Sin máximo no hay límite de caracteres
+	politica.MaxLongitud = 0
+	if fallos := politica.Validar(strings.Repeat("a", 500)); len(fallos) != 0 {
+		t.Errorf("sin máximo: %v", fallos)
+	}
+}
+
+func TestValidarMaxBytes(t *testing.T) {
+	// 40 caracteres de dos bytes: dentro del máximo de caracteres pero 80 bytes
+	larga := strings.Repeat("ñ", 40)
+	politica := PoliticaPassword{MaxLongitud: 64}
+	if fallos := politica.Validar(larga); len(fallos) != 0 {
+		t.Fatalf("sin límite de bytes: %v", fallos)
+	}
+
+	politica.MaxBytes = maxBytesBcrypt
+	fallos := politica.Validar(larga)
+	if len(fallos) != 1 || fallos[0].Regla != ReglaLongitudMaxima || !strings.Contains(fallos[0].Mensaje, "72 bytes") {
+		t.Fatalf("con límite de bytes: %v", fallos)
+	}
+	if fallos := politica.Validar(strings.Repeat("ñ", 36)); len(fallos) != 0 {
+		t.Errorf("72 bytes justos: %v", fallos)
+	}
+	// Si ya supera el máximo de caracteres se informa solo ese fallo
+	fallos = politica.Validar(strings.Repeat("a", 80))
+	if len(fallos) != 1 || !strings.Contains(fallos[0].Mensaje, "64 caracteres") {
+		t.Errorf("ambos límites: %v", fallos)
+	}
+}
+
+func TestValidarDatosPersonales(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		password string
+		datos    []string
+		falla    bool
+	}{
+		{"contiene el nombre", "Marianela-2024", []string{"Marianela Pérez", "mp@example.com"}, true},
+		{"contiene el apellido acentuado", "xPÉREZ-2024", []string{"Marianela Pérez"}, true},
+		{"contiene la parte local del correo", "Xjuanito99-2024", []string{"Juan", "juanito99@example.com"}, true},
+		{"contiene una parte del correo con puntos", "Garcia-2024!", []string{"ana.garcia@example.com"}, true},
+		{"el dominio del correo no cuenta", "Example-2024", []string{"ana@example.com"}, false},
+		{"fragmentos cortos se ignoran", "Tortilla-Al-2024", []string{"Al Li", "al@example.com"}, false},
+		{"sin datos", "Tortilla-2024", nil, false},
+		{"datos ajenos", "Tortilla-2024", []string{"Beto", "beto@example.com"}, false},
+	}
+	for _, caso := range casos {
+		fallos := reglas(politicaPrueba().Validar(caso.password, caso.datos...))
+		falla := false
+		for _, regla := range fallos {
+			falla = falla || regla == ReglaDatosPersonales
+		}
+		if falla != caso.falla {
+			t.Errorf("%s: reglas %v; se esperaba datos_personales %v", caso.nombre, fallos, caso.falla)
+		}
+	}
+
+	// La regla puede desactivarse
+	politica := politicaPrueba()
+	politica.ProhibirDatosPersonales = false
+	if fallos := politica.Validar("Marianela-2024", "Marianela"); len(fallos) != 0 {
+		t.Errorf("regla desactivada: %v", fallos)
+	}
+}
+
+func TestCargarListaBloqueo(t *testing.T) {
+	archivo := filepath.Join(t.TempDir(), "lista.txt")
+	contenido := "# contraseñas comunes\n\nPassword1\n  qwerty  \n#comentario\n123456\n"
+	if err := os.WriteFile(archivo, []byte(contenido), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	lista, err := CargarListaBloqueo(archivo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	esperada := map[string]struct{}{"password1": {}, "qwerty": {}, "123456": {}}
+	if !reflect.DeepEqual(lista, esperada) {
+		t.Fatalf("lista %v", lista)
+	}
+
+	// Sin archivo la lista queda vacía y se devuelve el error
+	lista, err = CargarListaBloqueo(filepath.Join(t.TempDir(), "no-existe.txt"))
+	if err == nil || lista == nil || len(lista) != 0 {
+		t.Fatalf("archivo inexistente: %v, %v", lista, err)
+	}
+}
+
+func TestPoliticaPasswordDesdeEntorno(t *testing.T) {
+	archivo := filepath.Join(t.TempDir(), "lista.txt")
+	if err := os.WriteFile(archivo, []byte("Tortilla-2024\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// La configuración del hash se lee una sola vez; es la primera lectura del proceso
+	t.Setenv("PASSWORD_HASH_ALGORITMO", "")
+	t.Setenv("PASSWORD_MIN_LONGITUD", "12")
+	t.Setenv("PASSWORD_MAX_LONGITUD", "x")
+	t.Setenv("PASSWORD_REQUIERE_NUMERO", "false")
+	t.Setenv("PASSWORD_REQUIERE_SIMBOLO", "true")
+	// Un valor que no es booleano usa el valor por defecto
+	t.Setenv("PASSWORD_PROHIBIR_DATOS_PERSONALES", "no")
+	t.Setenv("PASSWORD_LISTA_BLOQUEO", archivo)
+
+	politica := PoliticaPasswordDesdeEntorno()
+	if politica.MinLongitud != 12 || politica.MaxLongitud != 64 || !politica.RequiereMayuscula || politica.RequiereNumero ||
+		!politica.RequiereSimbolo || !politica.ProhibirDatosPersonales {
+		t.Fatalf("política: %+v", politica)
+	}
+	// Sin PASSWORD_HASH_ALGORITMO se usa Argon2id, que no limita los bytes
+	if politica.MaxBytes != 0 {
+		t.Errorf("MaxBytes = %d con Argon2id", politica.MaxBytes)
+	}
+	if !reflect.DeepEqual(reglas(politica.Validar("Tortilla-2024")), []string{ReglaComun}) {
+		t.Errorf("validación: %v", politica.Validar("Tortilla-2024"))
+	}
+}
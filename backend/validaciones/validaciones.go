@@ -2,31 +2,12 @@ package validaciones
 
 import (
 	"regexp"
-	"unicode"
 )
 
 var Regex_correo = regexp.MustCompile("^[a-z0-9._%+-]+@[a-z0-9.-]+\\.[a-z]{2,4}$")
 
-func ValidatePassword(s string) bool {
-	var (
-		hasMinLen = false
-		hasUpper  = false
-		hasLower  = false
-		hasNumber = false
-	)
-	if len(s) >= 6 && len(s) <= 20 {
-		hasMinLen = true
-	}
-	for _, char := range s {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsNumber(char):
-			hasNumber = true
-
-		}
-	}
-	return hasMinLen && hasUpper && hasLower && hasNumber
+// ValidatePassword indica si la contraseña cumple la política configurada.
+// Para conocer qué reglas fallan usar PoliticaPasswordActual().Validar.
+func ValidatePassword(s string, datosPersonales ...string) bool {
+	return len(PoliticaPasswordActual().Validar(s, datosPersonales...)) == 0
 }
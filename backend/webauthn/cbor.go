@@ -0,0 +1,163 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Decodificador CBOR (RFC 8949) mínimo para los objetos de WebAuthn: el
+// attestationObject y las claves COSE. Los autenticadores usan la forma canónica de
+// CTAP2, así que no se admiten longitudes indefinidas.
+
+// maxProfundidad limita el anidamiento para no agotar la pila con datos maliciosos
+const maxProfundidad = 16
+
+var errCborInvalido = errors.New("cbor inválido")
+
+type lectorCbor struct {
+	datos []byte
+	pos   int
+}
+
+// decodificarCbor decodifica el primer valor de datos y devuelve cuántos bytes ocupó.
+// Los enteros se devuelven como int64, las cadenas de bytes como []byte, los textos
+// como string, los arreglos como []interface{} y los mapas como map[interface{}]interface{}.
+func decodificarCbor(datos []byte) (interface{}, int, error) {
+	lector := &lectorCbor{datos: datos}
+	valor, err := lector.valor(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return valor, lector.pos, nil
+}
+
+func (l *lectorCbor) leer(n uint64) ([]byte, error) {
+	if n > uint64(len(l.datos)-l.pos) {
+		return nil, errCborInvalido
+	}
+	bytes := l.datos[l.pos : l.pos+int(n)]
+	l.pos += int(n)
+	return bytes, nil
+}
+
+// argumento lee el tipo mayor y el argumento que lo acompaña
+func (l *lectorCbor) argumento() (byte, byte, uint64, error) {
+	inicial, err := l.leer(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	tipo, info := inicial[0]>>5, inicial[0]&0x1f
+	switch {
+	case info < 24:
+		return tipo, info, uint64(info), nil
+	case info == 24:
+		b, err := l.leer(1)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return tipo, info, uint64(b[0]), nil
+	case info == 25:
+		b, err := l.leer(2)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return tipo, info, uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := l.leer(4)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return tipo, info, uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := l.leer(8)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		return tipo, info, binary.BigEndian.Uint64(b), nil
+	}
+	return 0, 0, 0, errors.New("cbor: longitudes indefinidas no soportadas")
+}
+
+func (l *lectorCbor) valor(profundidad int) (interface{}, error) {
+	if profundidad > maxProfundidad {
+		return nil, errors.New("cbor: anidamiento demasiado profundo")
+	}
+	tipo, info, arg, err := l.argumento()
+	if err != nil {
+		return nil, err
+	}
+	switch tipo {
+	case 0: // entero positivo
+		if arg > math.MaxInt64 {
+			return nil, errCborInvalido
+		}
+		return int64(arg), nil
+	case 1: // entero negativo (-1 - arg)
+		if arg > math.MaxInt64 {
+			return nil, errCborInvalido
+		}
+		return -1 - int64(arg), nil
+	case 2: // cadena de bytes
+		return l.leer(arg)
+	case 3: // texto UTF-8
+		texto, err := l.leer(arg)
+		return string(texto), err
+	case 4: // arreglo
+		if arg > uint64(len(l.datos)) {
+			return nil, errCborInvalido
+		}
+		arreglo := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			elemento, err := l.valor(profundidad + 1)
+			if err != nil {
+				return nil, err
+			}
+			arreglo = append(arreglo, elemento)
+		}
+		return arreglo, nil
+	case 5: // mapa
+		if arg > uint64(len(l.datos)) {
+			return nil, errCborInvalido
+		}
+		mapa := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			clave, err := l.valor(profundidad + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch clave.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("cbor: clave de mapa no soportada")
+			}
+			valor, err := l.valor(profundidad + 1)
+			if err != nil {
+				return nil, err
+			}
+			mapa[clave] = valor
+		}
+		return mapa, nil
+	case 6: // etiqueta: devolvemos el valor etiquetado
+		return l.valor(profundidad + 1)
+	}
+	// Tipo 7: valores simples y números de punto flotante
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25, 26, 27:
+		if info == 26 {
+			return float64(math.Float32frombits(uint32(arg))), nil
+		}
+		if info == 27 {
+			return math.Float64frombits(arg), nil
+		}
+		// Los half-precision no aparecen en WebAuthn
+		return nil, errors.New("cbor: float16 no soportado")
+	}
+	return nil, errCborInvalido
+}
@@ -0,0 +1,121 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+// Algoritmos COSE (RFC 9053) admitidos para las passkeys
+const (
+	AlgES256 = -7   // ECDSA P-256 con SHA-256
+	AlgEdDSA = -8   // Ed25519
+	AlgRS256 = -257 // RSASSA-PKCS1-v1_5 con SHA-256
+)
+
+// AlgoritmosSoportados en orden de preferencia (pubKeyCredParams)
+var AlgoritmosSoportados = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// Parámetros de las claves COSE
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // en RSA es n
+	coseX   = -2 // en RSA es e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// ClavePublica es la clave de una credencial ya interpretada desde su forma COSE
+type ClavePublica struct {
+	Algoritmo int
+	clave     crypto.PublicKey
+}
+
+// ParsearClaveCose interpreta una clave pública COSE_Key codificada en CBOR
+func ParsearClaveCose(datos []byte) (ClavePublica, error) {
+	valor, _, err := decodificarCbor(datos)
+	if err != nil {
+		return ClavePublica{}, err
+	}
+	return claveDesdeMapa(valor)
+}
+
+func claveDesdeMapa(valor interface{}) (ClavePublica, error) {
+	mapa, ok := valor.(map[interface{}]interface{})
+	if !ok {
+		return ClavePublica{}, errors.New("la clave COSE no es un mapa")
+	}
+	kty, _ := mapa[int64(coseKty)].(int64)
+	alg, _ := mapa[int64(coseAlg)].(int64)
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := mapa[int64(coseCrv)].(int64)
+		x, _ := mapa[int64(coseX)].([]byte)
+		y, _ := mapa[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return ClavePublica{}, errors.New("clave EC2 inválida")
+		}
+		// Validamos que el punto pertenezca a la curva antes de usarlo
+		punto := append([]byte{0x04}, append(append([]byte{}, x...), y...)...)
+		if _, err := ecdh.P256().NewPublicKey(punto); err != nil {
+			return ClavePublica{}, errors.New("clave EC2 fuera de la curva P-256")
+		}
+		clave := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		return ClavePublica{Algoritmo: AlgES256, clave: clave}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := mapa[int64(coseCrv)].(int64)
+		x, _ := mapa[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return ClavePublica{}, errors.New("clave Ed25519 inválida")
+		}
+		return ClavePublica{Algoritmo: AlgEdDSA, clave: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := mapa[int64(coseCrv)].([]byte)
+		e, _ := mapa[int64(coseX)].([]byte)
+		exponente := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponente.IsInt64() || exponente.Int64() < 3 || exponente.Int64() > 1<<31-1 {
+			return ClavePublica{}, errors.New("clave RSA inválida (mínimo 2048 bits)")
+		}
+		clave := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponente.Int64())}
+		return ClavePublica{Algoritmo: AlgRS256, clave: clave}, nil
+	}
+	return ClavePublica{}, errors.New("algoritmo de clave no soportado")
+}
+
+// Verificar comprueba la firma de datos con la clave según su algoritmo
+func (c ClavePublica) Verificar(datos, firma []byte) error {
+	switch clave := c.clave.(type) {
+	case *ecdsa.PublicKey:
+		resumen := sha256.Sum256(datos)
+		// Las firmas ES256 de WebAuthn vienen en formato ASN.1 DER
+		if !ecdsa.VerifyASN1(clave, resumen[:], firma) {
+			return ErrFirmaInvalida
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(clave, datos, firma) {
+			return ErrFirmaInvalida
+		}
+		return nil
+	case *rsa.PublicKey:
+		resumen := sha256.Sum256(datos)
+		if rsa.VerifyPKCS1v15(clave, crypto.SHA256, resumen[:], firma) != nil {
+			return ErrFirmaInvalida
+		}
+		return nil
+	}
+	return errors.New("clave pública no inicializada")
+}
@@ -0,0 +1,448 @@
+package webauthn
+
+// Verificación de las ceremonias de WebAuthn (registro y aserción) para passkeys,
+// sin dependencias externas. No se verifican declaraciones de atestación: se pide
+// attestation "none" y se confía en la clave que entrega el autenticador.
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuracionDesafio es el tiempo que tiene el usuario para completar una ceremonia
+const DuracionDesafio = 5 * time.Minute
+
+// Banderas de los datos del autenticador
+const (
+	banderaUP = 0x01 // presencia del usuario
+	banderaUV = 0x04 // verificación del usuario (PIN, biometría)
+	banderaBE = 0x08 // la credencial puede respaldarse (passkey sincronizada)
+	banderaBS = 0x10 // la credencial está respaldada
+	banderaAT = 0x40 // incluye la credencial (solo en el registro)
+	banderaED = 0x80 // incluye extensiones
+)
+
+var (
+	ErrFirmaInvalida   = errors.New("la firma no es válida")
+	ErrDesafio         = errors.New("el desafío no coincide")
+	ErrOrigen          = errors.New("el origen no está permitido")
+	ErrTipo            = errors.New("el tipo de ceremonia no es el esperado")
+	ErrRPID            = errors.New("la credencial no pertenece a este sitio")
+	ErrPresencia       = errors.New("el autenticador no confirmó la presencia del usuario")
+	ErrVerificacion    = errors.New("el autenticador no verificó al usuario")
+	ErrContador        = errors.New("el contador de firmas retrocedió (posible autenticador clonado)")
+	ErrDatosInvalidos  = errors.New("los datos del autenticador no son válidos")
+	ErrSinCredencial   = errors.New("el registro no incluye una credencial")
+	ErrCredencialLarga = errors.New("el id de la credencial es demasiado largo")
+)
+
+// Configuracion identifica al sitio (Relying Party) ante los autenticadores
+type Configuracion struct {
+	RPID     string   // Dominio de la passkey, sin esquema ni puerto (ej. example.com)
+	RPNombre string   // Nombre que muestra el navegador
+	Origenes []string // Orígenes exactos desde los que se aceptan ceremonias
+	// RequiereVerificacion exige PIN o biometría en el autenticador (flag UV)
+	RequiereVerificacion bool
+	// Secreto deriva las credenciales ficticias de los correos sin passkeys
+	Secreto []byte
+}
+
+// ConfiguracionDesdeEntorno lee WEBAUTHN_RP_ID, WEBAUTHN_RP_NOMBRE, WEBAUTHN_ORIGENES
+// (separados por comas), WEBAUTHN_REQUIERE_VERIFICACION y WEBAUTHN_SECRETO. Por
+// defecto el sitio y el origen salen de RUTA_FRONTEND y el secreto de SECRET_JWT.
+func ConfiguracionDesdeEntorno() Configuracion {
+	frontend := strings.TrimRight(os.Getenv("RUTA_FRONTEND"), "/")
+	cfg := Configuracion{
+		RPID:     os.Getenv("WEBAUTHN_RP_ID"),
+		RPNombre: os.Getenv("WEBAUTHN_RP_NOMBRE"),
+		Secreto:  []byte(os.Getenv("WEBAUTHN_SECRETO")),
+	}
+	if len(cfg.Secreto) == 0 {
+		cfg.Secreto = []byte(os.Getenv("SECRET_JWT"))
+	}
+	if cfg.RPID == "" {
+		if u, err := url.Parse(frontend); err == nil {
+			cfg.RPID = u.Hostname()
+		}
+	}
+	if cfg.RPNombre == "" {
+		cfg.RPNombre = "Recetas"
+	}
+	for _, origen := range strings.Split(os.Getenv("WEBAUTHN_ORIGENES"), ",") {
+		if origen = strings.TrimRight(strings.TrimSpace(origen), "/"); origen != "" {
+			cfg.Origenes = append(cfg.Origenes, origen)
+		}
+	}
+	if len(cfg.Origenes) == 0 && frontend != "" {
+		cfg.Origenes = []string{frontend}
+	}
+	cfg.RequiereVerificacion, _ = strconv.ParseBool(os.Getenv("WEBAUTHN_REQUIERE_VERIFICACION"))
+	return cfg
+}
+
+// Codificar devuelve bytes en base64url sin relleno, el formato de WebAuthn en JSON
+func Codificar(datos []byte) string {
+	return base64.RawURLEncoding.EncodeToString(datos)
+}
+
+// Decodificar acepta base64url con o sin relleno
+func Decodificar(valor string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(valor, "="))
+}
+
+// GenerarDesafio devuelve un desafío aleatorio de 32 bytes codificado en base64url
+func GenerarDesafio() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return Codificar(bytes), nil
+}
+
+// ParametroCredencial es un algoritmo aceptado (pubKeyCredParams)
+type ParametroCredencial struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// DescriptorCredencial identifica una credencial existente
+type DescriptorCredencial struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// OpcionesRegistro son las opciones de navigator.credentials.create({publicKey})
+type OpcionesRegistro struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams       []ParametroCredencial  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []DescriptorCredencial `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// OpcionesAsercion son las opciones de navigator.credentials.get({publicKey})
+type OpcionesAsercion struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []DescriptorCredencial `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// OpcionesRegistro arma las opciones para crear una passkey. usuarioID es el user
+// handle (opaco, sin datos personales); excluir son las credenciales ya registradas.
+func (cfg Configuracion) OpcionesRegistro(desafio string, usuarioID []byte, nombre, nombreVisible string, excluir [][]byte) OpcionesRegistro {
+	opciones := OpcionesRegistro{
+		Challenge:          desafio,
+		Timeout:            int(DuracionDesafio.Milliseconds()),
+		ExcludeCredentials: descriptores(excluir),
+		Attestation:        "none",
+	}
+	opciones.RP.ID = cfg.RPID
+	opciones.RP.Name = cfg.RPNombre
+	opciones.User.ID = Codificar(usuarioID)
+	opciones.User.Name = nombre
+	opciones.User.DisplayName = nombreVisible
+	for _, alg := range AlgoritmosSoportados {
+		opciones.PubKeyCredParams = append(opciones.PubKeyCredParams, ParametroCredencial{Type: "public-key", Alg: alg})
+	}
+	opciones.AuthenticatorSelection.ResidentKey = "preferred"
+	opciones.AuthenticatorSelection.UserVerification = cfg.verificacionUsuario()
+	return opciones
+}
+
+// OpcionesAsercion arma las opciones para iniciar sesión. Sin credenciales permitidas
+// el navegador ofrece las passkeys detectables del sitio.
+func (cfg Configuracion) OpcionesAsercion(desafio string, permitidas [][]byte) OpcionesAsercion {
+	return OpcionesAsercion{
+		Challenge:        desafio,
+		Timeout:          int(DuracionDesafio.Milliseconds()),
+		RPID:             cfg.RPID,
+		AllowCredentials: descriptores(permitidas),
+		UserVerification: cfg.verificacionUsuario(),
+	}
+}
+
+// CredencialesFicticias devuelve una o dos credenciales inventadas para un correo sin
+// passkeys (o sin cuenta). Son siempre las mismas para el mismo correo, así las
+// opciones de login no distinguen una cuenta con passkeys de una que no existe.
+func (cfg Configuracion) CredencialesFicticias(correo string) [][]byte {
+	secreto := cfg.Secreto
+	if len(secreto) == 0 {
+		secreto = secretoProceso()
+	}
+	mac := hmac.New(sha256.New, secreto)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(correo))))
+	semilla := mac.Sum(nil)
+	ids := make([][]byte, 0, 2)
+	for i := 0; i <= int(semilla[0]%2); i++ {
+		mac := hmac.New(sha256.New, semilla)
+		mac.Write([]byte{byte(i)})
+		ids = append(ids, mac.Sum(nil))
+	}
+	return ids
+}
+
+var (
+	cargaSecreto sync.Once
+	secretoAzar  []byte
+)
+
+// secretoProceso es un secreto aleatorio para cuando no se configuró ninguno; las
+// credenciales ficticias cambian al reiniciar, pero siguen siendo estables mientras tanto
+func secretoProceso() []byte {
+	cargaSecreto.Do(func() {
+		secretoAzar = make([]byte, 32)
+		if _, err := rand.Read(secretoAzar); err != nil {
+			panic("webauthn: no se pudo generar el secreto: " + err.Error())
+		}
+	})
+	return secretoAzar
+}
+
+func (cfg Configuracion) verificacionUsuario() string {
+	if cfg.RequiereVerificacion {
+		return "required"
+	}
+	return "preferred"
+}
+
+func descriptores(ids [][]byte) []DescriptorCredencial {
+	lista := make([]DescriptorCredencial, 0, len(ids))
+	for _, id := range ids {
+		lista = append(lista, DescriptorCredencial{Type: "public-key", ID: Codificar(id)})
+	}
+	return lista
+}
+
+// DatosCliente es el clientDataJSON que arma el navegador
+type DatosCliente struct {
+	Tipo        string `json:"type"`
+	Desafio     string `json:"challenge"`
+	Origen      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// ParsearDatosCliente interpreta el clientDataJSON; sirve para obtener el desafío y
+// buscar la ceremonia pendiente antes de verificarla
+func ParsearDatosCliente(clientDataJSON []byte) (DatosCliente, error) {
+	var datos DatosCliente
+	if err := json.Unmarshal(clientDataJSON, &datos); err != nil {
+		return datos, ErrDatosInvalidos
+	}
+	return datos, nil
+}
+
+func (cfg Configuracion) verificarDatosCliente(clientDataJSON []byte, tipo, desafio string) error {
+	datos, err := ParsearDatosCliente(clientDataJSON)
+	if err != nil {
+		return err
+	}
+	if datos.Tipo != tipo {
+		return ErrTipo
+	}
+	if len(desafio) == 0 || subtle.ConstantTimeCompare([]byte(datos.Desafio), []byte(desafio)) != 1 {
+		return ErrDesafio
+	}
+	if datos.CrossOrigin {
+		return ErrOrigen
+	}
+	for _, origen := range cfg.Origenes {
+		if datos.Origen == origen {
+			return nil
+		}
+	}
+	return ErrOrigen
+}
+
+// datosAutenticador es el authenticatorData (WebAuthn §6.1)
+type datosAutenticador struct {
+	rpIDHash     []byte
+	banderas     byte
+	contador     uint32
+	aaguid       []byte
+	credencialID []byte
+	claveCose    []byte
+}
+
+func parsearDatosAutenticador(datos []byte) (datosAutenticador, error) {
+	if len(datos) < 37 {
+		return datosAutenticador{}, ErrDatosInvalidos
+	}
+	resultado := datosAutenticador{
+		rpIDHash: datos[:32],
+		banderas: datos[32],
+		contador: binary.BigEndian.Uint32(datos[33:37]),
+	}
+	resto := datos[37:]
+	if resultado.banderas&banderaAT != 0 {
+		if len(resto) < 18 {
+			return datosAutenticador{}, ErrDatosInvalidos
+		}
+		resultado.aaguid = resto[:16]
+		largo := int(binary.BigEndian.Uint16(resto[16:18]))
+		resto = resto[18:]
+		if largo > 1023 {
+			return datosAutenticador{}, ErrCredencialLarga
+		}
+		if len(resto) < largo {
+			return datosAutenticador{}, ErrDatosInvalidos
+		}
+		resultado.credencialID = resto[:largo]
+		resto = resto[largo:]
+		// La clave COSE no indica su largo: lo obtenemos al decodificarla
+		_, consumidos, err := decodificarCbor(resto)
+		if err != nil {
+			return datosAutenticador{}, ErrDatosInvalidos
+		}
+		resultado.claveCose = resto[:consumidos]
+		resto = resto[consumidos:]
+	}
+	if resultado.banderas&banderaED != 0 {
+		_, consumidos, err := decodificarCbor(resto)
+		if err != nil {
+			return datosAutenticador{}, ErrDatosInvalidos
+		}
+		resto = resto[consumidos:]
+	}
+	if len(resto) != 0 {
+		return datosAutenticador{}, ErrDatosInvalidos
+	}
+	return resultado, nil
+}
+
+func (cfg Configuracion) verificarDatosAutenticador(datos datosAutenticador) error {
+	esperado := sha256.Sum256([]byte(cfg.RPID))
+	if !bytes.Equal(datos.rpIDHash, esperado[:]) {
+		return ErrRPID
+	}
+	if datos.banderas&banderaUP == 0 {
+		return ErrPresencia
+	}
+	if cfg.RequiereVerificacion && datos.banderas&banderaUV == 0 {
+		return ErrVerificacion
+	}
+	return nil
+}
+
+// Credencial es una passkey registrada, lista para guardar
+type Credencial struct {
+	ID                  []byte
+	ClaveCose           []byte // Clave pública en formato COSE (se guarda tal cual)
+	Algoritmo           int
+	Contador            uint32
+	AAGUID              []byte // Modelo del autenticador
+	VerificacionUsuario bool
+	Respaldada          bool // Passkey sincronizada entre dispositivos
+}
+
+// VerificarRegistro valida la respuesta de navigator.credentials.create() para el
+// desafío emitido y devuelve la credencial creada
+func (cfg Configuracion) VerificarRegistro(desafio string, clientDataJSON, attestationObject []byte) (Credencial, error) {
+	if err := cfg.verificarDatosCliente(clientDataJSON, "webauthn.create", desafio); err != nil {
+		return Credencial{}, err
+	}
+	valor, _, err := decodificarCbor(attestationObject)
+	if err != nil {
+		return Credencial{}, ErrDatosInvalidos
+	}
+	atestacion, ok := valor.(map[interface{}]interface{})
+	if !ok {
+		return Credencial{}, ErrDatosInvalidos
+	}
+	authData, ok := atestacion["authData"].([]byte)
+	if !ok {
+		return Credencial{}, ErrDatosInvalidos
+	}
+	datos, err := parsearDatosAutenticador(authData)
+	if err != nil {
+		return Credencial{}, err
+	}
+	if err := cfg.verificarDatosAutenticador(datos); err != nil {
+		return Credencial{}, err
+	}
+	if datos.banderas&banderaAT == 0 || len(datos.credencialID) == 0 {
+		return Credencial{}, ErrSinCredencial
+	}
+	clave, err := ParsearClaveCose(datos.claveCose)
+	if err != nil {
+		return Credencial{}, err
+	}
+	return Credencial{
+		ID:                  datos.credencialID,
+		ClaveCose:           datos.claveCose,
+		Algoritmo:           clave.Algoritmo,
+		Contador:            datos.contador,
+		AAGUID:              datos.aaguid,
+		VerificacionUsuario: datos.banderas&banderaUV != 0,
+		Respaldada:          datos.banderas&banderaBS != 0,
+	}, nil
+}
+
+// Asercion es el resultado de una aserción válida
+type Asercion struct {
+	Contador            uint32
+	VerificacionUsuario bool
+	Respaldada          bool
+}
+
+// VerificarAsercion valida la respuesta de navigator.credentials.get() con la clave
+// guardada de la credencial. contadorGuardado es el último contador conocido; si el
+// autenticador lleva contador, el nuevo debe ser mayor.
+func (cfg Configuracion) VerificarAsercion(desafio string, claveCose []byte, contadorGuardado uint32, clientDataJSON, authenticatorData, firma []byte) (Asercion, error) {
+	if err := cfg.verificarDatosCliente(clientDataJSON, "webauthn.get", desafio); err != nil {
+		return Asercion{}, err
+	}
+	datos, err := parsearDatosAutenticador(authenticatorData)
+	if err != nil {
+		return Asercion{}, err
+	}
+	if err := cfg.verificarDatosAutenticador(datos); err != nil {
+		return Asercion{}, err
+	}
+	clave, err := ParsearClaveCose(claveCose)
+	if err != nil {
+		return Asercion{}, err
+	}
+	// La firma cubre authenticatorData || SHA-256(clientDataJSON)
+	resumenCliente := sha256.Sum256(clientDataJSON)
+	firmado := append(append([]byte{}, authenticatorData...), resumenCliente[:]...)
+	if err := clave.Verificar(firmado, firma); err != nil {
+		return Asercion{}, err
+	}
+	// Las passkeys sincronizadas suelen enviar siempre 0; solo se compara si hay contador
+	if (datos.contador != 0 || contadorGuardado != 0) && datos.contador <= contadorGuardado {
+		return Asercion{}, ErrContador
+	}
+	return Asercion{
+		Contador:            datos.contador,
+		VerificacionUsuario: datos.banderas&banderaUV != 0,
+		Respaldada:          datos.banderas&banderaBS != 0,
+	}, nil
+}
@@ -0,0 +1,251 @@
+package webauthn_test
+
+import (
+	"backend/webauthn"
+	"backend/webauthn/webauthntest"
+	"errors"
+	"testing"
+)
+
+const (
+	rpID   = "recetas.example"
+	origen = "https://recetas.example"
+)
+
+func configuracion() webauthn.Configuracion {
+	return webauthn.Configuracion{RPID: rpID, RPNombre: "Recetas", Origenes: []string{origen}, RequiereVerificacion: true}
+}
+
+func decodificar(t *testing.T, valor string) []byte {
+	t.Helper()
+	datos, err := webauthn.Decodificar(valor)
+	if err != nil {
+		t.Fatalf("Decodificar(%q): %v", valor, err)
+	}
+	return datos
+}
+
+// registrar crea una credencial en el autenticador y la verifica
+func registrar(t *testing.T, cfg webauthn.Configuracion, autenticador *webauthntest.Autenticador) webauthn.Credencial {
+	t.Helper()
+	desafio, err := webauthn.GenerarDesafio()
+	if err != nil {
+		t.Fatal(err)
+	}
+	respuesta, err := autenticador.Registrar(desafio, []byte{0, 0, 0, 0, 0, 0, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	credencial, err := cfg.VerificarRegistro(desafio, decodificar(t, respuesta.Response.ClientDataJSON), decodificar(t, respuesta.Response.AttestationObject))
+	if err != nil {
+		t.Fatalf("VerificarRegistro: %v", err)
+	}
+	if webauthn.Codificar(credencial.ID) != respuesta.ID {
+		t.Fatalf("id de la credencial = %s, se esperaba %s", webauthn.Codificar(credencial.ID), respuesta.ID)
+	}
+	return credencial
+}
+
+// asercion firma un desafío nuevo y devuelve el desafío con los datos a verificar
+func asercion(t *testing.T, autenticador *webauthntest.Autenticador) (desafio string, clientData, authData, firma []byte) {
+	t.Helper()
+	desafio, err := webauthn.GenerarDesafio()
+	if err != nil {
+		t.Fatal(err)
+	}
+	respuesta, err := autenticador.Firmar(desafio, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desafio, decodificar(t, respuesta.Response.ClientDataJSON), decodificar(t, respuesta.Response.AuthenticatorData), decodificar(t, respuesta.Response.Signature)
+}
+
+func TestRegistroYAsercion(t *testing.T) {
+	for _, algoritmo := range []int{webauthn.AlgES256, webauthn.AlgEdDSA} {
+		cfg := configuracion()
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		autenticador.Algoritmo = algoritmo
+		credencial := registrar(t, cfg, autenticador)
+		if credencial.Algoritmo != algoritmo || !credencial.VerificacionUsuario || credencial.Contador != 0 {
+			t.Fatalf("credencial inesperada: %+v", credencial)
+		}
+
+		contador := credencial.Contador
+		for i := 0; i < 2; i++ {
+			desafio, clientData, authData, firma := asercion(t, autenticador)
+			resultado, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, contador, clientData, authData, firma)
+			if err != nil {
+				t.Fatalf("algoritmo %d, aserción %d: %v", algoritmo, i+1, err)
+			}
+			if resultado.Contador <= contador || !resultado.VerificacionUsuario {
+				t.Fatalf("algoritmo %d, aserción %d: resultado inesperado %+v", algoritmo, i+1, resultado)
+			}
+			contador = resultado.Contador
+		}
+	}
+}
+
+func TestAsercionSinContador(t *testing.T) {
+	cfg := configuracion()
+	autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+	autenticador.SinContador = true
+	credencial := registrar(t, cfg, autenticador)
+	// Las passkeys sincronizadas envían siempre 0 y no deben tomarse por clonadas
+	for i := 0; i < 2; i++ {
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 0, clientData, authData, firma); err != nil {
+			t.Fatalf("aserción %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestRegistroRechazado(t *testing.T) {
+	casos := []struct {
+		nombre       string
+		autenticador *webauthntest.Autenticador
+		desafio      string // vacío: el mismo que firmó el autenticador
+		esperado     error
+	}{
+		{"origen distinto", webauthntest.NuevoAutenticador(rpID, "https://otro.example"), "", webauthn.ErrOrigen},
+		{"rpIdHash de otro sitio", webauthntest.NuevoAutenticador("otro.example", origen), "", webauthn.ErrRPID},
+		{"sin verificación del usuario", &webauthntest.Autenticador{RPID: rpID, Origen: origen}, "", webauthn.ErrVerificacion},
+		{"desafío distinto", webauthntest.NuevoAutenticador(rpID, origen), "otro-desafio", webauthn.ErrDesafio},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			desafio, err := webauthn.GenerarDesafio()
+			if err != nil {
+				t.Fatal(err)
+			}
+			respuesta, err := caso.autenticador.Registrar(desafio, []byte{1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if caso.desafio != "" {
+				desafio = caso.desafio
+			}
+			_, err = configuracion().VerificarRegistro(desafio, decodificar(t, respuesta.Response.ClientDataJSON), decodificar(t, respuesta.Response.AttestationObject))
+			if !errors.Is(err, caso.esperado) {
+				t.Fatalf("error = %v, se esperaba %v", err, caso.esperado)
+			}
+		})
+	}
+}
+
+func TestAsercionRechazada(t *testing.T) {
+	cfg := configuracion()
+
+	t.Run("origen distinto", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		credencial := registrar(t, cfg, autenticador)
+		autenticador.Origen = "https://recetas.example.phishing"
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 0, clientData, authData, firma); !errors.Is(err, webauthn.ErrOrigen) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrOrigen)
+		}
+	})
+
+	t.Run("rpIdHash de otro sitio", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		credencial := registrar(t, cfg, autenticador)
+		autenticador.RPID = "otro.example"
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 0, clientData, authData, firma); !errors.Is(err, webauthn.ErrRPID) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrRPID)
+		}
+	})
+
+	t.Run("firma alterada", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		credencial := registrar(t, cfg, autenticador)
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		firma[len(firma)-1] ^= 0xff
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 0, clientData, authData, firma); !errors.Is(err, webauthn.ErrFirmaInvalida) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrFirmaInvalida)
+		}
+	})
+
+	t.Run("datos firmados alterados", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		credencial := registrar(t, cfg, autenticador)
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		authData[36]++ // el contador ya no es el que se firmó
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 0, clientData, authData, firma); !errors.Is(err, webauthn.ErrFirmaInvalida) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrFirmaInvalida)
+		}
+	})
+
+	t.Run("clave de otra credencial", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		registrar(t, cfg, autenticador)
+		otra := registrar(t, cfg, webauthntest.NuevoAutenticador(rpID, origen))
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		if _, err := cfg.VerificarAsercion(desafio, otra.ClaveCose, 0, clientData, authData, firma); !errors.Is(err, webauthn.ErrFirmaInvalida) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrFirmaInvalida)
+		}
+	})
+
+	t.Run("contador que retrocede", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		credencial := registrar(t, cfg, autenticador)
+		desafio, clientData, authData, firma := asercion(t, autenticador)
+		// El autenticador envía 1 pero ya se había visto el 5: puede ser un clon
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 5, clientData, authData, firma); !errors.Is(err, webauthn.ErrContador) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrContador)
+		}
+		// Repetir el mismo contador tampoco es válido
+		desafio, clientData, authData, firma = asercion(t, autenticador)
+		if _, err := cfg.VerificarAsercion(desafio, credencial.ClaveCose, 2, clientData, authData, firma); !errors.Is(err, webauthn.ErrContador) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrContador)
+		}
+	})
+
+	t.Run("tipo de ceremonia", func(t *testing.T) {
+		autenticador := webauthntest.NuevoAutenticador(rpID, origen)
+		desafio, err := webauthn.GenerarDesafio()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// La respuesta de un registro no sirve como aserción
+		respuesta, err := autenticador.Registrar(desafio, []byte{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cfg.VerificarAsercion(desafio, nil, 0, decodificar(t, respuesta.Response.ClientDataJSON), nil, nil)
+		if !errors.Is(err, webauthn.ErrTipo) {
+			t.Fatalf("error = %v, se esperaba %v", err, webauthn.ErrTipo)
+		}
+	})
+}
+
+func TestCredencialesFicticias(t *testing.T) {
+	cfg := configuracion()
+	cfg.Secreto = []byte("secreto")
+	ids := cfg.CredencialesFicticias("ana@example.com")
+	if len(ids) < 1 || len(ids) > 2 {
+		t.Fatalf("se esperaban 1 o 2 credenciales, hay %d", len(ids))
+	}
+	for _, id := range ids {
+		if len(id) != 32 {
+			t.Fatalf("id de %d bytes, se esperaban 32", len(id))
+		}
+	}
+	// Estables para el mismo correo (sin importar mayúsculas ni espacios)
+	otra := cfg.CredencialesFicticias(" ANA@example.com ")
+	if len(otra) != len(ids) || webauthn.Codificar(otra[0]) != webauthn.Codificar(ids[0]) {
+		t.Fatalf("las credenciales cambiaron para el mismo correo")
+	}
+	// Distintas para otro correo o con otro secreto
+	if distinta := cfg.CredencialesFicticias("beto@example.com"); webauthn.Codificar(distinta[0]) == webauthn.Codificar(ids[0]) {
+		t.Fatalf("dos correos comparten la credencial ficticia")
+	}
+	cfg.Secreto = []byte("otro secreto")
+	if distinta := cfg.CredencialesFicticias("ana@example.com"); webauthn.Codificar(distinta[0]) == webauthn.Codificar(ids[0]) {
+		t.Fatalf("la credencial ficticia no depende del secreto")
+	}
+	// Sin secreto configurado se usa uno aleatorio del proceso, también estable
+	cfg.Secreto = nil
+	if a, b := cfg.CredencialesFicticias("ana@example.com"), cfg.CredencialesFicticias("ana@example.com"); webauthn.Codificar(a[0]) != webauthn.Codificar(b[0]) {
+		t.Fatalf("sin secreto las credenciales no son estables")
+	}
+}
@@ -0,0 +1,227 @@
+// Package webauthntest implementa un autenticador WebAuthn por software para probar
+// las ceremonias de registro e inicio de sesión sin un navegador ni una llave física.
+// Produce las mismas respuestas JSON que PublicKeyCredential.toJSON() en el navegador.
+package webauthntest
+
+import (
+	"backend/webauthn"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Autenticador es un autenticador virtual con sus credenciales en memoria
+type Autenticador struct {
+	RPID      string
+	Origen    string
+	Algoritmo int  // webauthn.AlgES256 (por defecto) o webauthn.AlgEdDSA
+	Verifica  bool // Si marca la verificación del usuario (flag UV)
+	// SinContador simula una passkey sincronizada, que siempre envía contador 0
+	SinContador bool
+
+	credenciales map[string]*credencial
+}
+
+type credencial struct {
+	id       []byte
+	privada  crypto.Signer
+	usuario  []byte
+	contador uint32
+}
+
+// RespuestaRegistro es el JSON de la credencial creada
+type RespuestaRegistro struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// RespuestaAsercion es el JSON de una aserción (inicio de sesión)
+type RespuestaAsercion struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// NuevoAutenticador crea un autenticador ES256 que verifica al usuario
+func NuevoAutenticador(rpID, origen string) *Autenticador {
+	return &Autenticador{RPID: rpID, Origen: origen, Algoritmo: webauthn.AlgES256, Verifica: true}
+}
+
+// Registrar responde a navigator.credentials.create() con una credencial nueva
+func (a *Autenticador) Registrar(desafio string, usuarioID []byte) (RespuestaRegistro, error) {
+	cred := &credencial{id: make([]byte, 32), usuario: usuarioID}
+	if _, err := rand.Read(cred.id); err != nil {
+		return RespuestaRegistro{}, err
+	}
+	var claveCose []byte
+	switch a.Algoritmo {
+	case webauthn.AlgEdDSA:
+		publica, privada, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return RespuestaRegistro{}, err
+		}
+		cred.privada = privada
+		claveCose = codificarCbor(map[interface{}]interface{}{
+			int64(1): int64(1), int64(3): int64(webauthn.AlgEdDSA), int64(-1): int64(6), int64(-2): []byte(publica),
+		})
+	case webauthn.AlgES256, 0:
+		privada, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return RespuestaRegistro{}, err
+		}
+		cred.privada = privada
+		x, y := make([]byte, 32), make([]byte, 32)
+		privada.PublicKey.X.FillBytes(x)
+		privada.PublicKey.Y.FillBytes(y)
+		claveCose = codificarCbor(map[interface{}]interface{}{
+			int64(1): int64(2), int64(3): int64(webauthn.AlgES256), int64(-1): int64(1), int64(-2): x, int64(-3): y,
+		})
+	default:
+		return RespuestaRegistro{}, errors.New("webauthntest: algoritmo no soportado")
+	}
+
+	// attestedCredentialData: AAGUID (ceros) || largo del id || id || clave COSE
+	adjunto := make([]byte, 16, 16+2+len(cred.id)+len(claveCose))
+	adjunto = binary.BigEndian.AppendUint16(adjunto, uint16(len(cred.id)))
+	adjunto = append(adjunto, cred.id...)
+	adjunto = append(adjunto, claveCose...)
+	authData := a.datosAutenticador(0x40, 0, adjunto)
+
+	clientData, err := a.datosCliente("webauthn.create", desafio)
+	if err != nil {
+		return RespuestaRegistro{}, err
+	}
+	atestacion := codificarCbor(map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": authData,
+	})
+	if a.credenciales == nil {
+		a.credenciales = map[string]*credencial{}
+	}
+	a.credenciales[webauthn.Codificar(cred.id)] = cred
+
+	var respuesta RespuestaRegistro
+	respuesta.ID = webauthn.Codificar(cred.id)
+	respuesta.RawID = respuesta.ID
+	respuesta.Type = "public-key"
+	respuesta.Response.ClientDataJSON = webauthn.Codificar(clientData)
+	respuesta.Response.AttestationObject = webauthn.Codificar(atestacion)
+	return respuesta, nil
+}
+
+// Firmar responde a navigator.credentials.get() con la credencial indicada (base64url)
+// o, si se pasa vacía, con la única registrada
+func (a *Autenticador) Firmar(desafio, credencialID string) (RespuestaAsercion, error) {
+	cred, ok := a.credenciales[credencialID]
+	if credencialID == "" && len(a.credenciales) == 1 {
+		for _, unica := range a.credenciales {
+			cred, ok = unica, true
+		}
+	}
+	if !ok {
+		return RespuestaAsercion{}, errors.New("webauthntest: credencial no registrada")
+	}
+	if !a.SinContador {
+		cred.contador++
+	}
+	authData := a.datosAutenticador(0, cred.contador, nil)
+	clientData, err := a.datosCliente("webauthn.get", desafio)
+	if err != nil {
+		return RespuestaAsercion{}, err
+	}
+	resumenCliente := sha256.Sum256(clientData)
+	firmado := append(append([]byte{}, authData...), resumenCliente[:]...)
+
+	var firma []byte
+	switch privada := cred.privada.(type) {
+	case ed25519.PrivateKey:
+		firma = ed25519.Sign(privada, firmado)
+	case *ecdsa.PrivateKey:
+		resumen := sha256.Sum256(firmado)
+		firma, err = ecdsa.SignASN1(rand.Reader, privada, resumen[:])
+		if err != nil {
+			return RespuestaAsercion{}, err
+		}
+	}
+
+	var respuesta RespuestaAsercion
+	respuesta.ID = webauthn.Codificar(cred.id)
+	respuesta.RawID = respuesta.ID
+	respuesta.Type = "public-key"
+	respuesta.Response.ClientDataJSON = webauthn.Codificar(clientData)
+	respuesta.Response.AuthenticatorData = webauthn.Codificar(authData)
+	respuesta.Response.Signature = webauthn.Codificar(firma)
+	respuesta.Response.UserHandle = webauthn.Codificar(cred.usuario)
+	return respuesta, nil
+}
+
+func (a *Autenticador) datosAutenticador(banderas byte, contador uint32, adjunto []byte) []byte {
+	banderas |= 0x01 // presencia del usuario
+	if a.Verifica {
+		banderas |= 0x04
+	}
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+	datos := append([]byte{}, rpIDHash[:]...)
+	datos = append(datos, banderas)
+	datos = binary.BigEndian.AppendUint32(datos, contador)
+	return append(datos, adjunto...)
+}
+
+func (a *Autenticador) datosCliente(tipo, desafio string) ([]byte, error) {
+	return json.Marshal(webauthn.DatosCliente{Tipo: tipo, Desafio: desafio, Origen: a.Origen})
+}
+
+// codificarCbor codifica los tipos que usa WebAuthn: enteros, bytes, textos y mapas
+func codificarCbor(valor interface{}) []byte {
+	switch v := valor.(type) {
+	case int64:
+		if v >= 0 {
+			return cabeceraCbor(0, uint64(v))
+		}
+		return cabeceraCbor(1, uint64(-1-v))
+	case []byte:
+		return append(cabeceraCbor(2, uint64(len(v))), v...)
+	case string:
+		return append(cabeceraCbor(3, uint64(len(v))), v...)
+	case map[interface{}]interface{}:
+		datos := cabeceraCbor(5, uint64(len(v)))
+		for clave, elemento := range v {
+			datos = append(datos, codificarCbor(clave)...)
+			datos = append(datos, codificarCbor(elemento)...)
+		}
+		return datos
+	}
+	panic("webauthntest: tipo CBOR no soportado")
+}
+
+func cabeceraCbor(tipo byte, arg uint64) []byte {
+	switch {
+	case arg < 24:
+		return []byte{tipo<<5 | byte(arg)}
+	case arg <= 0xff:
+		return []byte{tipo<<5 | 24, byte(arg)}
+	case arg <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{tipo<<5 | 25}, uint16(arg))
+	case arg <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{tipo<<5 | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{tipo<<5 | 27}, arg)
+}